@@ -2,4 +2,7 @@ module github.com/zhiruili/upack
 
 go 1.16
 
-require github.com/jessevdk/go-flags v1.5.0
+require (
+	github.com/jessevdk/go-flags v1.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,39 @@
+// Package testtree writes the file trees the tests of the other packages
+// work on.
+package testtree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write creates the files of tree under dir, the content of a path ending
+// with / is ignored and an empty directory is made, a content starting with
+// -> makes a symlink to the rest. The test is skipped where symlinks are not
+// supported.
+func Write(t testing.TB, dir string, tree map[string]string) {
+	t.Helper()
+	for name, content := range tree {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(content, "->") {
+			if err := os.Symlink(strings.TrimPrefix(content, "->"), path); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package aar
+
+import (
+	"archive/zip"
+	"fmt"
+
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+// Manifest parses the AndroidManifest.xml of the AAR at path.
+func Manifest(path string) (*manifest.Node, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if f.Name != "AndroidManifest.xml" {
+			continue
+		}
+		content, err := ReadEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		root, err := manifest.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("parse manifest of %s: %w", path, err)
+		}
+		if root == nil {
+			return nil, fmt.Errorf("empty manifest in %s", path)
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("no AndroidManifest.xml in %s", path)
+}
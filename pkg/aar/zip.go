@@ -0,0 +1,250 @@
+// Package aar reads and writes the zip archives Android libraries are
+// shipped in, the entries keep their mode and symlinks stay links.
+package aar
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filter tells whether the archive entry at the slash separated path is
+// kept.
+type Filter func(path string, isDir bool) bool
+
+// KeepAll is the filter keeping everything.
+func KeepAll(string, bool) bool {
+	return true
+}
+
+// ReadEntry returns the content of an entry of a zip.
+func ReadEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// Methods returns the compression method of each entry of the zip at path.
+func Methods(path string) (map[string]uint16, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	methods := make(map[string]uint16, len(archive.File))
+	for _, f := range archive.File {
+		methods[f.Name] = f.Method
+	}
+	return methods, nil
+}
+
+// Zip writes the zip of srcDir to out, entries found in methods are
+// compressed with the given method and others are deflated.
+func Zip(out io.Writer, srcDir string, keep Filter, methods map[string]uint16) error {
+	w := zip.NewWriter(out)
+	if err := AddDir(w, srcDir, "", keep, methods); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// addFile streams the file at path into the zip as name, the file mode is
+// kept and symlinks are stored as links.
+func addFile(w *zip.Writer, path, name string, info os.FileInfo, method uint16) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = method
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("create %s in zip: %w", path, err)
+		}
+		_, err = f.Write([]byte(target))
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("create %s in zip: %w", path, err)
+	}
+	if _, err := io.Copy(f, in); err != nil {
+		return fmt.Errorf("write %s to zip: %w", path, err)
+	}
+	return nil
+}
+
+// AddDir adds the files of srcDir kept by keep to the zip under base.
+func AddDir(w *zip.Writer, srcDir, base string, keep Filter, methods map[string]uint16) error {
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		// zip entry names are always separated by forward slashes
+		var relPath = filepath.ToSlash(filepath.Join(base, file.Name()))
+		if !keep(relPath, file.IsDir()) {
+			continue
+		}
+
+		var fullPath = filepath.Join(srcDir, file.Name())
+		if file.IsDir() {
+			if err := AddDir(w, fullPath, relPath, keep, methods); err != nil {
+				return err
+			}
+			continue
+		}
+		method, ok := methods[relPath]
+		if !ok {
+			method = zip.Deflate
+		}
+		if err := addFile(w, fullPath, relPath, file, method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractEntry streams an entry of a zip to the file at path, the Unix mode
+// of the entry is kept.
+func extractEntry(f *zip.File, path string, progress func(int64)) error {
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	perm := f.Mode().Perm()
+	if perm == 0 {
+		// entries zipped on Windows carry no Unix mode
+		perm = 0644
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, progressReader{in, progress}); err != nil {
+		out.Close()
+		return fmt.Errorf("unzip %s: %w", f.Name, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// the mode given to OpenFile is masked by umask
+	return os.Chmod(path, perm)
+}
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	progress func(int64)
+}
+
+func (r progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.progress(int64(n))
+	return n, err
+}
+
+// extractSymlink creates the symlink entry of a zip at path, links pointing
+// out of dstDir are refused.
+func extractSymlink(f *zip.File, path, dstDir string) error {
+	content, err := ReadEntry(f)
+	if err != nil {
+		return err
+	}
+	target := string(content)
+	resolved := filepath.Join(filepath.Dir(path), target)
+	if filepath.IsAbs(target) || !strings.HasPrefix(resolved, filepath.Clean(dstDir)+string(os.PathSeparator)) {
+		return fmt.Errorf("symlink %s points out of the extracted directory: %s", f.Name, target)
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return os.Symlink(target, path)
+}
+
+// UncompressedSize returns the size of the entries of r once extracted.
+func UncompressedSize(r *zip.Reader) int64 {
+	var total int64
+	for _, f := range r.File {
+		total += int64(f.UncompressedSize64)
+	}
+	return total
+}
+
+// Extract writes the entries of r kept by keep into dstDir. The uncompressed
+// bytes processed are passed to progress if it is not nil, skipped entries
+// included, so they add up to UncompressedSize.
+func Extract(r *zip.Reader, dstDir string, keep Filter, progress func(int64)) error {
+	if progress == nil {
+		progress = func(int64) {}
+	}
+	for _, f := range r.File {
+		filePath := filepath.Join(dstDir, f.Name)
+
+		if !strings.HasPrefix(filePath, filepath.Clean(dstDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file path")
+		}
+
+		if !keep(f.Name, f.FileInfo().IsDir()) {
+			progress(int64(f.UncompressedSize64))
+			continue
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return err
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			progress(int64(f.UncompressedSize64))
+			if err := extractSymlink(f, filePath, dstDir); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractEntry(f, filePath, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unzip extracts the entries of the zip at path kept by keep into dstDir.
+func Unzip(path, dstDir string, keep Filter) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return Extract(&archive.Reader, dstDir, keep, nil)
+}
@@ -0,0 +1,253 @@
+package aar
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhiruili/upack/internal/testtree"
+)
+
+func TestAddDirEntryNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		tree  map[string]string
+		base  string
+		keep  Filter
+		names []string
+		links map[string]string
+	}{
+		{
+			name:  "nested files use forward slashes",
+			tree:  map[string]string{"classes.jar": "a", "res/values/values.xml": "b", "jni/arm64-v8a/libx.so": "c"},
+			names: []string{"classes.jar", "jni/arm64-v8a/libx.so", "res/values/values.xml"},
+		},
+		{
+			name:  "base prefixes every entry",
+			tree:  map[string]string{"x.jar": "a", "sub/y.jar": "b"},
+			base:  "libs",
+			names: []string{"libs/sub/y.jar", "libs/x.jar"},
+		},
+		{
+			name:  "directories get no entries of their own",
+			tree:  map[string]string{"empty/": "", "assets/a.txt": "a"},
+			names: []string{"assets/a.txt"},
+		},
+		{
+			name:  "symlinks are stored as links",
+			tree:  map[string]string{"jni/libreal.so": "x", "jni/liblink.so": "->libreal.so"},
+			names: []string{"jni/liblink.so", "jni/libreal.so"},
+			links: map[string]string{"jni/liblink.so": "libreal.so"},
+		},
+		{
+			name: "filter sees slash separated paths",
+			tree: map[string]string{"res/raw/a.txt": "a", "res/raw/b.txt": "b"},
+			keep: func(path string, isDir bool) bool {
+				return isDir || path == "res/raw/a.txt"
+			},
+			names: []string{"res/raw/a.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			testtree.Write(t, dir, tt.tree)
+			keep := tt.keep
+			if keep == nil {
+				keep = KeepAll
+			}
+
+			var buf bytes.Buffer
+			w := zip.NewWriter(&buf)
+			if err := AddDir(w, dir, tt.base, keep, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, f := range r.File {
+				names = append(names, f.Name)
+				target, isLink := tt.links[f.Name]
+				if got := f.Mode()&os.ModeSymlink != 0; got != isLink {
+					t.Errorf("%s: symlink = %v, want %v", f.Name, got, isLink)
+				}
+				if isLink {
+					content, err := ReadEntry(f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if string(content) != target {
+						t.Errorf("%s: link target = %q, want %q", f.Name, content, target)
+					}
+				}
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("entries = %q, want %q", names, tt.names)
+			}
+		})
+	}
+}
+
+func TestZipExtractRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	testtree.Write(t, src, map[string]string{
+		"classes.jar":           "classes",
+		"res/values/values.xml": "<resources/>",
+		"jni/x86/libreal.so":    "elf",
+		"jni/x86/liblink.so":    "->libreal.so",
+	})
+	script := filepath.Join(src, "tools", "run.sh")
+	testtree.Write(t, src, map[string]string{"tools/run.sh": "#!/bin/sh"})
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Zip(&buf, src, KeepAll, map[string]uint16{"classes.jar": zip.Store}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File {
+		want := uint16(zip.Deflate)
+		if f.Name == "classes.jar" {
+			want = zip.Store
+		}
+		if f.Method != want {
+			t.Errorf("%s: method = %d, want %d", f.Name, f.Method, want)
+		}
+	}
+
+	dst := t.TempDir()
+	var done int64
+	keep := func(path string, isDir bool) bool {
+		return !strings.HasPrefix(path, "res/")
+	}
+	if err := Extract(r, dst, keep, func(n int64) { done += n }); err != nil {
+		t.Fatal(err)
+	}
+	if total := UncompressedSize(r); done != total {
+		t.Errorf("progress = %d, want %d", done, total)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "res")); !os.IsNotExist(err) {
+		t.Errorf("filtered res extracted: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dst, "classes.jar"))
+	if err != nil || string(content) != "classes" {
+		t.Errorf("classes.jar = %q, %v", content, err)
+	}
+	info, err := os.Stat(filepath.Join(dst, "tools", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("run.sh mode = %v, want 0755", info.Mode().Perm())
+	}
+	link, err := os.Readlink(filepath.Join(dst, "jni", "x86", "liblink.so"))
+	if err != nil || link != "libreal.so" {
+		t.Errorf("liblink.so -> %q, %v", link, err)
+	}
+}
+
+func TestZipKeepsModeAndTime(t *testing.T) {
+	src := t.TempDir()
+	testtree.Write(t, src, map[string]string{"classes.jar": "classes", "tools/run.sh": "#!/bin/sh"})
+	modes := map[string]os.FileMode{"classes.jar": 0644, "tools/run.sh": 0755}
+	modified := time.Date(2021, 6, 1, 12, 30, 45, 0, time.UTC)
+	for name, mode := range modes {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Zip(&buf, src, KeepAll, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != len(modes) {
+		t.Fatalf("%d entries, want %d", len(r.File), len(modes))
+	}
+	for _, f := range r.File {
+		if got, want := f.Mode().Perm(), modes[f.Name]; got != want {
+			t.Errorf("%s: mode = %v, want %v", f.Name, got, want)
+		}
+		if !f.Modified.Equal(modified) {
+			t.Errorf("%s: modified = %v, want %v", f.Name, f.Modified, modified)
+		}
+	}
+}
+
+// zipOf returns a zip holding the entries, a mode with os.ModeSymlink makes
+// a symlink to the content.
+func zipOf(t *testing.T, entries map[string]os.FileMode, content string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, mode := range entries {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(mode)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries map[string]os.FileMode
+		content string
+	}{
+		{"parent path", map[string]os.FileMode{"../evil.txt": 0644}, "x"},
+		{"nested parent path", map[string]os.FileMode{"res/../../evil.txt": 0644}, "x"},
+		{"absolute symlink", map[string]os.FileMode{"jni/link.so": os.ModeSymlink | 0777}, "/etc/passwd"},
+		{"symlink out", map[string]os.FileMode{"jni/link.so": os.ModeSymlink | 0777}, "../../outside"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "out")
+			if err := Extract(zipOf(t, tt.entries, tt.content), dst, KeepAll, nil); err == nil {
+				t.Fatal("escaping entry extracted")
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("file written out of the destination: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package build runs Gradle builds and turns their output into a short
+// summary of what failed.
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	maxGradleErrors = 20
+	gradleTailLines = 20
+	gradleWhatWrong = "* What went wrong:"
+)
+
+var (
+	javacError  = regexp.MustCompile(`^(.+\.java):(\d+): error: (.+)$`)
+	kotlinError = regexp.MustCompile(`^e: (?:file://)?(.+\.kts?)(?::(\d+):(\d+)|: \((\d+), (\d+)\):) (.+)$`)
+)
+
+// Hint is a suggestion added to the summary when a line of the output
+// contains Match, e.g. how to fix a missing SDK with the tool running
+// Gradle.
+type Hint struct {
+	Match string
+	Text  string
+}
+
+// Output keeps the output of a Gradle run and copies it to File if it is not
+// nil, stdout and stderr are written concurrently.
+type Output struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	File io.Writer
+}
+
+func (l *Output) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.File != nil {
+		// a broken log file must not fail the build
+		if _, err := l.File.Write(data); err != nil {
+			l.File = nil
+		}
+	}
+	return l.buf.Write(data)
+}
+
+// Lines returns the lines written so far.
+func (l *Output) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Split(strings.ReplaceAll(l.buf.String(), "\r\n", "\n"), "\n")
+}
+
+// Error is a failed Gradle run with the summary of its output.
+type Error struct {
+	Err     error
+	Summary []string
+	// LogFile holds the full output, "" if it couldn't be written.
+	LogFile string
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Err.Error())
+	for _, l := range e.Summary {
+		sb.WriteString("\n    " + l)
+	}
+	if e.LogFile != "" {
+		sb.WriteString("\n    full Gradle output at " + e.LogFile)
+	}
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WhatWentWrong returns the lines of the "What went wrong" sections Gradle
+// prints on failure.
+func WhatWentWrong(lines []string) []string {
+	var found []string
+	in := false
+	for _, l := range lines {
+		t := strings.TrimSpace(l)
+		switch {
+		case t == gradleWhatWrong:
+			in = true
+		case !in:
+		case strings.HasPrefix(t, "* "):
+			in = false
+		case t != "":
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+// Summarize picks the compile errors and the failure reasons out
+// of the Gradle output followed by the hints matching it, the tail of the
+// output is used if nothing is recognized.
+func Summarize(lines []string, hints []Hint) []string {
+	var summary []string
+	seen := make(map[string]bool)
+	add := func(l string) {
+		if !seen[l] {
+			seen[l] = true
+			summary = append(summary, l)
+		}
+	}
+
+	errors := 0
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if m := javacError.FindStringSubmatch(l); m != nil {
+			errors++
+			if errors <= maxGradleErrors {
+				add(fmt.Sprintf("%s:%s: %s", m[1], m[2], m[3]))
+			}
+		} else if m := kotlinError.FindStringSubmatch(l); m != nil {
+			line, col := m[2], m[3]
+			if line == "" {
+				line, col = m[4], m[5]
+			}
+			errors++
+			if errors <= maxGradleErrors {
+				add(fmt.Sprintf("%s:%s:%s: %s", m[1], line, col, m[6]))
+			}
+		}
+	}
+	if errors > maxGradleErrors {
+		add(fmt.Sprintf("... and %d more compile errors", errors-maxGradleErrors))
+	}
+	for _, l := range WhatWentWrong(lines) {
+		add(l)
+	}
+	for _, h := range hints {
+		for _, l := range lines {
+			if strings.Contains(l, h.Match) {
+				add("hint: " + h.Text)
+				break
+			}
+		}
+	}
+	if len(summary) > 0 {
+		return summary
+	}
+
+	for i := len(lines) - 1; i >= 0 && len(summary) < gradleTailLines; i-- {
+		if l := strings.TrimSpace(lines[i]); l != "" {
+			summary = append([]string{l}, summary...)
+		}
+	}
+	return summary
+}
+
+// Gradle is a Gradle command to run.
+type Gradle struct {
+	Dir  string
+	Name string
+	Args []string
+	// Stdout and Stderr receive the output as it is written, they may be nil.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Log receives the whole output, it may be nil. LogFile names it in the
+	// error of a failed run.
+	Log     io.Writer
+	LogFile string
+	// Hints are added to the summary of a failed run.
+	Hints []Hint
+	// Runner runs the command, exec.Cmd.Run is used if it is nil.
+	Runner func(cmd *exec.Cmd) error
+}
+
+// Run runs the Gradle command, an *Error summarizing the output is returned
+// if it fails.
+func (g *Gradle) Run() error {
+	out := &Output{File: g.Log}
+	cmd := exec.Command(g.Name, g.Args...)
+	cmd.Dir = g.Dir
+	cmd.Stdout, cmd.Stderr = out, out
+	if g.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(g.Stdout, out)
+	}
+	if g.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(g.Stderr, out)
+	}
+	run := g.Runner
+	if run == nil {
+		run = (*exec.Cmd).Run
+	}
+	if err := run(cmd); err != nil {
+		return &Error{Err: err, Summary: Summarize(out.Lines(), g.Hints), LogFile: g.LogFile}
+	}
+	return nil
+}
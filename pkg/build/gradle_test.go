@@ -0,0 +1,181 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	var many []string
+	for i := 1; i <= maxGradleErrors+2; i++ {
+		many = append(many, fmt.Sprintf("/src/A.java:%d: error: cannot find symbol", i))
+	}
+	var tail []string
+	for i := 1; i <= gradleTailLines+5; i++ {
+		tail = append(tail, fmt.Sprintf("line %d", i))
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		hints []Hint
+		want  []string
+	}{
+		{
+			name: "javac error",
+			lines: []string{
+				"> Task :mymodule:compileReleaseJavaWithJavac",
+				"  /src/Main.java:12: error: ';' expected",
+			},
+			want: []string{"/src/Main.java:12: ';' expected"},
+		},
+		{
+			name: "kotlin errors of both formats",
+			lines: []string{
+				"e: file:///src/Main.kt:3:7 Unresolved reference: foo",
+				"e: /src/Util.kt: (4, 9): Type mismatch",
+			},
+			want: []string{
+				"/src/Main.kt:3:7: Unresolved reference: foo",
+				"/src/Util.kt:4:9: Type mismatch",
+			},
+		},
+		{
+			name:  "repeated errors are reported once",
+			lines: []string{"/src/A.java:1: error: x", "/src/A.java:1: error: x"},
+			want:  []string{"/src/A.java:1: x"},
+		},
+		{
+			name:  "compile errors beyond the limit are counted",
+			lines: many,
+			want: append(func() []string {
+				var w []string
+				for i := 1; i <= maxGradleErrors; i++ {
+					w = append(w, fmt.Sprintf("/src/A.java:%d: cannot find symbol", i))
+				}
+				return w
+			}(), "... and 2 more compile errors"),
+		},
+		{
+			name: "what went wrong",
+			lines: []string{
+				"FAILURE: Build failed with an exception.",
+				"",
+				"* What went wrong:",
+				"Execution failed for task ':mymodule:compileReleaseJavaWithJavac'.",
+				"> Compilation failed; see the compiler error output for details.",
+				"",
+				"* Try:",
+				"Run with --stacktrace option to get the stack trace.",
+			},
+			want: []string{
+				"Execution failed for task ':mymodule:compileReleaseJavaWithJavac'.",
+				"> Compilation failed; see the compiler error output for details.",
+			},
+		},
+		{
+			name:  "matching hint",
+			lines: []string{"* What went wrong:", "SDK location not found."},
+			hints: []Hint{
+				{Match: "SDK location not found", Text: "set ANDROID_HOME"},
+				{Match: "unrelated", Text: "never shown"},
+			},
+			want: []string{"SDK location not found.", "hint: set ANDROID_HOME"},
+		},
+		{
+			name:  "tail of unrecognized output",
+			lines: append(tail, "", "  "),
+			want:  tail[len(tail)-gradleTailLines:],
+		},
+		{
+			name: "no output",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Summarize(tt.lines, tt.hints)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRunner returns a Runner writing out to the output of the command and
+// failing with err, the command it is given is kept in cmd.
+func fakeRunner(out string, err error, cmd **exec.Cmd) func(*exec.Cmd) error {
+	return func(c *exec.Cmd) error {
+		*cmd = c
+		if _, werr := io.WriteString(c.Stdout, out); werr != nil {
+			return werr
+		}
+		return err
+	}
+}
+
+func TestGradleRun(t *testing.T) {
+	var cmd *exec.Cmd
+	var stdout, log bytes.Buffer
+	g := &Gradle{
+		Dir:    "android",
+		Name:   "./gradlew",
+		Args:   []string{":mymodule:assembleRelease"},
+		Stdout: &stdout,
+		Log:    &log,
+		Runner: fakeRunner("BUILD SUCCESSFUL\n", nil, &cmd),
+	}
+	if err := g.Run(); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if cmd.Dir != "android" || !reflect.DeepEqual(cmd.Args, []string{"./gradlew", ":mymodule:assembleRelease"}) {
+		t.Errorf("command %v in %s", cmd.Args, cmd.Dir)
+	}
+	if stdout.String() != "BUILD SUCCESSFUL\n" || log.String() != "BUILD SUCCESSFUL\n" {
+		t.Errorf("stdout %q, log %q", stdout.String(), log.String())
+	}
+}
+
+func TestGradleRunFailure(t *testing.T) {
+	var cmd *exec.Cmd
+	exitErr := errors.New("exit status 1")
+	output := strings.Join([]string{
+		"/src/Main.java:12: error: ';' expected",
+		"* What went wrong:",
+		"Execution failed for task ':mymodule:compileReleaseJavaWithJavac'.",
+		"* Try:",
+		"SDK location not found",
+	}, "\n")
+	g := &Gradle{
+		Name:    "./gradlew",
+		LogFile: "gradle.log",
+		Hints:   []Hint{{Match: "SDK location not found", Text: "set ANDROID_HOME"}},
+		Runner:  fakeRunner(output, exitErr, &cmd),
+	}
+	err := g.Run()
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Run() = %v, *Error expected", err)
+	}
+	if !errors.Is(err, exitErr) {
+		t.Errorf("Run() = %v, doesn't wrap %v", err, exitErr)
+	}
+	want := []string{
+		"/src/Main.java:12: ';' expected",
+		"Execution failed for task ':mymodule:compileReleaseJavaWithJavac'.",
+		"hint: set ANDROID_HOME",
+	}
+	if !reflect.DeepEqual(e.Summary, want) {
+		t.Errorf("Summary = %q, want %q", e.Summary, want)
+	}
+	msg := e.Error()
+	if !strings.HasPrefix(msg, "exit status 1\n    /src/Main.java:12: ';' expected") ||
+		!strings.HasSuffix(msg, "\n    full Gradle output at gradle.log") {
+		t.Errorf("Error() = %q", msg)
+	}
+}
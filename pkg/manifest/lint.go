@@ -0,0 +1,122 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The severities of the lint rules.
+const (
+	SeverityOff     = "off"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// The lint rules.
+const (
+	RuleDebuggable      = "debuggable"
+	RuleMissingExported = "missing-exported"
+	RuleInstallLocation = "install-location"
+)
+
+// DefaultSeverities returns every lint rule with its default severity.
+func DefaultSeverities() map[string]string {
+	return map[string]string{
+		RuleDebuggable:      SeverityWarning,
+		RuleMissingExported: SeverityWarning,
+		RuleInstallLocation: SeverityWarning,
+	}
+}
+
+// Finding is a risky setting found by a lint rule.
+type Finding struct {
+	Rule     string
+	Severity string
+	Problem
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("AndroidManifest.xml:%s [%s]", f.Problem.String(), f.Rule)
+}
+
+// ParseSeverities merges the rule=severity settings over the defaults.
+func ParseSeverities(settings []string) (map[string]string, error) {
+	severities := DefaultSeverities()
+	for _, s := range settings {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("illegal lint setting %s, rule=severity expected", s)
+		}
+		rule, severity := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if _, ok := severities[rule]; !ok {
+			return nil, fmt.Errorf("unknown lint rule %s", rule)
+		}
+		switch severity {
+		case SeverityOff, SeverityWarning, SeverityError:
+		default:
+			return nil, fmt.Errorf("illegal lint severity %s of rule %s", severity, rule)
+		}
+		severities[rule] = severity
+	}
+	return severities, nil
+}
+
+type linter struct {
+	severities map[string]string
+	findings   []Finding
+}
+
+func (l *linter) report(rule string, n *Node, f string, a ...interface{}) {
+	severity := l.severities[rule]
+	if severity == SeverityOff {
+		return
+	}
+	l.findings = append(l.findings, Finding{
+		Rule:     rule,
+		Severity: severity,
+		Problem:  Problem{Line: n.Line, Col: n.Col, Msg: fmt.Sprintf(f, a...)},
+	})
+}
+
+func (l *linter) lint(root *Node) {
+	if v, ok := root.AndroidAttr("installLocation"); ok && v == "preferExternal" {
+		l.report(RuleInstallLocation, root, "android:installLocation=\"preferExternal\" is deprecated and ignored on modern devices")
+	}
+
+	app := root.Child("application")
+	if app == nil {
+		return
+	}
+	if v, ok := app.AndroidAttr("debuggable"); ok && v == "true" {
+		l.report(RuleDebuggable, app, "android:debuggable=\"true\" must not be shipped in release builds")
+	}
+
+	// Android 12 requires android:exported on components with intent filters,
+	// an unknown target SDK is treated as a modern one
+	target := TargetSdk(root)
+	if target != 0 && target < 31 {
+		return
+	}
+	for _, c := range app.Children {
+		switch c.Name.Local {
+		case "activity", "activity-alias", "service", "receiver":
+		default:
+			continue
+		}
+		if c.Child("intent-filter") == nil {
+			continue
+		}
+		if _, ok := c.AndroidAttr("exported"); !ok {
+			name, _ := c.AndroidAttr("name")
+			l.report(RuleMissingExported, c, "<%s> %s has intent filters but no android:exported, which is required targeting Android 12", c.Name.Local, name)
+		}
+	}
+}
+
+// Lint reports the risky settings of the manifest root with the severities
+// given by rule, the rules turned off report nothing.
+func Lint(root *Node, severities map[string]string) []Finding {
+	l := &linter{severities: severities}
+	l.lint(root)
+	return l.findings
+}
@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		settings []string
+		rules    []string
+		severity string
+	}{
+		{
+			name:    "clean manifest",
+			content: `<manifest ` + androidNS + `><application><activity android:name=".Main" android:exported="true"><intent-filter/></activity></application></manifest>`,
+		},
+		{
+			name:    "debuggable application",
+			content: `<manifest ` + androidNS + `><application android:debuggable="true"/></manifest>`,
+			rules:   []string{RuleDebuggable},
+		},
+		{
+			name:    "debuggable false is fine",
+			content: `<manifest ` + androidNS + `><application android:debuggable="false"/></manifest>`,
+		},
+		{
+			name:    "install location on external storage",
+			content: `<manifest ` + androidNS + ` android:installLocation="preferExternal"/>`,
+			rules:   []string{RuleInstallLocation},
+		},
+		{
+			name:    "missing exported with an unknown target",
+			content: `<manifest ` + androidNS + `><application><receiver android:name=".R"><intent-filter/></receiver><service android:name=".S"/></application></manifest>`,
+			rules:   []string{RuleMissingExported},
+		},
+		{
+			name:    "missing exported targeting Android 12",
+			content: `<manifest ` + androidNS + `><uses-sdk android:targetSdkVersion="31"/><application><activity android:name=".Main"><intent-filter/></activity></application></manifest>`,
+			rules:   []string{RuleMissingExported},
+		},
+		{
+			name:    "missing exported before Android 12",
+			content: `<manifest ` + androidNS + `><uses-sdk android:targetSdkVersion="30"/><application><activity android:name=".Main"><intent-filter/></activity></application></manifest>`,
+		},
+		{
+			name:     "rule turned off",
+			content:  `<manifest ` + androidNS + `><application android:debuggable="true"/></manifest>`,
+			settings: []string{"debuggable=off"},
+		},
+		{
+			name:     "rule raised to error",
+			content:  `<manifest ` + androidNS + `><application android:debuggable="true"/></manifest>`,
+			settings: []string{" debuggable = error "},
+			rules:    []string{RuleDebuggable},
+			severity: SeverityError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := Parse([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			severities, err := ParseSeverities(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rules []string
+			for _, f := range Lint(root, severities) {
+				rules = append(rules, f.Rule)
+				want := tt.severity
+				if want == "" {
+					want = SeverityWarning
+				}
+				if f.Severity != want {
+					t.Errorf("%s: severity = %s, want %s", f.Rule, f.Severity, want)
+				}
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("rules = %q, want %q", rules, tt.rules)
+			}
+		})
+	}
+}
+
+func TestParseSeveritiesErrors(t *testing.T) {
+	for _, setting := range []string{"debuggable", "unknown=error", "debuggable=fatal"} {
+		if _, err := ParseSeverities([]string{setting}); err == nil {
+			t.Errorf("ParseSeverities(%q) succeeded", setting)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package manifest parses, validates and lints Android manifests, every
+// element keeps its position so problems can be reported at their line.
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// AndroidNamespace is the namespace of the android: attributes.
+const AndroidNamespace = "http://schemas.android.com/apk/res/android"
+
+// Problem is something wrong found at a position of a manifest.
+type Problem struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Col, p.Msg)
+}
+
+// lineCol converts a byte offset in content into a 1 based line and column.
+func lineCol(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// Element is a start element of a manifest with its position.
+type Element struct {
+	xml.StartElement
+	Line int
+	Col  int
+}
+
+// AndroidAttr returns the value of the android:name like attribute of e.
+func (e *Element) AndroidAttr(local string) (string, bool) {
+	for _, a := range e.Attr {
+		if a.Name.Local == local && (a.Name.Space == AndroidNamespace || a.Name.Space == "android") {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Node is an element of a manifest with the elements it contains.
+type Node struct {
+	Element
+	Children []*Node
+}
+
+// Child returns the first child element named local, nil if there is none.
+func (n *Node) Child(local string) *Node {
+	for _, c := range n.Children {
+		if c.Name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// Package returns the package attribute of the manifest root n.
+func (n *Node) Package() string {
+	for _, a := range n.Attr {
+		if a.Name.Space == "" && a.Name.Local == "package" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Parse parses content into a tree of elements with their positions, nil is
+// returned if content has no element.
+func Parse(content []byte) (*Node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	var stack []*Node
+	var root *Node
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			line, col := lineCol(content, offset)
+			n := &Node{Element: Element{StartElement: t.Copy(), Line: line, Col: col}}
+			if len(stack) == 0 {
+				if root == nil {
+					root = n
+				}
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func sdkVersion(root *Node, attr string) int {
+	sdk := root.Child("uses-sdk")
+	if sdk == nil {
+		return 0
+	}
+	v, _ := sdk.AndroidAttr(attr)
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+// MinSdk returns the minSdkVersion declared by uses-sdk, 0 is returned if
+// there is none.
+func MinSdk(root *Node) int {
+	return sdkVersion(root, "minSdkVersion")
+}
+
+// TargetSdk returns the targetSdkVersion declared by uses-sdk, 0 is returned
+// if there is none.
+func TargetSdk(root *Node) int {
+	return sdkVersion(root, "targetSdkVersion")
+}
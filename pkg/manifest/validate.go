@@ -0,0 +1,123 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var permissionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)+$`)
+
+// components lists the elements whose android:name must be unique in the
+// manifest.
+var components = []string{"activity", "activity-alias", "service", "receiver", "provider"}
+
+type validator struct {
+	problems []Problem
+	names    map[string]map[string]bool
+	apps     int
+}
+
+func (v *validator) report(e *Element, f string, a ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: e.Line, Col: e.Col, Msg: fmt.Sprintf(f, a...)})
+}
+
+func (v *validator) requireAttr(e *Element, local string) (string, bool) {
+	value, ok := e.AndroidAttr(local)
+	if !ok || strings.TrimSpace(value) == "" {
+		v.report(e, "<%s> requires android:%s", e.Name.Local, local)
+		return "", false
+	}
+	return value, true
+}
+
+func (v *validator) checkElement(e *Element, depth int) {
+	tag := e.Name.Local
+	for _, a := range e.Attr {
+		if a.Name.Space == "android" {
+			v.report(e, "namespace of android:%s is not declared", a.Name.Local)
+		}
+	}
+
+	if depth == 1 {
+		if tag != "manifest" {
+			v.report(e, "root element must be <manifest>, got <%s>", tag)
+		}
+		return
+	}
+
+	switch tag {
+	case "application":
+		v.apps++
+		if v.apps > 1 {
+			v.report(e, "more than one <application>")
+		}
+	case "uses-permission", "uses-permission-sdk-23", "permission":
+		if name, ok := v.requireAttr(e, "name"); ok && !permissionName.MatchString(name) {
+			v.report(e, "invalid permission name %q", name)
+		}
+	case "meta-data":
+		v.requireAttr(e, "name")
+	case "provider":
+		v.requireAttr(e, "authorities")
+	}
+
+	for _, c := range components {
+		if tag != c {
+			continue
+		}
+		name, ok := v.requireAttr(e, "name")
+		if !ok {
+			return
+		}
+		if v.names[tag] == nil {
+			v.names[tag] = make(map[string]bool)
+		}
+		if v.names[tag][name] {
+			v.report(e, "duplicate <%s> %s", tag, name)
+		}
+		v.names[tag][name] = true
+	}
+}
+
+// Validate checks the Android manifest content is well formed and
+// structurally valid, every problem found is returned with its position.
+func Validate(content []byte) []Problem {
+	v := &validator{names: make(map[string]map[string]bool)}
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	depth := 0
+	roots := 0
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, col := lineCol(content, dec.InputOffset())
+			if se, ok := err.(*xml.SyntaxError); ok {
+				return append(v.problems, Problem{Line: se.Line, Col: col, Msg: se.Msg})
+			}
+			return append(v.problems, Problem{Line: line, Col: col, Msg: err.Error()})
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			line, col := lineCol(content, offset)
+			e := &Element{StartElement: t, Line: line, Col: col}
+			if depth == 1 {
+				roots++
+			}
+			v.checkElement(e, depth)
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots == 0 {
+		v.problems = append(v.problems, Problem{Line: 1, Col: 1, Msg: "no <manifest> element"})
+	}
+	return v.problems
+}
@@ -0,0 +1,87 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+const androidNS = `xmlns:android="http://schemas.android.com/apk/res/android"`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// msgs are substrings of the problems expected, in order
+		msgs []string
+		line int
+	}{
+		{
+			name:    "valid manifest",
+			content: `<manifest ` + androidNS + ` package="com.example"><application><activity android:name=".Main"/></application></manifest>`,
+		},
+		{
+			name:    "root must be manifest",
+			content: `<application/>`,
+			msgs:    []string{"root element must be <manifest>, got <application>"},
+		},
+		{
+			name:    "undeclared android namespace",
+			content: "<manifest package=\"com.example\">\n  <application android:label=\"x\"/>\n</manifest>",
+			msgs:    []string{"namespace of android:label is not declared"},
+			line:    2,
+		},
+		{
+			name:    "more than one application",
+			content: `<manifest ` + androidNS + `><application/><application/></manifest>`,
+			msgs:    []string{"more than one <application>"},
+		},
+		{
+			name:    "invalid permission name",
+			content: `<manifest ` + androidNS + `><uses-permission android:name="INTERNET"/></manifest>`,
+			msgs:    []string{`invalid permission name "INTERNET"`},
+		},
+		{
+			name:    "component without name",
+			content: `<manifest ` + androidNS + `><application><service/></application></manifest>`,
+			msgs:    []string{"<service> requires android:name"},
+		},
+		{
+			name:    "duplicate activity",
+			content: "<manifest " + androidNS + "><application>\n<activity android:name=\".Main\"/>\n<activity android:name=\".Main\"/>\n</application></manifest>",
+			msgs:    []string{"duplicate <activity> .Main"},
+			line:    3,
+		},
+		{
+			name:    "provider without authorities",
+			content: `<manifest ` + androidNS + `><application><provider android:name=".P"/></application></manifest>`,
+			msgs:    []string{"<provider> requires android:authorities"},
+		},
+		{
+			name:    "syntax error",
+			content: "<manifest " + androidNS + ">\n<application>\n</manifest>",
+			msgs:    []string{"element <application> closed by </manifest>"},
+			line:    3,
+		},
+		{
+			name:    "empty content",
+			content: ``,
+			msgs:    []string{"no <manifest> element"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := Validate([]byte(tt.content))
+			if len(problems) != len(tt.msgs) {
+				t.Fatalf("problems = %v, want %q", problems, tt.msgs)
+			}
+			for i, p := range problems {
+				if !strings.Contains(p.Msg, tt.msgs[i]) {
+					t.Errorf("problem %d = %q, want %q", i, p.Msg, tt.msgs[i])
+				}
+			}
+			if tt.line != 0 && problems[0].Line != tt.line {
+				t.Errorf("line = %d, want %d", problems[0].Line, tt.line)
+			}
+		})
+	}
+}
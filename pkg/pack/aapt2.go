@@ -0,0 +1,67 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+func aapt2Name() string {
+	if runtime.GOOS == "windows" {
+		return "aapt2.exe"
+	}
+	return "aapt2"
+}
+
+// checkAapt2 compiles and links the resources and the manifest of the AAR
+// extracted to dir with aapt2 of the newest Android SDK build tools, so
+// broken resources fail the run instead of the Gradle build of Unity.
+func checkAapt2(dir string) error {
+	if !opts.Aapt2Check {
+		return nil
+	}
+	if previewing() {
+		// the check changes nothing that could be shown
+		logDebug("skip checking resources with aapt2")
+		return nil
+	}
+	sdkDir, err := androidSdkDir()
+	if err != nil {
+		return err
+	}
+	aapt2, err := latestSdkFile(sdkDir, "build-tools/*", aapt2Name())
+	if err != nil {
+		return err
+	}
+	androidJar, err := latestSdkFile(sdkDir, "platforms/android-*", "android.jar")
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "upack-aapt2")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	compiled := filepath.Join(tmpDir, "compiled.zip")
+	linkArgs := []string{"link", "--static-lib", "--auto-add-overlay",
+		"-I", androidJar,
+		"--manifest", filepath.Join(dir, "AndroidManifest.xml"),
+		"-o", filepath.Join(tmpDir, "linked.apk"),
+	}
+	resDir := filepath.Join(dir, "res")
+	if checkDirExist(resDir) == nil {
+		logTrace("start compiling resources in %s with aapt2 ...", resDir)
+		if err := runCommandAt(dir, aapt2, "compile", "--dir", resDir, "-o", compiled); err != nil {
+			return fmt.Errorf("aapt2 compile resources fail: %w", err)
+		}
+		linkArgs = append(linkArgs, compiled)
+	}
+	logTrace("start linking resources with aapt2 ...")
+	if err := runCommandAt(dir, aapt2, linkArgs...); err != nil {
+		return fmt.Errorf("aapt2 link resources fail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package pack
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/zhiruili/upack/pkg/aar"
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+func copyFile(srcFile, dstFile string) error {
+	in, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return dirsync.WriteAtomic(dstFile, info.Mode().Perm(), func(w io.Writer) error {
+		if info.Size() >= progressMinCopy {
+			p := startProgress("copying "+filepath.Base(srcFile), info.Size())
+			defer p.finish()
+			w = io.MultiWriter(w, p)
+		}
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// moveFile moves srcFile to dstFile, which may be on another file system.
+func moveFile(srcFile, dstFile string) error {
+	if err := os.Rename(srcFile, dstFile); err == nil {
+		return nil
+	}
+	if err := copyFile(srcFile, dstFile); err != nil {
+		return err
+	}
+	return os.Remove(srcFile)
+}
+
+// replaceFile moves the rewritten tmpFile over dstFile with the mode perm,
+// temporary files are created readable by the owner only.
+func replaceFile(tmpFile, dstFile string, perm os.FileMode) error {
+	if err := os.Chmod(tmpFile, perm); err != nil {
+		return err
+	}
+	return moveFile(tmpFile, dstFile)
+}
+
+// fileMode returns the permission bits of the file at path, 0644 if there's
+// no such file.
+func fileMode(path string) os.FileMode {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0644
+	}
+	return info.Mode().Perm()
+}
+
+// copyDir copies the files under srcDir to dstDir, the file modes and
+// symlinks are kept.
+func copyDir(srcDir, dstDir string) error {
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, relPath)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, os.ModePerm)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		return copyFile(path, target)
+	})
+}
+
+// moveDir moves srcDir to dstDir, which may be on another file system,
+// dstDir shows up complete or not at all.
+func moveDir(srcDir, dstDir string) error {
+	if err := os.Rename(srcDir, dstDir); err == nil {
+		return nil
+	}
+	if err := copyDirAtomic(srcDir, dstDir); err != nil {
+		return err
+	}
+	return os.RemoveAll(srcDir)
+}
+
+func (o *Options) outputAarFile(baseDir string) string {
+	return filepath.Join(baseDir, o.AndroidModuleName+".aar")
+}
+
+// repackAar copies the AAR to dstFile, the AAR is transformed on the way
+// when requested.
+func repackAar(srcFile, dstFile string) error {
+	if !processAarEnabled() && !conf.hasExecStages() {
+		return copyFile(srcFile, dstFile)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "upack-aar")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	methods, err := aar.Methods(srcFile)
+	if err != nil {
+		return err
+	}
+	if err := unzipFile(srcFile, tmpDir, keepAarEntry); err != nil {
+		return err
+	}
+	env := []string{"UPACK_STAGE_DIR=" + tmpDir, "UPACK_PLUGIN_DIR=" + dstFile}
+	err = runStages(conf.stagesBetween(stageExtract, stageSync), env, func(name string) error {
+		if name == stageFilter {
+			return processAar(tmpDir)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zipDir(tmpDir, dstFile, aar.KeepAll, methods)
+}
+
+// stageAar repacks the built AAR under tmpDir as the file going to dstFile of
+// the output directory baseDir and checks it for duplicate classes with the
+// archives in extras going into baseDir too. The staged AAR is returned.
+func stageAar(tmpDir, format, baseDir, dstFile string, extras map[string]string) (string, error) {
+	staged := filepath.Join(tmpDir, filepath.Base(dstFile))
+	if err := repackAar(opts.moduleAarFile(), staged); err != nil {
+		return "", err
+	}
+	if err := checkDuplicateClasses(format, baseDir, stagedWith(extras, staged, dstFile)); err != nil {
+		return "", err
+	}
+	return staged, nil
+}
+
+// packAar copies the built AAR into baseDir as is, which is consumed natively
+// by Unity 2019.3 and later.
+func packAar(baseDir string, manifest []byte, extras map[string]string) error {
+	tmpDir, err := os.MkdirTemp("", "upack-aar")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	aarFile := opts.outputAarFile(baseDir)
+	staged, err := stageAar(tmpDir, formatAar, baseDir, aarFile, extras)
+	if err != nil {
+		return err
+	}
+	if err := makeDir(baseDir, false); err != nil {
+		return err
+	}
+	logTrace("start copying aar to %s ...", aarFile)
+	if err := removeOrBackup(aarFile, opts.BackupExtension); err != nil {
+		return err
+	}
+	if err := moveFile(staged, aarFile); err != nil {
+		return err
+	}
+
+	logTrace("start generating Android manifest file to %s ...", baseDir)
+	return addAndroidManifestFile(baseDir, manifest, opts.BackupExtension)
+}
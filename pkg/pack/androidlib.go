@@ -0,0 +1,41 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func (o *Options) androidLibPluginDir(baseDir string) string {
+	return filepath.Join(baseDir, o.AndroidModuleName+".androidlib")
+}
+
+// moveClassesJar moves classes.jar of the extracted AAR into libs, where the
+// Gradle project Unity generates for an .androidlib picks up jar files.
+func moveClassesJar(plugDir string) error {
+	logTrace("start moving classes.jar into libs of %s ...", plugDir)
+	jarFile := filepath.Join(plugDir, "classes.jar")
+	if err := checkFileExist(jarFile); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	libsDir := filepath.Join(plugDir, "libs")
+	if err := makeDir(libsDir, false); err != nil {
+		return err
+	}
+	return os.Rename(jarFile, filepath.Join(libsDir, "classes.jar"))
+}
+
+// packAndroidLib extracts the built AAR into baseDir as a <name>.androidlib
+// directory, which Unity 2020 and later recognizes as an Android library
+// project.
+func packAndroidLib(baseDir string, manifest []byte, extras map[string]string) error {
+	plugDir := opts.androidLibPluginDir(baseDir)
+	if err := extractPlugin(formatAndroidLib, baseDir, plugDir, moveClassesJar, extras); err != nil {
+		return err
+	}
+
+	logTrace("start generating Android manifest file to %s ...", baseDir)
+	return addAndroidManifestFile(baseDir, manifest, opts.BackupExtension)
+}
@@ -0,0 +1,76 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	annotationError   = "error"
+	annotationWarning = "warning"
+)
+
+var (
+	annotationDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// annotationFile returns the path of the template source as GitHub expects
+// it, relative to the workspace. "" is returned for built-in and remote
+// templates, which have no file in the repository.
+func annotationFile(source string) string {
+	if source == "" || isURL(source) {
+		return ""
+	}
+	root := os.Getenv("GITHUB_WORKSPACE")
+	if root == "" {
+		root, _ = os.Getwd()
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return filepath.ToSlash(source)
+	}
+	if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(abs)
+}
+
+// annotate prints a finding as a GitHub Actions workflow command when
+// --github-annotations is on, so it shows up inline on pull requests. file
+// may be "" and line and col may be 0 if unknown.
+func annotate(level, file string, line, col int, f string, a ...interface{}) {
+	if !opts.GithubAnnotations {
+		return
+	}
+	var props []string
+	if file != "" {
+		props = append(props, "file="+annotationPropertyEscaper.Replace(file))
+		if line > 0 {
+			props = append(props, "line="+strconv.Itoa(line))
+		}
+		if col > 0 {
+			props = append(props, "col="+strconv.Itoa(col))
+		}
+	}
+	cmd := "::" + level
+	if len(props) > 0 {
+		cmd += " " + strings.Join(props, ",")
+	}
+	fmt.Printf("%s::%s\n", cmd, annotationDataEscaper.Replace(fmt.Sprintf(f, a...)))
+}
+
+// templateLocation returns the line and column at the end of a location
+// given by the template parser as name:line:col.
+func templateLocation(loc string) (int, int) {
+	parts := strings.Split(loc, ":")
+	if len(parts) < 3 {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	col, _ := strconv.Atoi(parts[len(parts)-1])
+	return line, col
+}
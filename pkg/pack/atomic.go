@@ -0,0 +1,34 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+// copyDirAtomic copies srcDir to dstDir, which must not exist, through a
+// temporary sibling renamed into place once every file is copied.
+func copyDirAtomic(srcDir, dstDir string) error {
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dstDir), dirsync.TempSiblingPattern(dstDir))
+	if err != nil {
+		return err
+	}
+	if err := copyDir(srcDir, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Chmod(tmpDir, info.Mode().Perm()); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Rename(tmpDir, dstDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	return nil
+}
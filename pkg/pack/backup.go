@@ -0,0 +1,98 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupTimeLayout = "20060102-150405"
+
+var (
+	backupStamp = regexp.MustCompile(`^\d{8}-\d{6}$`)
+	// backupTime stamps the backups made by the current run.
+	backupTime time.Time
+)
+
+// mirrorPath returns the path under --backup-dir mirroring path, which is
+// relative to the Unity project holding path, or to the file system root
+// outside of Unity projects.
+func mirrorPath(path string) string {
+	if root := findUnityProject(path); root != "" {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			return filepath.Join(opts.BackupDir, rel)
+		}
+	}
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	return filepath.Join(opts.BackupDir, path)
+}
+
+// backupPath returns where the backup of path with extension ext goes, the
+// time of the run is put before ext with --backup-timestamp.
+func backupPath(path, ext string) string {
+	if opts.BackupDir != "" {
+		path = mirrorPath(path)
+	}
+	if !opts.BackupTimestamp {
+		return path + ext
+	}
+	return path + "." + backupTime.Format(backupTimeLayout) + ext
+}
+
+// movePath moves the file or directory src to dst, which may be on another
+// file system.
+func movePath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return moveDir(src, dst)
+	}
+	return moveFile(src, dst)
+}
+
+// backedUpPath returns the output the backup with extension ext was made
+// from, and its timestamp which is "" if it has none.
+func backedUpPath(backup, ext string) (string, string) {
+	path := strings.TrimSuffix(backup, ext)
+	if i := strings.LastIndex(path, "."); i >= 0 && backupStamp.MatchString(path[i+1:]) {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// pruneBackups removes the oldest timestamped backups of path beyond
+// --backup-keep, the pruned backups come back if the run fails.
+func pruneBackups(path, ext string) error {
+	if !opts.BackupTimestamp || opts.BackupKeep <= 0 {
+		return nil
+	}
+	dir := filepath.Dir(backupPath(path, ext))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		if name, stamp := backedUpPath(e.Name(), ext); name == filepath.Base(path) && stamp != "" {
+			backups = append(backups, filepath.Join(dir, e.Name()))
+		}
+	}
+	// the timestamps sort by time
+	sort.Strings(backups)
+	for len(backups) > opts.BackupKeep {
+		logDebug("pruning backup %s", backups[0])
+		if err := saveOriginal(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
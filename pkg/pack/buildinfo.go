@@ -0,0 +1,139 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildInfo records where a plugin build comes from, it is embedded into the
+// outputs so the plugin in the Unity project is traceable.
+type buildInfo struct {
+	Module      string `json:"module"`
+	VersionName string `json:"versionName,omitempty"`
+	VersionCode int    `json:"versionCode,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	Source      string `json:"source"`
+	BuildTime   string `json:"buildTime"`
+}
+
+var info *buildInfo
+
+func commandOutput(dir string, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func gitBuildInfo(dir string) (*buildInfo, error) {
+	describe, err := commandOutput(dir, "git", "describe", "--tags", "--always", "--dirty")
+	if err != nil {
+		return nil, err
+	}
+	commit, err := commandOutput(dir, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	count, err := commandOutput(dir, "git", "rev-list", "--count", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	code, err := strconv.Atoi(count)
+	if err != nil {
+		return nil, fmt.Errorf("illegal commit count %s: %w", count, err)
+	}
+	return &buildInfo{VersionName: strings.TrimPrefix(describe, "v"), VersionCode: code, Commit: commit}, nil
+}
+
+// firstEnv returns the value of the first non-empty environment variable.
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ciBuildInfo reads the version from environment variables of common CI
+// systems like GitHub Actions, GitLab CI and Jenkins.
+func ciBuildInfo() (*buildInfo, error) {
+	bi := &buildInfo{
+		Commit: firstEnv("GITHUB_SHA", "CI_COMMIT_SHA", "GIT_COMMIT"),
+	}
+	if number := firstEnv("BUILD_NUMBER", "GITHUB_RUN_NUMBER", "CI_PIPELINE_IID"); number != "" {
+		code, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("illegal CI build number %s: %w", number, err)
+		}
+		bi.VersionCode = code
+	}
+	if tag := firstEnv("CI_COMMIT_TAG", "GITHUB_REF_NAME"); tag != "" {
+		bi.VersionName = strings.TrimPrefix(tag, "v")
+	} else if len(bi.Commit) >= 7 {
+		bi.VersionName = bi.Commit[:7]
+	}
+	if bi.Commit == "" && bi.VersionCode == 0 {
+		return nil, fmt.Errorf("no CI environment variables found")
+	}
+	return bi, nil
+}
+
+// resolveBuildInfo derives the version from git or the CI environment, the
+// explicitly given versionCode and versionName take precedence.
+func resolveBuildInfo() error {
+	var bi *buildInfo
+	var err error
+	switch opts.VersionFrom {
+	case "git":
+		bi, err = gitBuildInfo(opts.AndroidProjectPath)
+	case "ci":
+		bi, err = ciBuildInfo()
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("derive version from %s: %w", opts.VersionFrom, err)
+	}
+
+	if opts.VersionCode == 0 {
+		opts.VersionCode = bi.VersionCode
+	}
+	if opts.VersionName == "" {
+		opts.VersionName = bi.VersionName
+	}
+	bi.Module = opts.AndroidModuleName
+	bi.VersionCode = opts.VersionCode
+	bi.VersionName = opts.VersionName
+	bi.Source = opts.VersionFrom
+	bi.BuildTime = time.Now().UTC().Format(time.RFC3339)
+	info = bi
+	logDebug("version %s (%d) of commit %s", bi.VersionName, bi.VersionCode, bi.Commit)
+	return nil
+}
+
+func (o *Options) buildInfoFile(dir string) string {
+	return filepath.Join(dir, o.AndroidModuleName+".build-info.json")
+}
+
+func addBuildInfoFile(dir string, backupExt string) error {
+	content, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := opts.buildInfoFile(dir)
+	logTrace("start generating build info file %s ...", path)
+	return backupAndWriteFile(path, append(content, '\n'), backupExt)
+}
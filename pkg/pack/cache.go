@@ -0,0 +1,163 @@
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildCacheFilePrefix starts the names of the build cache files, one for
+// each module built.
+const buildCacheFilePrefix = ".urobot-cache"
+
+// buildCacheSkipDirs are the directories of the Android project holding
+// build outputs or IDE state rather than sources.
+var buildCacheSkipDirs = map[string]bool{
+	"build":                true,
+	".gradle":              true,
+	".idea":                true,
+	".git":                 true,
+	".cxx":                 true,
+	".externalNativeBuild": true,
+	"captures":             true,
+}
+
+func buildCacheFile() string {
+	module := strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(opts.AndroidModuleName)
+	return filepath.Join(opts.AndroidProjectPath, buildCacheFilePrefix+"-"+module)
+}
+
+// isBuildCacheFile tells whether name is the build cache file of a module.
+func isBuildCacheFile(name string) bool {
+	return strings.HasPrefix(name, buildCacheFilePrefix)
+}
+
+// walkSources calls fn for every source file of the Android project, the
+// build output directories and IDE state of the project root and of the
+// module roots are skipped.
+func walkSources(projectDir string, fn func(path, relPath string, info os.FileInfo) error) error {
+	return filepath.Walk(projectDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(projectDir, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if relPath != "." && buildCacheSkipDirs[info.Name()] && isModuleRoot(projectDir, filepath.Dir(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == lockFileName || isBuildCacheFile(info.Name()) {
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), ".iml") {
+			return nil
+		}
+		return fn(path, relPath, info)
+	})
+}
+
+// isModuleRoot tells whether dir is the root of the project or of one of its
+// modules, the directories where Gradle and the IDE keep their state. A
+// directory named build deeper in the sources is a source.
+func isModuleRoot(projectDir, dir string) bool {
+	return filepath.Clean(dir) == filepath.Clean(projectDir) || moduleBuildScript(dir) != ""
+}
+
+// buildCacheKey hashes the source inputs of the module of the Android
+// project, its name then the paths, modes and contents of every file outside
+// the build output directories.
+func buildCacheKey(projectDir, module string) (string, error) {
+	defer timePhase("source hashing")()
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", module)
+	err := walkSources(projectDir, func(path, relPath string, info os.FileInfo) error {
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(relPath), info.Mode())
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, link)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gradleInputsKey combines the hash of the sources with what else the build
+// depends on, the resolved Gradle arguments, the JDK and where Gradle runs.
+func gradleInputsKey(sourceHash string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", sourceHash)
+	for _, arg := range gradleArgs("assembleDebug") {
+		fmt.Fprintf(h, "arg\x00%s\n", arg)
+	}
+	fmt.Fprintf(h, "java-home\x00%s\n", os.Getenv("JAVA_HOME"))
+	fmt.Fprintf(h, "docker\x00%s\n", opts.DockerImage)
+	if remote != nil {
+		fmt.Fprintf(h, "remote\x00%s\n", remote)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildCached tells whether the last successful build was made from the
+// sources hashed to key and its AAR is still around.
+func buildCached(key string) bool {
+	content, err := ioutil.ReadFile(buildCacheFile())
+	if err != nil || strings.TrimSpace(string(content)) != key {
+		return false
+	}
+	return checkFileExist(opts.moduleAarFile()) == nil
+}
+
+func saveBuildCache(key string) error {
+	return ioutil.WriteFile(buildCacheFile(), []byte(key+"\n"), 0644)
+}
+
+// buildAndroidCached builds the Android project unless its sources, hashed
+// to sourceHash, and the Gradle inputs are unchanged since the last
+// successful build.
+func buildAndroidCached(path, sourceHash string) error {
+	if opts.NoCache {
+		defer timePhase("Gradle build")()
+		return buildAndroid(path)
+	}
+	key := gradleInputsKey(sourceHash)
+	if buildCached(key) {
+		logDebug("sources of %s unchanged since the last build, skip building", path)
+		notePhase("Gradle build", "skipped, sources unchanged")
+		return nil
+	}
+	done := timePhase("Gradle build")
+	err := buildAndroid(path)
+	done()
+	if err != nil {
+		return err
+	}
+	if err := saveBuildCache(key); err != nil {
+		logWarning("save build cache fail: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/aar"
+)
+
+func isClassEntry(name string) bool {
+	return strings.HasSuffix(name, ".class") &&
+		!strings.HasSuffix(name, "module-info.class") &&
+		!strings.HasPrefix(name, "META-INF/")
+}
+
+func isNestedJarEntry(name string) bool {
+	return name == "classes.jar" || (strings.HasPrefix(name, "libs/") && strings.HasSuffix(name, ".jar"))
+}
+
+func jarClasses(r *zip.Reader) []string {
+	var classes []string
+	for _, f := range r.File {
+		if isClassEntry(f.Name) {
+			classes = append(classes, f.Name)
+		}
+	}
+	return classes
+}
+
+// aarClasses returns the classes in the jars embedded in an AAR, keyed by
+// the source name of each jar.
+func aarClasses(path string, r *zip.Reader) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, f := range r.File {
+		if !isNestedJarEntry(f.Name) {
+			continue
+		}
+		bs, err := aar.ReadEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		jr, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+		if err != nil {
+			return nil, fmt.Errorf("open %s in %s: %w", f.Name, path, err)
+		}
+		result[path+"!/"+f.Name] = jarClasses(jr)
+	}
+	return result, nil
+}
+
+// indexArchiveClasses adds the classes in the jar or aar at path to index.
+func indexArchiveClasses(index map[string][]string, path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer archive.Close()
+
+	sources := map[string][]string{path: nil}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".aar", ".srcaar":
+		if sources, err = aarClasses(path, &archive.Reader); err != nil {
+			return err
+		}
+	default:
+		sources[path] = jarClasses(&archive.Reader)
+	}
+	for source, classes := range sources {
+		for _, c := range classes {
+			index[c] = append(index[c], source)
+		}
+	}
+	return nil
+}
+
+func isClassArchive(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jar", ".aar", ".srcaar":
+		return true
+	}
+	return false
+}
+
+// indexClasses indexes the classes of every jar and aar under dirs, backups
+// left by previous runs and the paths in skip are ignored.
+func indexClasses(skip map[string]bool, dirs ...string) (map[string][]string, error) {
+	index := make(map[string][]string)
+	visited := make(map[string]bool)
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if visited[path] {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			visited[path] = true
+			if skip[path] || isSavedPath(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || !isClassArchive(path) {
+				return nil
+			}
+			return indexArchiveClasses(index, path)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+type classCollision struct {
+	Sources []string
+	Classes []string
+}
+
+// findClassCollisions groups the classes defined more than once by the set
+// of archives defining them.
+func findClassCollisions(index map[string][]string) []classCollision {
+	groups := make(map[string]*classCollision)
+	for class, sources := range index {
+		if len(sources) < 2 {
+			continue
+		}
+		sort.Strings(sources)
+		key := strings.Join(sources, "\n")
+		g, ok := groups[key]
+		if !ok {
+			g = &classCollision{Sources: sources}
+			groups[key] = g
+		}
+		g.Classes = append(g.Classes, class)
+	}
+
+	collisions := make([]classCollision, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.Classes)
+		collisions = append(collisions, *g)
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return strings.Join(collisions[i].Sources, "\n") < strings.Join(collisions[j].Sources, "\n")
+	})
+	return collisions
+}
+
+func (c *classCollision) String() string {
+	const maxExamples = 3
+	examples := c.Classes
+	if len(examples) > maxExamples {
+		examples = examples[:maxExamples]
+	}
+	return fmt.Sprintf("%d duplicate classes in %s, e.g. %s",
+		len(c.Classes), strings.Join(c.Sources, ", "), strings.Join(examples, ", "))
+}
+
+// copiedArchives maps the dependencies and the per-ABI AARs copied into the
+// output directory baseDir to where they go.
+func copiedArchives(format, baseDir string, deps []resolvedDependency, abiAars []string) map[string]string {
+	dir := pluginFilesDir(format, baseDir)
+	archives := make(map[string]string, len(deps)+len(abiAars))
+	for _, d := range deps {
+		archives[d.File] = filepath.Join(dir, filepath.Base(d.File))
+	}
+	for _, a := range abiAars {
+		archives[a] = filepath.Join(dir, filepath.Base(a))
+	}
+	return archives
+}
+
+// stagedWith returns the staged paths with src going to dst added.
+func stagedWith(staged map[string]string, src, dst string) map[string]string {
+	all := make(map[string]string, len(staged)+1)
+	for s, d := range staged {
+		all[s] = d
+	}
+	all[src] = dst
+	return all
+}
+
+// indexStagedClasses adds the classes of the staged file or directory src to
+// index under the names they get once written to dst.
+func indexStagedClasses(index map[string][]string, src, dst string) error {
+	staged, err := indexClasses(nil, src)
+	if err != nil {
+		return err
+	}
+	for class, sources := range staged {
+		for _, source := range sources {
+			index[class] = append(index[class], dst+strings.TrimPrefix(source, src))
+		}
+	}
+	return nil
+}
+
+// checkDuplicateClasses reports classes defined in more than one archive
+// among the Android plugins of the Unity project baseDir belongs to, which
+// would otherwise only fail the D8 step of the Unity build. staged maps what
+// is about to be written to where it goes, it is checked in place of what it
+// replaces before the sync so an error leaves the outputs untouched.
+func checkDuplicateClasses(format, baseDir string, staged map[string]string) error {
+	if opts.DuplicateClasses == policyOff {
+		return nil
+	}
+	logTrace("start checking duplicate classes ...")
+	skip := ownedPaths(format, baseDir)
+	for _, dst := range staged {
+		skip[dst] = true
+	}
+	index, err := indexClasses(skip, unityTemplateDir(baseDir), pluginFilesDir(format, baseDir))
+	if err != nil {
+		return err
+	}
+	for src, dst := range staged {
+		if err := indexStagedClasses(index, src, dst); err != nil {
+			return err
+		}
+	}
+	collisions := findClassCollisions(index)
+	if len(collisions) == 0 {
+		return nil
+	}
+	if opts.DuplicateClasses == policyWarn {
+		for i := range collisions {
+			logWarning("%s", collisions[i].String())
+		}
+		return nil
+	}
+	msgs := make([]string, 0, len(collisions))
+	for i := range collisions {
+		msgs = append(msgs, collisions[i].String())
+	}
+	return fmt.Errorf("duplicate classes found:\n  %s", strings.Join(msgs, "\n  "))
+}
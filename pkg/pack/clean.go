@@ -0,0 +1,271 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type cleanCommand struct{}
+
+// ownedOutputs lists what packing writes into baseDir with the layout of the
+// given format, relative to the output root directory. Without result only
+// the plugin itself is listed.
+func ownedOutputs(format, baseDir string, result *buildResult) []string {
+	root := outputRootDir(format, baseDir)
+	var paths []string
+	switch format {
+	case formatUpm:
+		paths = append(paths, filepath.Join(root, "package.json"), filepath.Join(root, "Runtime"))
+	case formatAar:
+		paths = append(paths, opts.outputAarFile(baseDir), filepath.Join(baseDir, "AndroidManifest.xml"))
+	case formatSrcAar:
+		paths = append(paths, opts.m2ArtifactDir(baseDir), filepath.Join(baseDir, "AndroidManifest.xml"))
+	case formatAndroidLib:
+		paths = append(paths, opts.androidLibPluginDir(baseDir), filepath.Join(baseDir, "AndroidManifest.xml"))
+	default:
+		paths = append(paths, opts.libraryPluginDir(baseDir), filepath.Join(baseDir, "AndroidManifest.xml"))
+	}
+	if result != nil {
+		for _, f := range result.Files[baseDir] {
+			paths = append(paths, filepath.Join(pluginDir(format, baseDir), f.Path))
+		}
+		for _, c := range result.Copies[baseDir] {
+			paths = append(paths, filepath.Join(pluginDir(format, baseDir), c.Dst))
+		}
+		for _, aar := range result.AbiAars {
+			paths = append(paths, filepath.Join(pluginFilesDir(format, baseDir), filepath.Base(aar)))
+		}
+	}
+	if opts.ResolveDependencies {
+		paths = append(paths, opts.dependencyLockPath(pluginFilesDir(format, baseDir)))
+	}
+	if opts.EdmDependencies {
+		paths = append(paths, opts.edmDependenciesFile(root))
+	}
+	if info != nil {
+		paths = append(paths, opts.buildInfoFile(root))
+	}
+
+	var owned []string
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil || strings.HasPrefix(rel, "..") || ownedBy(owned, filepath.ToSlash(rel)) {
+			continue
+		}
+		owned = append(owned, filepath.ToSlash(rel))
+	}
+	return owned
+}
+
+// staleOutputs returns the paths recorded in the fingerprint of the previous
+// run in baseDir which the current one doesn't write, e.g. the AAR of the aar
+// format once the output turned androidlib. Without result the files declared
+// in the config file are taken as stale too.
+func staleOutputs(format, baseDir string, result *buildResult) ([]string, error) {
+	root := outputRootDir(format, baseDir)
+	prev, err := readFingerprint(root)
+	if err != nil || prev == nil {
+		return nil, err
+	}
+	current := ownedOutputs(format, baseDir, result)
+	var stale []string
+	for _, rel := range prev.Outputs {
+		if ownedBy(current, rel) {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		stale = append(stale, path)
+		if strings.HasSuffix(path, "."+dependencyLockFile) {
+			deps, err := readDependencyLock(path)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			for _, d := range deps {
+				stale = append(stale, filepath.Join(filepath.Dir(path), d.File))
+			}
+		}
+	}
+	return stale, nil
+}
+
+// removeStaleOutputs removes what the previous run wrote into baseDir and the
+// current one doesn't, so the plugin packed in another format doesn't stay
+// next to the new one and define its classes twice.
+func removeStaleOutputs(format, baseDir string, result *buildResult) error {
+	stale, err := staleOutputs(format, baseDir, result)
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if !pathExists(path) {
+			continue
+		}
+		logDebug("removing stale output %s", path)
+		if err := removeOrBackup(path, opts.BackupExtension); err != nil {
+			return err
+		}
+		if err := saveOriginal(path + ".meta"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownedBy tells whether rel is one of owned or inside one of them.
+func ownedBy(owned []string, rel string) bool {
+	for _, o := range owned {
+		if rel == o || strings.HasPrefix(rel, o+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// leftovers lists the .meta file, the backups and the temporary files of
+// path which are left next to it.
+func leftovers(path string) ([]string, error) {
+	found := []string{path + ".meta", tempSavePath(path)}
+	dir, base := filepath.Dir(path), filepath.Base(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, "."+base+".") && strings.HasSuffix(name, ".tmp") {
+			found = append(found, filepath.Join(dir, name))
+		}
+	}
+
+	ext := opts.BackupExtension
+	if ext == "" {
+		return found, nil
+	}
+	backupDir := filepath.Dir(backupPath(path, ext))
+	if backupDir != dir {
+		if entries, err = os.ReadDir(backupDir); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		if name, _ := backedUpPath(e.Name(), ext); name == base {
+			backup := filepath.Join(backupDir, e.Name())
+			found = append(found, backup, backup+".meta")
+		}
+	}
+	return found, nil
+}
+
+// removeGenerated removes path if it exists, it is printed in dry run mode
+// instead.
+func removeGenerated(path string) error {
+	if !pathExists(path) {
+		return nil
+	}
+	if opts.DryRun {
+		planf("remove %s", path)
+		return nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("delete %s: %w", path, err)
+	}
+	printProgress("removed %s", path)
+	return nil
+}
+
+// cleanOutput removes what previous runs generated in baseDir, as recorded in
+// the fingerprint of the module.
+func cleanOutput(baseDir string) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	root := outputRootDir(format, baseDir)
+	fp, err := readFingerprint(root)
+	if err != nil {
+		return err
+	}
+	if fp == nil {
+		printProgress("no fingerprint of module %s found in %s, nothing to clean", opts.AndroidModuleName, baseDir)
+		return nil
+	}
+	owned := fp.Outputs
+	if len(owned) == 0 {
+		// fingerprints of older versions don't record the outputs
+		owned = ownedOutputs(format, baseDir, nil)
+	}
+
+	var paths []string
+	for _, rel := range owned {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		paths = append(paths, path)
+		if strings.HasSuffix(path, "."+dependencyLockFile) {
+			deps, err := readDependencyLock(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, d := range deps {
+				paths = append(paths, filepath.Join(filepath.Dir(path), d.File))
+			}
+		}
+	}
+	// the fingerprint goes last, a failed clean can be run again
+	paths = append(paths, opts.fingerprintFile(root))
+
+	for _, path := range paths {
+		more, err := leftovers(path)
+		if err != nil {
+			return err
+		}
+		for _, p := range append([]string{path}, more...) {
+			if err := removeGenerated(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if root != baseDir && !opts.DryRun {
+		// the UPM package directory only holds the plugin
+		if entries, err := os.ReadDir(root); err == nil && len(entries) == 0 {
+			if err := os.Remove(root); err != nil {
+				return err
+			}
+			return removeGenerated(root + ".meta")
+		}
+	}
+	return nil
+}
+
+// Execute removes the outputs generated by previous runs in each output
+// directory given by args.
+func (c *cleanCommand) Execute(args []string) error {
+	if opts.BackupDir != "" {
+		if err := setAbsPath("Backup directory", &opts.BackupDir); err != nil {
+			return err
+		}
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for i := range args {
+		if err := setAbsPath("Output directory", &args[i]); err != nil {
+			return err
+		}
+		if err := checkDirExist(args[i]); err != nil {
+			return fmt.Errorf("output directory no found: %w", err)
+		}
+	}
+	if !opts.DryRun {
+		unlock, err := acquireLocks(args)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	return forEachOutput(args, cleanOutput)
+}
@@ -0,0 +1,1542 @@
+package pack
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/zhiruili/upack/pkg/aar"
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+var sep = string(filepath.Separator)
+
+type Options struct {
+	// Slice of bool will append 'true' each time the option is encountered (can be set multiple times, like -vvv)
+	Verbose                   []bool   `short:"v" long:"verbose" description:"Show verbose debug information"`
+	Quiet                     bool     `short:"q" long:"quiet" env:"UPACK_QUIET" description:"Only show the errors, for scripts capturing the output"`
+	LogLevel                  string   `long:"log-level" env:"UPACK_LOG_LEVEL" description:"Lowest level of the logged records, overrides -v" choice:"trace" choice:"debug" choice:"info" choice:"warning" choice:"error"`
+	LogFormat                 string   `long:"log-format" env:"UPACK_LOG_FORMAT" description:"Format of the log written to stderr, json writes a record per line" choice:"text" choice:"json" default:"text"`
+	LogTimestamps             bool     `long:"log-timestamps" env:"UPACK_LOG_TIMESTAMPS" description:"Prefix the text log records with their time"`
+	LogFile                   string   `long:"log-file" env:"UPACK_LOG_FILE" description:"Also write the log to the file at full verbosity, including the output of Gradle and the other commands run"`
+	NoColor                   bool     `long:"no-color" env:"UPACK_NO_COLOR" description:"Don't color the errors, warnings and headers, colors are also off with NO_COLOR or when the output is not a terminal"`
+	ShowConfig                bool     `long:"show-config" description:"Print the value of every option with where it comes from, flag, environment variable, config file or default, and the resolved config file, then exit"`
+	AndroidModuleName         string   `short:"m" long:"android-module-name" env:"UPACK_ANDROID_MODULE_NAME" description:"Android module name" required:"true"`
+	AndroidProjectPath        string   `short:"a" long:"android-path" env:"UPACK_ANDROID_PROJECT_PATH" description:"Android project path" required:"true"`
+	AndroidEntryActivity      string   `short:"e" long:"entry-activity" env:"UPACK_ENTRY_ACTIVITY" description:"Full name of entry activity " required:"true"`
+	AndroidPermissions        []string `short:"p" long:"android-permissions" env:"UPACK_ANDROID_PERMISSIONS" description:"Acquire permissions in Android manifest" required:"false"`
+	AndroidActivityAttributes []string `short:"t" long:"android-activity-attributes" env:"UPACK_ANDROID_ACTIVITY_ATTRIBUTES" description:"Additional activity attributes in Android manifest" required:"false"`
+	AndroidRemoveJarContent   []string `short:"r" long:"android-remove-jar-content" env:"UPACK_ANDROID_REMOVE_JAR_CONTENT" description:"Remove entries matching the glob (com/unity3d/**), regex (re:^META-INF/.*\\.SF$) or containing the string (contains:BuildConfig) from Jar file" required:"false"`
+	AndroidKeepJarContent     []string `long:"android-keep-jar-content" env:"UPACK_ANDROID_KEEP_JAR_CONTENT" description:"Keep only the entries matching the glob or regex in Jar file, the inverse of --android-remove-jar-content" required:"false"`
+	StripUnityClasses         bool     `long:"strip-unity-classes" env:"UPACK_STRIP_UNITY_CLASSES" description:"Remove the Unity player classes (com/unity3d/player, bitter/jnibridge, org/fmod) from Jar file"`
+	StripSignatures           bool     `long:"strip-signatures" env:"UPACK_STRIP_SIGNATURES" description:"Remove META-INF signature files and .kotlin_module metadata from Jar file"`
+	MergeJars                 bool     `long:"merge-jars" env:"UPACK_MERGE_JARS" description:"Merge classes.jar and the jars under libs of the AAR into a single classes.jar"`
+	MergeDuplicates           string   `long:"merge-duplicates" env:"UPACK_MERGE_DUPLICATES" description:"How to handle entries provided by more than one jar when merging jars, the first one is kept" choice:"warn" choice:"skip" choice:"error" default:"warn"`
+	Relocations               []string `long:"relocate" env:"UPACK_RELOCATIONS" description:"Relocate the classes of a package in Jar file in from=to form, e.g. com.google.gson=shaded.com.google.gson" required:"false"`
+	R8Rules                   []string `long:"r8-rules" env:"UPACK_R8_RULES" description:"ProGuard rules file, minify classes.jar with R8 from the Android SDK when given" required:"false"`
+	R8Jar                     string   `long:"r8-jar" env:"UPACK_R8_JAR" description:"Jar providing R8, the one of the newest Android SDK build tools by default" required:"false"`
+	AndroidSdk                string   `long:"android-sdk" env:"UPACK_ANDROID_SDK" description:"Android SDK directory, ANDROID_HOME or ANDROID_SDK_ROOT by default, written into local.properties of the Android project when given" required:"false"`
+	AndroidNdk                string   `long:"android-ndk" env:"UPACK_ANDROID_NDK" description:"Android NDK directory written into local.properties of the Android project" required:"false"`
+	ProguardUserRules         bool     `long:"proguard-user-rules" env:"UPACK_PROGUARD_USER_RULES" description:"Merge the consumer ProGuard rules of the AAR into proguard-user.txt of the Unity project"`
+	Abis                      []string `long:"abi" env:"UPACK_ABIS" env-delim:"," description:"Include only the native libraries of the ABIs, e.g. arm64-v8a,armeabi-v7a" required:"false"`
+	SplitAbi                  bool     `long:"split-abi" env:"UPACK_SPLIT_ABI" description:"Move the native libraries into one AAR per ABI next to the plugin, restricted to that CPU in their .meta files"`
+	ResKeepLocales            []string `long:"res-keep-locales" env:"UPACK_RES_KEEP_LOCALES" env-delim:"," description:"Keep only the resources of the locales like Gradle resConfigs, e.g. en,zh" required:"false"`
+	StripUnusedResources      bool     `long:"strip-unused-resources" env:"UPACK_STRIP_UNUSED_RESOURCES" description:"Remove the resource files never referenced by the classes or the manifests, the dropped ones are reported in build/upack of the module"`
+	Aapt2Check                bool     `long:"aapt2-check" env:"UPACK_AAPT2_CHECK" description:"Compile and link the repackaged resources and manifest with aapt2 from the Android SDK"`
+	StripNative               bool     `long:"strip-native" env:"UPACK_STRIP_NATIVE" description:"Strip debug symbols from the native libraries, unstripped copies are kept in the native symbols directory"`
+	StripTool                 string   `long:"strip-tool" env:"UPACK_STRIP_TOOL" description:"Tool stripping native libraries, llvm-strip of the newest NDK or on PATH by default" required:"false"`
+	NativeSymbolsDir          string   `long:"native-symbols-dir" env:"UPACK_NATIVE_SYMBOLS_DIR" description:"Directory keeping the unstripped native libraries, build/upack/symbols of the module by default" required:"false"`
+	ConfigFile                string   `short:"c" long:"config" env:"UPACK_CONFIG" description:"YAML config file path" required:"false"`
+	AndroidManifestTemplate   string   `short:"T" long:"manifest-template" env:"UPACK_MANIFEST_TEMPLATE" description:"Android manifest template file path or URL" required:"false"`
+	TemplateCacheDir          string   `long:"template-cache-dir" env:"UPACK_TEMPLATE_CACHE_DIR" description:"Directory caching templates downloaded from URLs" required:"false"`
+	ManifestServices          []string `long:"manifest-service" env:"UPACK_MANIFEST_SERVICES" description:"Full name of a service declared in Android manifest" required:"false"`
+	ManifestReceivers         []string `long:"manifest-receiver" env:"UPACK_MANIFEST_RECEIVERS" description:"Full name of a broadcast receiver declared in Android manifest" required:"false"`
+	ManifestProviders         []string `long:"manifest-provider" env:"UPACK_MANIFEST_PROVIDERS" description:"Content provider declared in Android manifest in name=authorities form" required:"false"`
+	ManifestMeta              []string `long:"manifest-meta" env:"UPACK_MANIFEST_META" description:"Application meta-data declared in Android manifest in key=value form" required:"false"`
+	IntentFilters             []string `long:"intent-filter" env:"UPACK_INTENT_FILTERS" description:"Extra intent filter like action=...,category=...,scheme=..., an activity=... item puts it on another activity" required:"false"`
+	MinSdkVersion             int      `long:"min-sdk" env:"UPACK_MIN_SDK" description:"minSdkVersion declared in Android manifest"`
+	TargetSdkVersion          int      `long:"target-sdk" env:"UPACK_TARGET_SDK" description:"targetSdkVersion declared in Android manifest"`
+	VersionCode               int      `long:"version-code" env:"UPACK_VERSION_CODE" description:"versionCode declared in Android manifest"`
+	VersionName               string   `long:"version-name" env:"UPACK_VERSION_NAME" description:"versionName declared in Android manifest" required:"false"`
+	AutoBump                  bool     `long:"auto-bump" env:"UPACK_AUTO_BUMP" description:"Increase the versionCode of the previously generated Android manifest"`
+	VersionFrom               string   `long:"version-from" env:"UPACK_VERSION_FROM" description:"Derive the version from git describe or CI environment variables and embed a build info file" choice:"git" choice:"ci"`
+	TemplateVars              []string `short:"D" long:"var" env:"UPACK_VARS" description:"User defined template variable in key=value form, used as {{.Vars.key}} in templates" required:"false"`
+	TemplateStrict            bool     `long:"template-strict" env:"UPACK_TEMPLATE_STRICT" description:"Fail on template references to unknown fields or variables"`
+	FailOnWarning             bool     `long:"fail-on-warning" env:"UPACK_FAIL_ON_WARNING" description:"Fail the run and leave the outputs untouched if anything was warned about, e.g. manifest lint findings or duplicate dependencies"`
+	ManifestPreset            string   `long:"manifest-preset" env:"UPACK_MANIFEST_PRESET" description:"Built-in Android manifest template used when no template file is given" choice:"debug" choice:"release" default:"debug"`
+	Copies                    []string `long:"copy" env:"UPACK_COPIES" description:"Extra file or directory copied into the plugin directory in src:dst form, dst is relative to the plugin directory" required:"false"`
+	IgnoreFile                string   `long:"ignore-file" env:"UPACK_IGNORE_FILE" description:"gitignore-style file filtering the extracted AAR entries and the repackaged jar entries, .upackignore in the module directory by default" required:"false"`
+	BackupExtension           string   `short:"B" long:"backup-extension" env:"UPACK_BACKUP_EXTENSION" description:"Keep the original files with the given ext name" required:"false"`
+	BackupTimestamp           bool     `long:"backup-timestamp" env:"UPACK_BACKUP_TIMESTAMP" description:"Put the time of the run before the backup extension, e.g. AndroidManifest.xml.20240101-120300.bak, so earlier backups are kept"`
+	BackupKeep                int      `long:"backup-keep" env:"UPACK_BACKUP_KEEP" description:"Number of timestamped backups kept for each output, older ones are removed, 0 keeps all"`
+	BackupDir                 string   `long:"backup-dir" env:"UPACK_BACKUP_DIR" description:"Directory the backups go to instead of next to the outputs, mirroring their paths relative to the Unity project" required:"false"`
+	OutputFormat              string   `short:"f" long:"output-format" env:"UPACK_OUTPUT_FORMAT" description:"Layout of the generated plugin, auto picks one by the Unity version" choice:"auto" choice:"library" choice:"upm" choice:"aar" choice:"androidlib" choice:"srcaar" default:"auto"`
+	GradleDependencies        []string `long:"gradle-dependency" env:"UPACK_GRADLE_DEPENDENCIES" description:"Maven dependency inserted into mainTemplate.gradle of the Unity project" required:"false"`
+	GradleRepositories        []string `long:"gradle-repository" env:"UPACK_GRADLE_REPOSITORIES" description:"Maven repository URL inserted into mainTemplate.gradle of the Unity project and the generated EDM dependencies" required:"false"`
+	GradleProperties          []string `long:"gradle-property" env:"UPACK_GRADLE_PROPERTIES" description:"Property in key=value form set in gradleTemplate.properties of the Unity project" required:"false"`
+	AndroidX                  bool     `long:"androidx" env:"UPACK_ANDROIDX" description:"Enable AndroidX and Jetifier in gradleTemplate.properties of the Unity project"`
+	LauncherDependencies      []string `long:"launcher-dependency" env:"UPACK_LAUNCHER_DEPENDENCIES" description:"Maven dependency inserted into launcherTemplate.gradle of the Unity project" required:"false"`
+	BaseProjectClasspath      []string `long:"base-project-classpath" env:"UPACK_BASE_PROJECT_CLASSPATH" description:"Build script classpath entry inserted into baseProjectTemplate.gradle of the Unity project" required:"false"`
+	EdmDependencies           bool     `long:"edm-dependencies" env:"UPACK_EDM_DEPENDENCIES" description:"Generate External Dependency Manager Dependencies.xml from the module build.gradle"`
+	ResolveDependencies       bool     `long:"resolve-dependencies" env:"UPACK_RESOLVE_DEPENDENCIES" description:"Download the transitive Maven dependencies of the module and copy them next to the plugin"`
+	DependencyConfiguration   string   `long:"dependency-configuration" env:"UPACK_DEPENDENCY_CONFIGURATION" description:"Gradle configuration whose artifacts are copied when resolving dependencies" default:"debugRuntimeClasspath"`
+	MavenGroup                string   `long:"maven-group" env:"UPACK_MAVEN_GROUP" description:"Maven group id when output format is srcaar, derived from entry activity by default" required:"false"`
+	MavenVersion              string   `long:"maven-version" env:"UPACK_MAVEN_VERSION" description:"Maven version when output format is srcaar" default:"1.0.0"`
+	Dedup                     string   `long:"dedup" env:"UPACK_DEDUP" description:"How to handle resolved dependencies already provided by the Unity project" choice:"off" choice:"warn" choice:"skip" choice:"error" default:"warn"`
+	DuplicateClasses          string   `long:"duplicate-classes" env:"UPACK_DUPLICATE_CLASSES" description:"How to handle classes defined by more than one Android plugin in the Unity project" choice:"off" choice:"warn" choice:"error" default:"warn"`
+	ResourceConflicts         string   `long:"resource-conflicts" env:"UPACK_RESOURCE_CONFLICTS" description:"How to handle resource names also defined by other Android plugins in the Unity project" choice:"off" choice:"warn" choice:"error" default:"warn"`
+	ResourcePrefix            string   `long:"resource-prefix" env:"UPACK_RESOURCE_PREFIX" description:"Require every resource name of the module to start with the prefix" required:"false"`
+	ManifestLint              []string `long:"manifest-lint" env:"UPACK_MANIFEST_LINT" description:"Severity of a manifest lint rule in rule=off|warning|error form, rules are debuggable, missing-exported and install-location" required:"false"`
+	UnityVersion              string   `long:"unity-version" env:"UPACK_UNITY_VERSION" description:"Unity version used to pick the output format, detected from the Unity project by default" required:"false"`
+	UpmPackageName            string   `long:"upm-name" env:"UPACK_UPM_NAME" description:"Package name when output format is upm, derived from entry activity by default" required:"false"`
+	UpmPackageVersion         string   `long:"upm-version" env:"UPACK_UPM_VERSION" description:"Package version when output format is upm" default:"1.0.0"`
+	UpmDisplayName            string   `long:"upm-display-name" env:"UPACK_UPM_DISPLAY_NAME" description:"Package display name when output format is upm" required:"false"`
+	Remote                    string   `long:"remote" env:"UPACK_REMOTE" description:"Build the Android project over SSH on a remote machine in user@host:/path form and pull the AAR back" required:"false"`
+	DockerImage               string   `long:"docker-image" env:"UPACK_DOCKER_IMAGE" description:"Build the Android project inside a container of the image, which provides the JDK and Android SDK" required:"false"`
+	JavaHome                  string   `long:"java-home" env:"UPACK_JAVA_HOME" description:"JDK the Android project is built with, checked against the Android Gradle Plugin version of the project" required:"false"`
+	BootstrapGradle           string   `long:"bootstrap-gradle" env:"UPACK_BOOTSTRAP_GRADLE" description:"Generate a Gradle wrapper of the version if the Android project has none, the download is verified with the published checksums" required:"false"`
+	GradleBuildProps          []string `long:"gradle-prop" env:"UPACK_GRADLE_PROPS" env-delim:"," description:"Project property in key=value form passed to the Gradle build as -Pkey=value" required:"false"`
+	GradleOffline             bool     `long:"offline" env:"UPACK_OFFLINE" description:"Run Gradle with --offline"`
+	GradleNoDaemon            bool     `long:"no-daemon" env:"UPACK_NO_DAEMON" description:"Run Gradle with --no-daemon"`
+	GradleBuildCache          bool     `long:"build-cache" env:"UPACK_BUILD_CACHE" description:"Run Gradle with --build-cache"`
+	NoCache                   bool     `long:"no-cache" env:"UPACK_NO_CACHE" description:"Always run the Gradle build, even if the Android project is unchanged since the last build"`
+	Jobs                      int      `short:"j" long:"jobs" env:"UPACK_JOBS" description:"Number of output directories processed concurrently, the number of CPUs by default"`
+	UnityMeta                 bool     `short:"M" long:"unity-meta" env:"UPACK_UNITY_META" description:"Generate Unity .meta files with stable GUIDs for the outputs"`
+	DryRun                    bool     `long:"dry-run" env:"UPACK_DRY_RUN" description:"Print what would be built, written, backed up and deleted without touching anything"`
+	SizeReport                bool     `long:"size-report" env:"UPACK_SIZE_REPORT" description:"Print the size of the packed plugin by classes, resources and native libraries of each ABI, with its biggest entries"`
+	SummaryFile               string   `long:"summary-file" env:"UPACK_SUMMARY_FILE" description:"Write a JSON summary of the run to the file: the result, artifact paths and hashes, removed jar entries, warnings and timings"`
+	JUnitReport               string   `long:"junit-report" env:"UPACK_JUNIT_REPORT" description:"Write a JUnit XML report to the file with the validation, the build and the packing of each output directory as test cases"`
+	GithubAnnotations         bool     `long:"github-annotations" env:"UPACK_GITHUB_ANNOTATIONS" description:"Print the manifest and template findings as GitHub Actions workflow commands, which show up inline on pull requests"`
+	NotifyURL                 string   `long:"notify-url" env:"UPACK_NOTIFY_URL" description:"POST a JSON payload with the result of the run to the URL when it ends, e.g. a Slack incoming webhook"`
+
+	// run control
+	Timeout    time.Duration `long:"timeout" env:"UPACK_TIMEOUT" description:"Stop the run, including the Gradle build, if it takes longer, e.g. 15m"`
+	Retries    int           `long:"retries" env:"UPACK_RETRIES" description:"Run the Gradle build, the dependency resolution and the Gradle download again up to N times when they fail"`
+	RetryDelay time.Duration `long:"retry-delay" env:"UPACK_RETRY_DELAY" description:"Wait before the first retry, doubled for each further retry" default:"5s"`
+
+	// watch mode
+	Watch         bool          `long:"watch" env:"UPACK_WATCH" description:"Keep running and pack the plugin again whenever the Android sources change"`
+	WatchInterval time.Duration `long:"watch-interval" env:"UPACK_WATCH_INTERVAL" description:"How often the Android sources are checked for changes in watch mode" default:"1s"`
+	WatchDebounce time.Duration `long:"watch-debounce" env:"UPACK_WATCH_DEBOUNCE" description:"How long the Android sources have to stay unchanged before packing in watch mode" default:"500ms"`
+}
+
+var opts Options
+
+func (o *Options) moduleDir() string {
+	return filepath.Join(o.AndroidProjectPath, o.AndroidModuleName)
+}
+
+func (o *Options) moduleAarDir() string {
+	return filepath.Join(o.moduleDir(), "build", "outputs", "aar")
+}
+
+func (o *Options) moduleAarFile() string {
+	if prebuiltAar != "" {
+		return prebuiltAar
+	}
+	return filepath.Join(o.moduleAarDir(), fmt.Sprintf("%s-%s.aar", o.AndroidModuleName, "debug"))
+}
+
+type keyValue struct {
+	Key   string
+	Value string
+}
+
+// parseKeyValues parses the key=value pairs given by the option with name.
+func parseKeyValues(name string, pairs []string) ([]keyValue, error) {
+	kvs := make([]keyValue, 0, len(pairs))
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("illegal %s %s, key=value expected", name, p)
+		}
+		kvs = append(kvs, keyValue{Key: kv[0], Value: kv[1]})
+	}
+	return kvs, nil
+}
+
+// ManifestProviderList is used by manifest templates, providers are given in
+// name=authorities form.
+func (o *Options) ManifestProviderList() ([]keyValue, error) {
+	return parseKeyValues("manifest provider", o.ManifestProviders)
+}
+
+// ManifestMetaList is used by manifest templates.
+func (o *Options) ManifestMetaList() ([]keyValue, error) {
+	return parseKeyValues("manifest meta-data", o.ManifestMeta)
+}
+
+// Vars is used by templates, it returns the user defined variables, the ones
+// given by flags override the ones in the config file.
+func (o *Options) Vars() (map[string]string, error) {
+	vars := make(map[string]string, len(conf.Vars)+len(o.TemplateVars))
+	for k, v := range conf.Vars {
+		vars[k] = v
+	}
+	kvs, err := parseKeyValues("template variable", o.TemplateVars)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range kvs {
+		vars[kv.Key] = kv.Value
+	}
+	return vars, nil
+}
+
+func setAbsPath(tag string, path *string) error {
+	newPath, err := filepath.Abs(*path)
+	if err != nil {
+		return fmt.Errorf("illegal %s path %s: %w", tag, *path, err)
+	}
+	*path = newPath
+	return nil
+}
+
+func checkFileExist(path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("not a file %s", path)
+	}
+	return nil
+}
+
+func checkDirExist(path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("not a directory %s", path)
+	}
+	return nil
+}
+
+// runCommandAt runs the command in the directory path, the working
+// directory of the process is left untouched. A relative command path like
+// ./gradlew is resolved against path to an absolute one, which also lets the
+// .bat extension of the wrapper be found on Windows.
+func runCommandAt(path string, cmdName string, args ...string) error {
+	if !filepath.IsAbs(cmdName) && strings.ContainsAny(cmdName, `/\`) {
+		abs, err := filepath.Abs(filepath.Join(path, cmdName))
+		if err != nil {
+			return err
+		}
+		cmdName = abs
+	}
+	cmd := exec.Command(cmdName, args...)
+	cmd.Dir = path
+	stdout, stderr := newLogWriter(filepath.Base(cmdName), levelDebug), newLogWriter(filepath.Base(cmdName), levelInfo)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	defer stderr.Flush()
+	defer stdout.Flush()
+	return runCmd(cmd)
+}
+
+// gradleNoDaemon tells whether Gradle runs without its daemon. It does with
+// --timeout, stopping the process group of a timed out build would leave a
+// daemon started earlier running it, while the daemons other builds use are
+// not to be stopped.
+func gradleNoDaemon() bool {
+	return opts.GradleNoDaemon || opts.Timeout > 0
+}
+
+// gradleArgs prepends the Gradle switches selected by the options to args.
+func gradleArgs(args ...string) []string {
+	var switches []string
+	if opts.GradleOffline {
+		switches = append(switches, "--offline")
+	}
+	if gradleNoDaemon() {
+		switches = append(switches, "--no-daemon")
+	}
+	if opts.GradleBuildCache {
+		switches = append(switches, "--build-cache")
+	}
+	for _, p := range opts.GradleBuildProps {
+		switches = append(switches, "-P"+p)
+	}
+	return append(switches, args...)
+}
+
+func buildAndroid(path string) error {
+	p := startProgress("building Android project", 0)
+	defer p.finish()
+	return withRetries("build Android project", func() error {
+		if remote != nil {
+			return buildAndroidRemote(path, remote)
+		}
+		if opts.DockerImage != "" {
+			return buildAndroidDocker(path, opts.DockerImage)
+		}
+		if err := runGradleAt(path, gradleCommand(path), gradleArgs("assembleDebug")...); err != nil {
+			return fmt.Errorf("build Android project fail %w", err)
+		}
+		return nil
+	})
+}
+
+func makeDir(path string, deleteOrigin bool) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return os.MkdirAll(path, os.ModePerm)
+		}
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("%s existed and not a directory", path)
+	}
+	if !deleteOrigin {
+		return nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("fail to delete origin directory at %s", path)
+	}
+	return os.Mkdir(path, os.ModePerm)
+}
+
+func backupAndWriteFile(path string, content []byte, backupExt string) error {
+	if dirsync.SameFileContent(path, content) {
+		logTrace("%s is up to date", path)
+		return nil
+	}
+	if err := removeOrBackup(path, backupExt); err != nil {
+		return err
+	}
+	return dirsync.WriteFileAtomic(path, content, 0644)
+}
+
+func addPropertiesFile(dir string, backupExt string) error {
+	path := filepath.Join(dir, "project.properties")
+	return backupAndWriteFile(path, []byte("android.library=true"), backupExt)
+}
+
+const defaultManifestTemplate string = `<?xml version="1.0" encoding="utf-8"?>
+<manifest
+    xmlns:android="http://schemas.android.com/apk/res/android"
+    package="com.unity3d.player"
+    android:installLocation="preferExternal"
+    android:versionCode="{{or .VersionCode 1}}"
+    android:versionName="{{or .VersionName "1.0"}}">
+    <supports-screens
+        android:smallScreens="true"
+        android:normalScreens="true"
+        android:largeScreens="true"
+        android:xlargeScreens="true"
+        android:anyDensity="true"/>
+{{- if or .MinSdkVersion .TargetSdkVersion}}
+    <uses-sdk
+{{- if .MinSdkVersion}} android:minSdkVersion="{{.MinSdkVersion}}"{{end}}
+{{- if .TargetSdkVersion}} android:targetSdkVersion="{{.TargetSdkVersion}}"{{end}} />
+{{- end}}
+{{range .AndroidPermissions}}
+    <uses-permission android:name="{{.}}" />
+{{- end}}
+
+    <application
+        android:theme="@style/UnityThemeSelector"
+        android:icon="@drawable/app_icon"
+        android:label="@string/app_name"
+{{range .AndroidActivityAttributes}}
+        {{.}}
+{{- end}}
+        android:debuggable="true">
+        <activity android:name="{{.AndroidEntryActivity}}"
+                  android:label="@string/app_name"
+                  android:exported="true">
+            <intent-filter>
+                <action android:name="android.intent.action.MAIN" />
+                <category android:name="android.intent.category.LAUNCHER" />
+            </intent-filter>
+            <meta-data android:name="unityplayer.UnityActivity" android:value="true" />
+{{- range .EntryIntentFilters}}{{template "intentFilter" .}}{{end}}
+        </activity>
+{{- range .ExtraActivities}}
+        <activity android:name="{{.Name}}" android:exported="true">
+{{- range .IntentFilters}}{{template "intentFilter" .}}{{end}}
+        </activity>
+{{- end}}
+{{- range .ManifestServices}}
+        <service android:name="{{.}}" android:exported="false" />
+{{- end}}
+{{- range .ManifestReceivers}}
+        <receiver android:name="{{.}}" android:exported="false" />
+{{- end}}
+{{- range .ManifestProviderList}}
+        <provider android:name="{{.Key}}" android:authorities="{{.Value}}" android:exported="false" />
+{{- end}}
+{{- range .ManifestMetaList}}
+        <meta-data android:name="{{.Key}}" android:value="{{.Value}}" />
+{{- end}}
+    </application>
+</manifest>`
+
+// releaseManifestTemplate is the default template for production builds, it
+// is not debuggable and leaves the version to the Unity player settings.
+const releaseManifestTemplate string = `<?xml version="1.0" encoding="utf-8"?>
+<manifest
+    xmlns:android="http://schemas.android.com/apk/res/android"
+{{- if .VersionCode}}
+    android:versionCode="{{.VersionCode}}"
+{{- end}}
+{{- if .VersionName}}
+    android:versionName="{{.VersionName}}"
+{{- end}}
+    package="com.unity3d.player">
+    <supports-screens
+        android:smallScreens="true"
+        android:normalScreens="true"
+        android:largeScreens="true"
+        android:xlargeScreens="true"
+        android:anyDensity="true"/>
+{{- if or .MinSdkVersion .TargetSdkVersion}}
+    <uses-sdk
+{{- if .MinSdkVersion}} android:minSdkVersion="{{.MinSdkVersion}}"{{end}}
+{{- if .TargetSdkVersion}} android:targetSdkVersion="{{.TargetSdkVersion}}"{{end}} />
+{{- end}}
+{{range .AndroidPermissions}}
+    <uses-permission android:name="{{.}}" />
+{{- end}}
+
+    <application
+        android:theme="@style/UnityThemeSelector"
+        android:icon="@drawable/app_icon"
+{{range .AndroidActivityAttributes}}
+        {{.}}
+{{- end}}
+        android:label="@string/app_name">
+        <activity android:name="{{.AndroidEntryActivity}}"
+                  android:label="@string/app_name"
+                  android:exported="true">
+            <intent-filter>
+                <action android:name="android.intent.action.MAIN" />
+                <category android:name="android.intent.category.LAUNCHER" />
+            </intent-filter>
+            <meta-data android:name="unityplayer.UnityActivity" android:value="true" />
+{{- range .EntryIntentFilters}}{{template "intentFilter" .}}{{end}}
+        </activity>
+{{- range .ExtraActivities}}
+        <activity android:name="{{.Name}}" android:exported="true">
+{{- range .IntentFilters}}{{template "intentFilter" .}}{{end}}
+        </activity>
+{{- end}}
+{{- range .ManifestServices}}
+        <service android:name="{{.}}" android:exported="false" />
+{{- end}}
+{{- range .ManifestReceivers}}
+        <receiver android:name="{{.}}" android:exported="false" />
+{{- end}}
+{{- range .ManifestProviderList}}
+        <provider android:name="{{.Key}}" android:authorities="{{.Value}}" android:exported="false" />
+{{- end}}
+{{- range .ManifestMetaList}}
+        <meta-data android:name="{{.Key}}" android:value="{{.Value}}" />
+{{- end}}
+    </application>
+</manifest>`
+
+var manifestPresets = map[string]string{
+	"debug":   defaultManifestTemplate,
+	"release": releaseManifestTemplate,
+}
+
+func loadManifestTemplateContent(path, preset string) (string, error) {
+	if path == "" {
+		content, ok := manifestPresets[preset]
+		if !ok {
+			return "", fmt.Errorf("unknown manifest preset %s", preset)
+		}
+		return content, nil
+	}
+	return loadTemplateContent(path)
+}
+
+func loadTemplateContent(path string) (string, error) {
+	if isURL(path) {
+		return fetchTemplate(path)
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func loadManifestTemplate(path, preset string, permissions []string) (*template.Template, error) {
+	content, err := loadManifestTemplateContent(path, preset)
+	if err != nil {
+		return nil, err
+	}
+	name := "Manifest:" + preset
+	if path != "" {
+		name = "Manifest:" + path
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs(permissions)).Parse(manifestPartials)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(content)
+}
+
+func addAndroidManifestFile(dir string, content []byte, backupExt string) error {
+	path := filepath.Join(dir, "AndroidManifest.xml")
+	return backupAndWriteFile(path, content, backupExt)
+}
+
+// logIgnored wraps keep to log the entries it drops while action.
+func logIgnored(action string, keep aar.Filter) aar.Filter {
+	return func(path string, isDir bool) bool {
+		if !keep(path, isDir) {
+			logDebug("ignore %s when %s", path, action)
+			return false
+		}
+		return true
+	}
+}
+
+// zipDir zips srcDir to dstFile, entries found in methods are compressed
+// with the given method and others are deflated.
+func zipDir(srcDir, dstFile string, needZip func(string, bool) bool, methods map[string]uint16) error {
+	defer timePhase("re-zip")()
+	logDebug("zipping dir %s to %s", srcDir, dstFile)
+	return dirsync.WriteAtomic(dstFile, 0644, func(out io.Writer) error {
+		return aar.Zip(out, srcDir, logIgnored("zipping", needZip), methods)
+	})
+}
+
+func unzipFile(srcFile, dstDir string, needUnzip func(string, bool) bool) error {
+	defer timePhase("unzip")()
+	archive, err := zip.OpenReader(srcFile)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	p := startProgress("extracting "+filepath.Base(srcFile), aar.UncompressedSize(&archive.Reader))
+	defer p.finish()
+	logTrace("unzipping %s to %s ...", srcFile, dstDir)
+	return aar.Extract(&archive.Reader, dstDir, logIgnored("unzipping", needUnzip), p.add)
+}
+
+// removeOrBackup clears path for the output about to be written, what it
+// had is kept with backupExt if given and put back if the run fails.
+func removeOrBackup(path string, backupExt string) error {
+	if len(backupExt) == 0 || changedInRun(path) {
+		if err := saveOriginal(path); err != nil {
+			return fmt.Errorf("delete %s: %w", path, err)
+		}
+		return nil
+	}
+	if !pathExists(path) {
+		recordChange(path, "")
+		return nil
+	}
+	bpath := backupPath(path, backupExt)
+	// the backup of an earlier run is put back if this one fails
+	if err := saveOriginal(bpath); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	if err := makeDir(filepath.Dir(bpath), false); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	if err := movePath(path, bpath); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	recordChange(path, bpath)
+	return pruneBackups(path, backupExt)
+}
+
+func cleanAndUnzipFile(srcFile, dstDir string, backupExt string, fileFilter func(string, bool) bool) error {
+	if err := removeOrBackup(dstDir, backupExt); err != nil {
+		return err
+	}
+	// extracted next to dstDir and renamed, so it is never seen half done
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dstDir), dirsync.TempSiblingPattern(dstDir))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := unzipFile(srcFile, tmpDir, fileFilter); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dstDir)
+}
+
+func cleanAndZipDir(srcDir, dstFile string, backupExt string, fileFilter func(string, bool) bool) error {
+	if err := removeOrBackup(dstFile, backupExt); err != nil {
+		return err
+	}
+	return zipDir(srcDir, dstFile, fileFilter, nil)
+}
+
+// keepAarEntry tells whether an entry of the built AAR is kept.
+func keepAarEntry(path string, isDir bool) bool {
+	if !keepAbi(path) || !keepLocale(path) || (opts.SplitAbi && keepSplitEntry(path, isDir)) {
+		return false
+	}
+	return !ignores.match(path, isDir)
+}
+
+// filterJarEnabled tells whether jars are repackaged with some entries
+// filtered out.
+func filterJarEnabled() bool {
+	return ignores != nil || jarRemovals != nil || jarKeeps != nil || len(relocations) > 0
+}
+
+// keepJarEntry tells whether an entry of a jar in the AAR is kept when the
+// jar is repackaged.
+func keepJarEntry(path string, isDir bool) bool {
+	if ignores.match(path, isDir) {
+		return false
+	}
+	if jarRemovals.match(path, isDir) {
+		return false
+	}
+	// directories are walked anyway, only files are checked by the allowlist
+	return isDir || jarKeeps == nil || jarKeeps.match(path, isDir)
+}
+
+// copyJarEntry copies an entry of a jar into w with the same header,
+// relocating it when requested.
+func copyJarEntry(w *zip.Writer, f *zip.File) error {
+	header := f.FileHeader
+	if len(relocations) > 0 {
+		header.Name = relocatePath(f.Name, relocations)
+		if header.Name != f.Name {
+			logTrace("relocating %s to %s", f.Name, header.Name)
+		}
+	}
+	out, err := w.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+
+	if needRelocate(f.Name) {
+		content, err := aar.ReadEntry(f)
+		if err != nil {
+			return err
+		}
+		if content, err = relocateEntry(f.Name, content); err != nil {
+			return err
+		}
+		_, err = out.Write(content)
+		return err
+	}
+
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// filterJar removes the unwanted entries from jarFile, the kept entries are
+// copied from the jar to a new one directly.
+func filterJar(jarFile string) error {
+	logTrace("start removing unity libs in %s ...", jarFile)
+	r, err := zip.OpenReader(jarFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.CreateTemp("", "upack-*.jar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	for _, f := range r.File {
+		isDir := f.FileInfo().IsDir()
+		if !keepJarEntry(f.Name, isDir) {
+			logDebug("ignore %s when filtering %s", f.Name, filepath.Base(jarFile))
+			if !isDir {
+				recordRemovedJarEntry(jarFile, f.Name)
+			}
+			continue
+		}
+		if isDir {
+			// directories are implied by the paths of the kept entries
+			continue
+		}
+		if err := copyJarEntry(w, f); err != nil {
+			w.Close()
+			return fmt.Errorf("filter %s: %w", jarFile, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	r.Close()
+	return replaceFile(out.Name(), jarFile, fileMode(jarFile))
+}
+
+// filterJarContent removes the unwanted entries from classes.jar and the jars
+// under libs of the extracted AAR in plugDir.
+func filterJarContent(plugDir string) error {
+	if !filterJarEnabled() {
+		return nil
+	}
+	defer timePhase("jar filtering")()
+
+	jarFiles, err := filepath.Glob(filepath.Join(plugDir, "libs", "*.jar"))
+	if err != nil {
+		return err
+	}
+	jarFile := filepath.Join(plugDir, "classes.jar")
+	if err := checkFileExist(jarFile); err == nil {
+		jarFiles = append([]string{jarFile}, jarFiles...)
+	}
+	for _, f := range jarFiles {
+		if err := filterJar(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processAarEnabled tells whether the built AAR is transformed rather than
+// used as is.
+func processAarEnabled() bool {
+	if !conf.stageEnabled(stageFilter) {
+		return false
+	}
+	return filterJarEnabled() || opts.MergeJars || len(opts.R8Rules) > 0 || opts.StripNative || len(opts.Abis) > 0 || opts.SplitAbi ||
+		len(opts.ResKeepLocales) > 0 || opts.StripUnusedResources || opts.Aapt2Check
+}
+
+// processAar applies the requested transformations to the AAR extracted to
+// dir.
+func processAar(dir string) error {
+	if err := filterJarContent(dir); err != nil {
+		return err
+	}
+	if opts.MergeJars {
+		if err := mergeJars(dir); err != nil {
+			return err
+		}
+	}
+	if err := minifyJar(dir); err != nil {
+		return err
+	}
+	if err := stripUnusedResources(dir); err != nil {
+		return err
+	}
+	if err := checkAapt2(dir); err != nil {
+		return err
+	}
+	return stripNativeLibs(dir)
+}
+
+// stagePlugin extracts the built AAR under tmpDir as the Android library
+// project going to plugDir of the output directory baseDir and runs the
+// pipeline stages up to the sync on it, layout rearranges the extracted files
+// if it is not nil. The directory holding the staged plugin is returned.
+func stagePlugin(tmpDir, format, baseDir, plugDir string, layout func(dir string) error) (string, error) {
+	logTrace("start unzipping aar to %s ...", tmpDir)
+	extractDir := filepath.Join(tmpDir, filepath.Base(plugDir))
+	if err := unzipFile(opts.moduleAarFile(), extractDir, keepAarEntry); err != nil {
+		return "", err
+	}
+	env := []string{"UPACK_STAGE_DIR=" + extractDir, "UPACK_PLUGIN_DIR=" + plugDir}
+	err := runStages(conf.stagesBetween(stageExtract, stageSync), env, func(name string) error {
+		switch name {
+		case stageFilter:
+			return processAar(extractDir)
+		case stageGenerate:
+			return generatePlugin(extractDir, format, baseDir, plugDir, layout)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return extractDir, nil
+}
+
+// generatePlugin lays out the plugin extracted to dir for plugDir and
+// writes the files it needs besides the AAR content, unless the config file
+// declares them for the output directory baseDir.
+func generatePlugin(dir, format, baseDir, plugDir string, layout func(dir string) error) error {
+	if layout != nil {
+		if err := layout(dir); err != nil {
+			return err
+		}
+	}
+	if !conf.hasFile(format, baseDir, filepath.Join(plugDir, "project.properties")) {
+		logTrace("start generating properties file at %s ...", dir)
+		if err := addPropertiesFile(dir, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractPlugin extracts the built AAR into plugDir of the output directory
+// baseDir as an Android library project, layout rearranges the extracted
+// files before they are synced into plugDir if it is not nil. The staged
+// plugin is checked for duplicate classes with the archives in extras going
+// into baseDir too.
+func extractPlugin(format, baseDir, plugDir string, layout func(dir string) error, extras map[string]string) error {
+	tmpDir, err := os.MkdirTemp("", "upack-plugin")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	extractDir, err := stagePlugin(tmpDir, format, baseDir, plugDir, layout)
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicateClasses(format, baseDir, stagedWith(extras, extractDir, plugDir)); err != nil {
+		return err
+	}
+
+	logDebug("Android plugin output directory at: %s", plugDir)
+	if err := makeDir(filepath.Dir(plugDir), false); err != nil {
+		return err
+	}
+	return syncDir(extractDir, plugDir, opts.BackupExtension)
+}
+
+func (o *Options) libraryPluginDir(baseDir string) string {
+	return filepath.Join(baseDir, o.AndroidModuleName)
+}
+
+// packLibrary extracts the built AAR into libDir of the output directory
+// baseDir as an Android library project and writes the Android manifest next
+// to it.
+func packLibrary(format, baseDir, libDir string, manifest []byte, extras map[string]string) error {
+	if err := extractPlugin(format, baseDir, opts.libraryPluginDir(libDir), nil, extras); err != nil {
+		return err
+	}
+
+	logTrace("start generating Android manifest file to %s ...", libDir)
+	if err := addAndroidManifestFile(libDir, manifest, opts.BackupExtension); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildResult holds everything produced before packing the plugin into
+// output directories.
+type buildResult struct {
+	Manifests    map[string][]byte
+	Files        map[string][]renderedFile
+	Copies       map[string][]copySpec
+	Dependencies []resolvedDependency
+	// AbiAars are the per-ABI AARs split from the built AAR.
+	AbiAars []string
+	// Fingerprint identifies the build, it is written into every output.
+	Fingerprint *fingerprint
+}
+
+// packTo writes the plugin into baseDir with the layout of the given format.
+func packTo(format, baseDir string, result *buildResult) error {
+	// the dependencies are picked before anything is written, they are checked
+	// for duplicate classes with the staged plugin
+	var deps []resolvedDependency
+	if opts.ResolveDependencies {
+		var err error
+		if deps, err = dedupDependencies(format, baseDir, result.Dependencies); err != nil {
+			return err
+		}
+	}
+	extras := copiedArchives(format, baseDir, deps, result.AbiAars)
+
+	var err error
+	switch format {
+	case formatUpm:
+		err = packUpm(baseDir, result.Manifests[baseDir], extras)
+	case formatAar:
+		err = packAar(baseDir, result.Manifests[baseDir], extras)
+	case formatAndroidLib:
+		err = packAndroidLib(baseDir, result.Manifests[baseDir], extras)
+	case formatSrcAar:
+		err = packSrcAar(baseDir, result.Manifests[baseDir], extras)
+	default:
+		err = packLibrary(format, baseDir, baseDir, result.Manifests[baseDir], extras)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.EdmDependencies {
+		deps, err := loadModuleDependencies()
+		if err != nil {
+			return err
+		}
+		repos := opts.GradleRepositories
+		if format == formatSrcAar {
+			// the plugin itself is resolved from the local repository
+			deps = append([]string{opts.mavenSpec()}, deps...)
+			repos = append([]string{edmRepositoryPath(baseDir)}, repos...)
+		}
+		if err := addEdmDependenciesFile(outputRootDir(format, baseDir), deps, repos, opts.BackupExtension); err != nil {
+			return err
+		}
+	}
+
+	if err := writeRenderedFiles(pluginDir(format, baseDir), result.Files[baseDir]); err != nil {
+		return err
+	}
+	if err := copyAssets(pluginDir(format, baseDir), result.Copies[baseDir]); err != nil {
+		return err
+	}
+	if opts.UnityMeta {
+		paths := append(renderedFilePaths(result.Files[baseDir]), copyDestinations(result.Copies[baseDir])...)
+		if err := addExtraMetaFiles(baseDir, pluginDir(format, baseDir), paths); err != nil {
+			return err
+		}
+	}
+
+	if len(result.AbiAars) > 0 {
+		dir := pluginFilesDir(format, baseDir)
+		if err := copySplitAbiAars(dir, result.AbiAars); err != nil {
+			return err
+		}
+		if opts.UnityMeta {
+			for _, aar := range result.AbiAars {
+				if err := addMetaFiles(baseDir, filepath.Join(dir, filepath.Base(aar))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if info != nil {
+		if err := addBuildInfoFile(outputRootDir(format, baseDir), opts.BackupExtension); err != nil {
+			return err
+		}
+	}
+	if err := removeStaleOutputs(format, baseDir, result); err != nil {
+		return err
+	}
+	fp := *result.Fingerprint
+	fp.Outputs = ownedOutputs(format, baseDir, result)
+	if err := addFingerprintFile(outputRootDir(format, baseDir), &fp, opts.BackupExtension); err != nil {
+		return err
+	}
+	// the fingerprint gets a stable GUID even without --unity-meta, or else
+	// every checkout of the Unity project would give it another one
+	if err := addMetaFiles(baseDir, opts.fingerprintFile(outputRootDir(format, baseDir))); err != nil {
+		return err
+	}
+
+	if opts.ResolveDependencies {
+		depsDir := pluginFilesDir(format, baseDir)
+		logTrace("start copying dependencies to %s ...", depsDir)
+		if err := copyDependencies(depsDir, deps, opts.BackupExtension); err != nil {
+			return err
+		}
+		if opts.UnityMeta {
+			if err := addDependencyMetaFiles(baseDir, depsDir, deps); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.UnityMeta {
+		logTrace("start generating meta files in %s ...", baseDir)
+		return addOutputMetaFiles(format, baseDir)
+	}
+	return nil
+}
+
+// outputRootDir returns the directory holding everything generated for the
+// plugin besides the Android manifest.
+func outputRootDir(format, baseDir string) string {
+	if format == formatUpm {
+		return upmPackageDir(baseDir)
+	}
+	return baseDir
+}
+
+// pluginDir returns the directory holding the plugin itself, extra files
+// declared in the config file are written into it.
+func pluginDir(format, baseDir string) string {
+	switch format {
+	case formatUpm:
+		return upmPackageDir(baseDir)
+	case formatLibrary:
+		return opts.libraryPluginDir(baseDir)
+	case formatAndroidLib:
+		return opts.androidLibPluginDir(baseDir)
+	}
+	return baseDir
+}
+
+// pluginFilesDir returns the directory Unity loads Android plugin files like
+// AAR and JAR from.
+func pluginFilesDir(format, baseDir string) string {
+	if format == formatUpm {
+		return upmPluginDir(upmPackageDir(baseDir))
+	}
+	return baseDir
+}
+
+// buildModuleAar prepares the Android project and builds the AAR of the
+// module, the build is skipped if the sources are unchanged. The hash of the
+// sources is returned.
+func buildModuleAar() (string, error) {
+	if err := patchLocalProperties(opts.AndroidProjectPath); err != nil {
+		return "", err
+	}
+	if opts.BootstrapGradle != "" {
+		if err := bootstrapGradleWrapper(opts.AndroidProjectPath, opts.BootstrapGradle); err != nil {
+			return "", err
+		}
+	}
+	sourceHash, err := buildCacheKey(opts.AndroidProjectPath, opts.AndroidModuleName)
+	if err != nil {
+		return "", fmt.Errorf("hash sources of %s: %w", opts.AndroidProjectPath, err)
+	}
+	logTrace("start building Android project ...")
+	return sourceHash, buildAndroidCached(opts.AndroidProjectPath, sourceHash)
+}
+
+func main1(args []string) (err error) {
+	cancel := startRun()
+	defer cancel()
+	// the version bumped or derived by a run doesn't stick to the next one of
+	// watch and serve
+	defer func(code int, name string) {
+		opts.VersionCode, opts.VersionName = code, name
+	}(opts.VersionCode, opts.VersionName)
+	resetTimings()
+	defer func() {
+		if !opts.DryRun {
+			printTimings()
+		}
+	}()
+	resetSummary()
+	resetRunCases()
+	resetManifestResourceRefs()
+	startStage("validate")
+	defer func() {
+		if opts.JUnitReport == "" || opts.DryRun || diffing {
+			return
+		}
+		failStage(err)
+		if werr := writeJUnitReport(opts.JUnitReport, args, err); werr != nil {
+			logError("write JUnit report %s fail: %v", opts.JUnitReport, werr)
+			if err == nil {
+				err = werr
+			}
+		}
+	}()
+	defer func() {
+		if opts.DryRun || diffing {
+			return
+		}
+		if nerr := notify(args, err); nerr != nil {
+			logWarning("notify fail: %v", nerr)
+		}
+	}()
+	var packed *buildResult
+	defer func() {
+		if opts.SummaryFile == "" || opts.DryRun || diffing {
+			return
+		}
+		if werr := writeSummary(opts.SummaryFile, args, packed, err); werr != nil {
+			logError("write summary file %s fail: %v", opts.SummaryFile, werr)
+			if err == nil {
+				err = werr
+			}
+		}
+	}()
+	defer func() {
+		// the failures not given an exit code where they happen are told
+		// apart by the stage they stopped the run in
+		if stage == "validate" {
+			err = withExitCode(exitValidation, err)
+		} else {
+			err = withExitCode(exitPackage, err)
+		}
+	}()
+	backupTime = time.Now()
+
+	if err := setAbsPath("Android project", &opts.AndroidProjectPath); err != nil {
+		return err
+	}
+
+	if opts.JavaHome != "" {
+		if err := setAbsPath("JDK", &opts.JavaHome); err != nil {
+			return err
+		}
+	}
+
+	if opts.AndroidSdk != "" {
+		if err := setAbsPath("Android SDK", &opts.AndroidSdk); err != nil {
+			return err
+		}
+	}
+
+	if opts.AndroidNdk != "" {
+		if err := setAbsPath("Android NDK", &opts.AndroidNdk); err != nil {
+			return err
+		}
+	}
+
+	if opts.BackupDir != "" {
+		if err := setAbsPath("Backup directory", &opts.BackupDir); err != nil {
+			return err
+		}
+	}
+
+	if opts.NativeSymbolsDir != "" {
+		if err := setAbsPath("Native symbols directory", &opts.NativeSymbolsDir); err != nil {
+			return err
+		}
+	}
+
+	for i := range opts.R8Rules {
+		if err := setAbsPath("R8 rules", &opts.R8Rules[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := range args {
+		if err := setAbsPath("Output directory", &args[i]); err != nil {
+			return err
+		}
+		logDebug("plugin ouput directory: %s", args[i])
+	}
+
+	c, err := loadConfig(opts.ConfigFile)
+	if err != nil {
+		return err
+	}
+	conf = *c
+	if err := checkNotifyConfig(&conf.Notify); err != nil {
+		return err
+	}
+	// nothing is touched before every option is known to be right
+	if err := checkOptions(); err != nil {
+		return err
+	}
+
+	if err := checkDirExist(opts.AndroidProjectPath); err != nil {
+		return environmentError(fmt.Errorf("Android project no found: %w", err))
+	}
+	logTrace("Android project at: %s", opts.AndroidProjectPath)
+
+	if opts.Remote != "" {
+		r, err := parseRemote(opts.Remote)
+		if err != nil {
+			return usageError(err)
+		}
+		remote = r
+		logTrace("Android project is built at: %s", remote)
+	}
+
+	if err := checkDirExist(opts.moduleDir()); err != nil {
+		return environmentError(fmt.Errorf("module %s no found: %w", opts.AndroidModuleName, err))
+	}
+	logTrace("Module %s project at: %s", opts.AndroidModuleName, opts.moduleDir())
+
+	switch {
+	case opts.DryRun || prebuiltAar != "":
+	case diffing:
+		// only the Android project is touched by the build
+		unlock, err := acquireLocks([]string{opts.AndroidProjectPath})
+		if err != nil {
+			return environmentError(err)
+		}
+		defer unlock()
+	default:
+		for _, baseDir := range args {
+			if err := makeDir(baseDir, false); err != nil {
+				return environmentError(err)
+			}
+		}
+		unlock, err := acquireLocks(append([]string{opts.AndroidProjectPath}, args...))
+		if err != nil {
+			return environmentError(err)
+		}
+		defer unlock()
+	}
+
+	// outputs are only kept if every step succeeds
+	resetChanges()
+	defer func() {
+		if err != nil {
+			rollbackChanges()
+		} else {
+			commitChanges()
+		}
+	}()
+
+	if opts.AutoBump && !diffing {
+		if err := bumpVersionCode(args); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveBuildInfo(); err != nil {
+		return environmentError(err)
+	}
+
+	if home := opts.javaHome(); home != "" {
+		if err := useJavaHome(home); err != nil {
+			return environmentError(err)
+		}
+	}
+	if remote == nil && opts.DockerImage == "" && prebuiltAar == "" {
+		if err := checkJDK(opts.AndroidProjectPath); err != nil {
+			return environmentError(err)
+		}
+	}
+
+	if ignores, err = loadIgnoreList(); err != nil {
+		return err
+	}
+	removals := opts.AndroidRemoveJarContent
+	if opts.StripUnityClasses {
+		removals = append(removals, unityClassPatterns...)
+	}
+	if opts.StripSignatures {
+		removals = append(removals, signaturePatterns...)
+	}
+	if jarRemovals, err = newIgnoreList(removals); err != nil {
+		return usageError(fmt.Errorf("invalid jar content removal: %w", err))
+	}
+	if jarKeeps, err = newIgnoreList(opts.AndroidKeepJarContent); err != nil {
+		return usageError(fmt.Errorf("invalid jar content allowlist: %w", err))
+	}
+	if relocations, err = parseRelocations(opts.Relocations); err != nil {
+		return usageError(err)
+	}
+	if _, err := parseKeyValues("Gradle project property", opts.GradleBuildProps); err != nil {
+		return usageError(err)
+	}
+
+	manifests := make(map[string][]byte, len(args))
+	files := make(map[string][]renderedFile, len(args))
+	copies := make(map[string][]copySpec, len(args))
+	for _, baseDir := range args {
+		out := conf.output(baseDir)
+		if out != nil {
+			logDebug("settings of %s found in config file", baseDir)
+		}
+		if manifests[baseDir], err = renderManifest(out); err != nil {
+			return err
+		}
+		xmlResourceRefs(manifests[baseDir], manifestResourceRefs)
+		if files[baseDir], err = renderFiles(out); err != nil {
+			return err
+		}
+		if copies[baseDir], err = copySpecs(out); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		if err := dryRun(args, &buildResult{Manifests: manifests, Files: files, Copies: copies}); err != nil {
+			return err
+		}
+		return checkWarnings()
+	}
+
+	startStage("build")
+	var sourceHash string
+	outputs := []string{"UPACK_OUTPUTS=" + strings.Join(args, string(os.PathListSeparator))}
+	if err := runStages(conf.stagesBetween("", stageExtract), outputs, func(name string) error {
+		if name != stageBuild || prebuiltAar != "" {
+			return nil
+		}
+		// pre-build hooks may generate sources, they run before hashing
+		if err := runHooks(hookPreBuild, args, ""); err != nil {
+			return err
+		}
+		var err error
+		sourceHash, err = buildModuleAar()
+		return withExitCode(exitGradle, err)
+	}); err != nil {
+		return err
+	}
+
+	if err := checkCanceled(); err != nil {
+		return err
+	}
+	if err := checkFileExist(opts.moduleAarFile()); err != nil {
+		return withExitCode(exitGradle, fmt.Errorf("Android build result no found: %w", err))
+	}
+	if err := checkAarSdkVersions(opts.moduleAarFile()); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	if prebuiltAar == "" && conf.stageEnabled(stageBuild) {
+		if err := runHooks(hookPostBuild, args, ""); err != nil {
+			return err
+		}
+	}
+	if diffing {
+		return diffOutputs(args, &buildResult{Manifests: manifests, Files: files, Copies: copies})
+	}
+
+	fp, err := newFingerprint(sourceHash)
+	if err != nil {
+		return err
+	}
+	result := &buildResult{Manifests: manifests, Files: files, Copies: copies, Fingerprint: fp}
+	if opts.ResolveDependencies {
+		tmpDir, err := os.MkdirTemp("", "upack-deps")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		logTrace("start resolving dependencies ...")
+		if result.Dependencies, err = resolveDependencies(tmpDir); err != nil {
+			return withExitCode(exitGradle, err)
+		}
+		for _, d := range result.Dependencies {
+			logDebug("resolved dependency %s", d.Spec)
+		}
+	}
+
+	if opts.SplitAbi {
+		tmpDir, err := os.MkdirTemp("", "upack-abis")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		logTrace("start splitting native libraries by ABI ...")
+		if result.AbiAars, err = splitAbis(tmpDir); err != nil {
+			return err
+		}
+	}
+
+	startStage("")
+	if err := forEachOutput(args, func(baseDir string) error {
+		return runStep(outputCaseName(baseDir), func() error {
+			if err := runHooks(hookPrePack, args, baseDir); err != nil {
+				return err
+			}
+			return packOutput(baseDir, result)
+		})
+	}); err != nil {
+		return err
+	}
+	// verification starts after every output is written, outputs may share
+	// a Unity project
+	if err := forEachOutput(args, func(baseDir string) error {
+		return runStep(outputCaseName(baseDir), func() error {
+			return verifyOutput(baseDir)
+		})
+	}); err != nil {
+		return err
+	}
+	// the outputs are rolled back like on any other failure
+	if err := checkWarnings(); err != nil {
+		return err
+	}
+	// post-pack hooks see the outputs complete, their failure rolls them back
+	for _, baseDir := range args {
+		if err := runHooks(hookPostPack, args, baseDir); err != nil {
+			return fmt.Errorf("output %s: %w", baseDir, err)
+		}
+	}
+	packed = result
+	if opts.SizeReport {
+		for _, baseDir := range args {
+			if err := printSizeReport(baseDir, result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// packOutput writes the plugin into the output directory baseDir.
+func packOutput(baseDir string, result *buildResult) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	logDebug("output format of %s: %s", baseDir, format)
+
+	if err := packTo(format, baseDir, result); err != nil {
+		return err
+	}
+	if err := patchUnityTemplates(baseDir); err != nil {
+		return err
+	}
+
+	// the stages after the sync see the output as it is written
+	env, err := outputEnv(baseDir)
+	if err != nil {
+		return err
+	}
+	return runStages(conf.stagesBetween(stageSync, ""), env, func(string) error { return nil })
+}
+
+// verifyOutput checks the resources of the plugin in the output directory
+// baseDir against the other plugins of the Unity project, its classes are
+// checked before they are written.
+func verifyOutput(baseDir string) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	return verifyResources(format, baseDir)
+}
+
+// takeRequiredOptions returns the options of the parser marked required,
+// they are no longer checked by the parser itself.
+func takeRequiredOptions(parser *flags.Parser) []*flags.Option {
+	var required []*flags.Option
+	for _, g := range parser.Groups() {
+		for _, o := range g.Options() {
+			if o.Required {
+				o.Required = false
+				required = append(required, o)
+			}
+		}
+	}
+	return required
+}
+
+// withoutOption returns the options but the one with the long name.
+func withoutOption(options []*flags.Option, long string) []*flags.Option {
+	var rest []*flags.Option
+	for _, o := range options {
+		if o.LongName != long {
+			rest = append(rest, o)
+		}
+	}
+	return rest
+}
+
+// checkRequiredOptions fails the way the parser does if any of the required
+// options is not given.
+func checkRequiredOptions(required []*flags.Option) error {
+	var names []string
+	for _, o := range required {
+		if !optionGiven(o) {
+			names = append(names, "`"+o.String()+"'")
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	msg := "the required flag " + names[0] + " was not specified"
+	if len(names) > 1 {
+		msg = fmt.Sprintf("the required flags %s and %s were not specified",
+			strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	return &flags.Error{Type: flags.ErrRequired, Message: msg}
+}
+
+// Main runs the upack command with the arguments of the process, build is
+// the metadata of the binary. It exits the process on failure.
+func Main(build BuildInfo) {
+	buildVersion, buildCommit, buildDate = build.Version, build.Commit, build.Date
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	parser.AddCommand("verify", "Check whether the plugin outputs are stale",
+		"Compare the fingerprint in each output directory with the current Android sources.", &verifyCommand{})
+	parser.AddCommand("serve", "Run as a daemon packing the plugin on request",
+		"Keep the Gradle daemon warm and pack the plugin into the output directories on every POST /pack request.", &serveCommand{})
+	parser.AddCommand("restore", "Restore the backups made by previous runs",
+		"Put every backup with --backup-extension under the output directories back in place of the output it was made from.", &restoreCommand{})
+	parser.AddCommand("clean", "Remove what previous runs generated",
+		"Remove the outputs recorded in the fingerprint of the module in each output directory, with their .meta files and backups.", &cleanCommand{})
+	parser.AddCommand("diff", "Show what packing the plugin would change",
+		"Build the plugin, or take the AAR given by --aar, and print the files it would add, remove or modify in each output directory with a diff of the text files, without writing anything.", &diffCommand{})
+	parser.AddCommand("inspect", "Show what an AAR holds",
+		"Print the contents, manifest, permissions, SDK versions, native ABIs and jar class counts of each AAR given as argument.", &inspectCommand{})
+	parser.AddCommand("version", "Print the version of upack",
+		"Print the version, commit and build date of upack, and the Go toolchain it was built with.", &versionCommand{})
+	parser.AddCommand("completion", "Print the shell completion script",
+		"Print the completion script of bash, zsh, fish or powershell, completing the commands, the options and the modules and activities of the Android project.", &completionCommand{name: parser.Name})
+	parser.CompletionHandler = printCompletions
+
+	// the Android project options are only required once the command is
+	// known, inspect works without them
+	required := takeRequiredOptions(parser)
+	parser.CommandHandler = func(cmd flags.Commander, args []string) error {
+		if opts.ShowConfig {
+			return showConfig(parser)
+		}
+		need := required
+		switch cmd.(type) {
+		case *inspectCommand, *completionCommand, *versionCommand:
+			// the Android project isn't needed
+			need = nil
+		case *verifyCommand, *restoreCommand:
+			// no manifest is rendered, so the entry activity isn't needed
+			need = withoutOption(required, "entry-activity")
+		}
+		if len(need) > 0 {
+			if canPrompt() {
+				if err := promptRequiredOptions(need); err != nil {
+					return err
+				}
+			}
+			if err := checkRequiredOptions(need); err != nil {
+				return err
+			}
+		}
+		if opts.LogFile != "" {
+			if err := openLogFile(opts.LogFile); err != nil {
+				return fmt.Errorf("open log file %s: %w", opts.LogFile, err)
+			}
+		}
+		if cmd == nil {
+			return nil
+		}
+		err := cmd.Execute(args)
+		if err != nil {
+			logFileError(err)
+		}
+		return err
+	}
+	defer closeLogFile()
+	args, err := parser.Parse()
+	if err != nil {
+		exit(err)
+	}
+	if parser.Active != nil || opts.ShowConfig {
+		return
+	}
+
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	run := main1
+	if opts.Watch {
+		run = watch
+	}
+	if err := run(args); err != nil {
+		logError("%v", err)
+		exit(err)
+	}
+}
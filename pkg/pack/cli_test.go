@@ -0,0 +1,87 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zhiruili/upack/pkg/aar"
+)
+
+func TestFilterJar(t *testing.T) {
+	type entry struct {
+		name     string
+		mode     os.FileMode
+		method   uint16
+		modified time.Time
+		content  string
+	}
+	modified := time.Date(2021, 6, 1, 12, 30, 44, 0, time.UTC)
+	entries := []entry{
+		{"com/", os.ModeDir | 0755, zip.Store, modified, ""},
+		{"com/example/Main.class", 0644, zip.Deflate, modified, "main"},
+		{"com/unity3d/player/UnityPlayer.class", 0644, zip.Deflate, modified, "unity"},
+		{"META-INF/MANIFEST.MF", 0600, zip.Store, modified.Add(time.Hour), "Manifest-Version: 1.0\n"},
+		{"bin/run.sh", 0755, zip.Deflate, modified.Add(-time.Hour), "#!/bin/sh\n"},
+	}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: e.method, Modified: e.modified}
+		header.SetMode(e.mode)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	jarFile := filepath.Join(t.TempDir(), "classes.jar")
+	if err := os.WriteFile(jarFile, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(l *ignoreList) { jarRemovals = l }(jarRemovals)
+	var err error
+	if jarRemovals, err = newIgnoreList([]string{"com/unity3d/**"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := filterJar(jarFile); err != nil {
+		t.Fatalf("filterJar() = %v", err)
+	}
+
+	info, err := os.Stat(jarFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("jar mode = %v, want 0600", info.Mode().Perm())
+	}
+	r, err := zip.OpenReader(jarFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []entry
+	for _, f := range r.File {
+		content, err := aar.ReadEntry(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, entry{f.Name, f.Mode(), f.Method, f.Modified.UTC(), string(content)})
+	}
+	// directories are left out and the removed class is gone, the rest
+	// keeps its order, mode, compression and time
+	want := []entry{entries[1], entries[3], entries[4]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	colorRed    = "31"
+	colorYellow = "33"
+	colorBold   = "1"
+)
+
+// colorEnabled tells whether what is written to f may be colored, colors
+// are off with --no-color, NO_COLOR and wherever escapes are.
+func colorEnabled(f *os.File) bool {
+	if opts.NoColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return escapesEnabled(f)
+}
+
+// escapesEnabled tells whether escape sequences written to f are processed,
+// which needs a terminal other than a dumb one or a Windows console unable
+// to process them.
+func escapesEnabled(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f) && enableVirtualTerminal(f)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(code, s string) string {
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// printHeader prints the header of a part of the output of a command on
+// stdout, in bold on terminals.
+func printHeader(f string, a ...interface{}) {
+	s := fmt.Sprintf(f, a...)
+	if colorEnabled(os.Stdout) {
+		s = colorize(colorBold, s)
+	}
+	fmt.Println(s)
+}
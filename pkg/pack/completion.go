@@ -0,0 +1,171 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// The completion scripts hand the words typed so far to upack, whose flags
+// parser lists the completions when GO_FLAGS_COMPLETION is set.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for {{.}}, load it with: source <({{.}} completion bash)
+_{{.}}() {
+    local IFS=$'\n'
+    COMPREPLY=($(GO_FLAGS_COMPLETION=1 "${COMP_WORDS[0]}" "${COMP_WORDS[@]:1:$COMP_CWORD}"))
+}
+complete -o default -F _{{.}} {{.}}
+`,
+	"zsh": `#compdef {{.}}
+# zsh completion for {{.}}, load it with: source <({{.}} completion zsh)
+_{{.}}() {
+    local -a completions
+    completions=(${(f)"$(GO_FLAGS_COMPLETION=1 ${words[1]} "${(@)words[2,$CURRENT]}")"})
+    if (( ${#completions} )); then
+        compadd -Q -- $completions
+    else
+        _files
+    fi
+}
+compdef _{{.}} {{.}}
+`,
+	"fish": `# fish completion for {{.}}, load it with: {{.}} completion fish | source
+function __{{.}}_complete
+    set -l args (commandline -opc) (commandline -ct)
+    set -e args[1]
+    env GO_FLAGS_COMPLETION=1 {{.}} $args
+end
+complete -c {{.}} -a '(__{{.}}_complete)'
+`,
+	"powershell": `# PowerShell completion for {{.}}, load it with: {{.}} completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName {{.}} -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.StartOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') { $words += '""' }
+    $env:GO_FLAGS_COMPLETION = '1'
+    $items = & {{.}} @words
+    Remove-Item Env:GO_FLAGS_COMPLETION
+    $items | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+type completionShell string
+
+func (s completionShell) Complete(match string) []flags.Completion {
+	var items []flags.Completion
+	for _, name := range []string{"bash", "fish", "powershell", "zsh"} {
+		if strings.HasPrefix(name, match) {
+			items = append(items, flags.Completion{Item: name})
+		}
+	}
+	return items
+}
+
+type completionCommand struct {
+	Args struct {
+		Shell completionShell `positional-arg-name:"shell" description:"bash, zsh, fish or powershell"`
+	} `positional-args:"yes" required:"yes"`
+
+	// name is the name the completion is registered for.
+	name string
+}
+
+// Execute prints the completion script of the shell.
+func (c *completionCommand) Execute(args []string) error {
+	script, ok := completionScripts[string(c.Args.Shell)]
+	if !ok {
+		return usageError(fmt.Errorf("unknown shell %s, bash, zsh, fish or powershell expected", c.Args.Shell))
+	}
+	return template.Must(template.New("completion").Parse(script)).Execute(os.Stdout, c.name)
+}
+
+// optionArgument returns the value given to the option with the short name
+// short or the long name long in args, "" if none is.
+func optionArgument(args []string, short, long string) string {
+	for i, a := range args {
+		switch {
+		case (a == "-"+short || a == "--"+long) && i+1 < len(args):
+			return args[i+1]
+		case strings.HasPrefix(a, "--"+long+"="):
+			return strings.TrimPrefix(a, "--"+long+"=")
+		case short != "" && strings.HasPrefix(a, "-"+short) && !strings.HasPrefix(a, "--"):
+			return strings.TrimPrefix(a, "-"+short)
+		}
+	}
+	return ""
+}
+
+// completeProjectValues completes the module and the entry activity with the
+// ones found in the Android project given by the other words typed, the
+// flags parser only knows the options themselves.
+func completeProjectValues(args []string) []flags.Completion {
+	if len(args) == 0 {
+		return nil
+	}
+	last, prev := args[len(args)-1], ""
+	if len(args) > 1 {
+		prev = args[len(args)-2]
+	}
+	done := args[:len(args)-1]
+	projectDir := optionArgument(done, "a", "android-path")
+	if projectDir == "" {
+		projectDir = os.Getenv("UPACK_ANDROID_PROJECT_PATH")
+	}
+	if projectDir == "" {
+		projectDir = "."
+	}
+
+	activities := func() []string {
+		module := optionArgument(done, "m", "android-module-name")
+		if module == "" {
+			module = os.Getenv("UPACK_ANDROID_MODULE_NAME")
+		}
+		if module == "" {
+			return nil
+		}
+		return entryActivityCandidates(filepath.Join(projectDir, module))
+	}
+
+	var candidates []string
+	prefix := ""
+	switch {
+	case prev == "-m" || prev == "--android-module-name":
+		candidates = androidModuleCandidates(projectDir)
+	case strings.HasPrefix(last, "--android-module-name="):
+		prefix = "--android-module-name="
+		candidates = androidModuleCandidates(projectDir)
+	case prev == "-e" || prev == "--entry-activity":
+		candidates = activities()
+	case strings.HasPrefix(last, "--entry-activity="):
+		prefix = "--entry-activity="
+		candidates = activities()
+	}
+	match := strings.TrimPrefix(last, prefix)
+
+	var items []flags.Completion
+	for _, c := range candidates {
+		if strings.HasPrefix(c, match) {
+			items = append(items, flags.Completion{Item: prefix + c})
+		}
+	}
+	return items
+}
+
+// printCompletions is the completion handler of the flags parser.
+func printCompletions(items []flags.Completion) {
+	if len(items) == 0 {
+		items = completeProjectValues(os.Args[1:])
+	}
+	for _, item := range items {
+		fmt.Println(item.Item)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,124 @@
+package pack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config holds the settings given by the config file which are too
+// structured to be expressed by flags.
+type config struct {
+	IntentFilters []intentFilter    `yaml:"intent-filters"`
+	Vars          map[string]string `yaml:"vars"`
+	Outputs       []outputConfig    `yaml:"outputs"`
+	Files         []fileConfig      `yaml:"files"`
+	Copies        []copySpec        `yaml:"copy"`
+	JavaHome      string            `yaml:"java-home"`
+	Notify        notifyConfig      `yaml:"notify"`
+	Hooks         hooksConfig       `yaml:"hooks"`
+	Pipeline      []pipelineStage   `yaml:"pipeline"`
+
+	// dir is the directory of the config file, relative paths in the config
+	// file are resolved against it.
+	dir string
+}
+
+// outputConfig holds the settings of an output directory.
+type outputConfig struct {
+	Path             string            `yaml:"path"`
+	ManifestTemplate string            `yaml:"manifest-template"`
+	ManifestPreset   string            `yaml:"manifest-preset"`
+	Vars             map[string]string `yaml:"vars"`
+	Permissions      []string          `yaml:"permissions"`
+	Files            []fileConfig      `yaml:"files"`
+	Copies           []copySpec        `yaml:"copy"`
+}
+
+// fileConfig declares an extra file rendered from a template into the plugin
+// directory.
+type fileConfig struct {
+	Template string `yaml:"template"`
+	// Path is relative to the plugin directory.
+	Path string `yaml:"path"`
+}
+
+func (c *config) resolvePath(path string) string {
+	if path == "" || isURL(path) || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
+// output returns the settings of the output directory baseDir, nil is
+// returned if there is none.
+func (c *config) output(baseDir string) *outputConfig {
+	for i := range c.Outputs {
+		if filepath.Clean(c.resolvePath(c.Outputs[i].Path)) == filepath.Clean(baseDir) {
+			return &c.Outputs[i]
+		}
+	}
+	return nil
+}
+
+var conf config
+
+func loadConfig(path string) (*config, error) {
+	var c config
+	if path == "" {
+		return &c, nil
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	if c.dir, err = filepath.Abs(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	c.JavaHome = c.resolvePath(c.JavaHome)
+	for i := range c.Files {
+		c.Files[i].Template = c.resolvePath(c.Files[i].Template)
+	}
+	for i := range c.Copies {
+		c.Copies[i].Src = c.resolvePath(c.Copies[i].Src)
+	}
+	for i := range c.Outputs {
+		out := &c.Outputs[i]
+		out.ManifestTemplate = c.resolvePath(out.ManifestTemplate)
+		for j := range out.Files {
+			out.Files[j].Template = c.resolvePath(out.Files[j].Template)
+		}
+		for j := range out.Copies {
+			out.Copies[j].Src = c.resolvePath(out.Copies[j].Src)
+		}
+	}
+	return &c, nil
+}
+
+// files returns the extra files declared for the output directory out, which
+// may be nil.
+func (c *config) files(out *outputConfig) []fileConfig {
+	files := append([]fileConfig{}, c.Files...)
+	if out != nil {
+		files = append(files, out.Files...)
+	}
+	return files
+}
+
+// hasFile tells whether an extra file declared for the output directory
+// baseDir is written to path, the extra files go to the plugin directory of
+// the format.
+func (c *config) hasFile(format, baseDir, path string) bool {
+	dir := pluginDir(format, baseDir)
+	for _, f := range c.files(c.output(baseDir)) {
+		if filepath.Join(dir, f.Path) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copySpec declares an extra file or directory copied as is into the plugin
+// directory.
+type copySpec struct {
+	Src string `yaml:"src"`
+	// Dst is relative to the plugin directory.
+	Dst string `yaml:"dst"`
+}
+
+// parseCopySpecs parses --copy values in src:dst form, the last colon
+// separates the two so Windows drive letters are kept in src.
+func parseCopySpecs(values []string) ([]copySpec, error) {
+	specs := make([]copySpec, 0, len(values))
+	for _, v := range values {
+		i := strings.LastIndex(v, ":")
+		if i <= 0 || i == len(v)-1 {
+			return nil, fmt.Errorf("copy %q is not in src:dst form", v)
+		}
+		src, err := filepath.Abs(v[:i])
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, copySpec{Src: src, Dst: v[i+1:]})
+	}
+	return specs, nil
+}
+
+// copySpecs returns the extra files copied into the plugin directory of the
+// output directory out, which may be nil.
+func copySpecs(out *outputConfig) ([]copySpec, error) {
+	specs, err := parseCopySpecs(opts.Copies)
+	if err != nil {
+		return nil, err
+	}
+	specs = append(specs, conf.Copies...)
+	if out != nil {
+		specs = append(specs, out.Copies...)
+	}
+	for i := range specs {
+		s := &specs[i]
+		if s.Src == "" || s.Dst == "" {
+			return nil, fmt.Errorf("both src and dst are required by copies")
+		}
+		if filepath.IsAbs(s.Dst) || strings.HasPrefix(filepath.Clean(s.Dst), "..") {
+			return nil, fmt.Errorf("copy destination %s must be relative to the plugin directory", s.Dst)
+		}
+		s.Dst = filepath.Clean(s.Dst)
+		if _, err := os.Stat(s.Src); err != nil {
+			return nil, fmt.Errorf("copy source no found: %w", err)
+		}
+	}
+	return specs, nil
+}
+
+// copyAssets copies the extra files into dir, existing files are backed up
+// like any other generated file.
+func copyAssets(dir string, specs []copySpec) error {
+	defer timePhase("copies")()
+	for _, s := range specs {
+		dst := filepath.Join(dir, s.Dst)
+		logTrace("start copying %s to %s ...", s.Src, dst)
+		err := filepath.Walk(s.Src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(s.Src, path)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dst, relPath)
+			if info.IsDir() {
+				return makeDir(target, false)
+			}
+			if err := makeDir(filepath.Dir(target), false); err != nil {
+				return err
+			}
+			if err := removeOrBackup(target, opts.BackupExtension); err != nil {
+				return err
+			}
+			return copyFile(path, target)
+		})
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", s.Src, err)
+		}
+	}
+	return nil
+}
+
+func copyDestinations(specs []copySpec) []string {
+	paths := make([]string, 0, len(specs))
+	for _, s := range specs {
+		paths = append(paths, s.Dst)
+	}
+	return paths
+}
@@ -0,0 +1,147 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	policyOff   = "off"
+	policyWarn  = "warn"
+	policySkip  = "skip"
+	policyError = "error"
+)
+
+type existingArtifact struct {
+	Name    string
+	Version string
+	Path    string
+}
+
+// parseArtifactFileName splits file names like kotlin-stdlib-1.5.0.jar into
+// the artifact name and version, group prefixed names like
+// com.google.code.gson.gson-2.8.9.jar are also recognized.
+func parseArtifactFileName(fileName string) (name, version string, ok bool) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != ".jar" && ext != ".aar" {
+		return "", "", false
+	}
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	for i := len(base) - 1; i > 0; i-- {
+		if base[i] == '-' && i+1 < len(base) && base[i+1] >= '0' && base[i+1] <= '9' {
+			return base[:i], base[i+1:], true
+		}
+	}
+	return base, "", true
+}
+
+// artifactName returns the artifact id of a spec like group:name:version@aar.
+func artifactName(spec string) string {
+	parts := strings.Split(strings.SplitN(spec, "@", 2)[0], ":")
+	if len(parts) < 2 {
+		return spec
+	}
+	return parts[1]
+}
+
+func (a *existingArtifact) provides(name string) bool {
+	return a.Name == name || strings.HasSuffix(a.Name, "."+name)
+}
+
+// scanExistingArtifacts lists the jar and aar files under dir which are not
+// owned by this plugin.
+func scanExistingArtifacts(dir string, owned map[string]bool) ([]existingArtifact, error) {
+	var artifacts []existingArtifact
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if owned[path] || isSavedPath(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if name, version, ok := parseArtifactFileName(info.Name()); ok {
+			artifacts = append(artifacts, existingArtifact{Name: name, Version: version, Path: path})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return artifacts, err
+}
+
+// ownedPaths returns the paths in baseDir the current run replaces or
+// removes, which are never reported as duplicates. The outputs of the plugin
+// in another format are only owned if the previous run recorded them.
+func ownedPaths(format, baseDir string) map[string]bool {
+	owned := make(map[string]bool)
+	root := outputRootDir(format, baseDir)
+	for _, rel := range ownedOutputs(format, baseDir, nil) {
+		owned[filepath.Join(root, filepath.FromSlash(rel))] = true
+	}
+	if stale, err := staleOutputs(format, baseDir, nil); err == nil {
+		for _, p := range stale {
+			owned[p] = true
+		}
+	}
+	depsDir := pluginFilesDir(format, baseDir)
+	if prev, err := readDependencyLock(opts.dependencyLockPath(depsDir)); err == nil {
+		for _, d := range prev {
+			owned[filepath.Join(depsDir, d.File)] = true
+		}
+	}
+	return owned
+}
+
+// dedupDependencies checks the resolved dependencies against the jar and aar
+// files already in the Unity project and handles the duplicates according to
+// the --dedup policy, the dependencies to copy are returned.
+func dedupDependencies(format, baseDir string, deps []resolvedDependency) ([]resolvedDependency, error) {
+	if opts.Dedup == policyOff {
+		return deps, nil
+	}
+	scanDir := unityTemplateDir(baseDir)
+	existing, err := scanExistingArtifacts(scanDir, ownedPaths(format, baseDir))
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", scanDir, err)
+	}
+
+	var kept []resolvedDependency
+	var dups []string
+	for _, d := range deps {
+		name := artifactName(d.Spec)
+		var dup *existingArtifact
+		for i := range existing {
+			if existing[i].provides(name) {
+				dup = &existing[i]
+				break
+			}
+		}
+		if dup == nil {
+			kept = append(kept, d)
+			continue
+		}
+		msg := fmt.Sprintf("%s is already provided by %s", d.Spec, dup.Path)
+		switch opts.Dedup {
+		case policySkip:
+			logDebug("skip dependency %s", msg)
+		case policyWarn:
+			logWarning("duplicate dependency %s", msg)
+			kept = append(kept, d)
+		default:
+			dups = append(dups, msg)
+		}
+	}
+	if len(dups) > 0 {
+		return nil, fmt.Errorf("duplicate dependencies:\n  %s", strings.Join(dups, "\n  "))
+	}
+	return kept, nil
+}
@@ -0,0 +1,169 @@
+package pack
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveDependenciesScript is a Gradle init script adding a task which copies
+// the resolved runtime artifacts of a project into a directory and records
+// them in a lock file.
+const resolveDependenciesScript string = `import org.gradle.api.artifacts.component.ModuleComponentIdentifier
+
+allprojects { p ->
+    p.tasks.register('upackCopyDependencies') {
+        doLast {
+            def out = new File(p.property('upackOutputDir'))
+            out.mkdirs()
+            def config = p.configurations.getByName(p.property('upackConfiguration'))
+            def lines = []
+            ['aar', 'jar'].each { type ->
+                def view = config.incoming.artifactView {
+                    attributes { it.attribute(Attribute.of('artifactType', String), type) }
+                }
+                view.artifacts.each { a ->
+                    def id = a.id.componentIdentifier
+                    if (id instanceof ModuleComponentIdentifier) {
+                        def name = "${id.group}.${id.module}-${id.version}.${type}"
+                        java.nio.file.Files.copy(a.file.toPath(), new File(out, name).toPath(),
+                            java.nio.file.StandardCopyOption.REPLACE_EXISTING)
+                        lines << "${id.group}:${id.module}:${id.version}@${type} ${name}"
+                    }
+                }
+            }
+            new File(out, p.property('upackLockFile')).text = lines.join('\n') + '\n'
+        }
+    }
+}
+`
+
+const dependencyLockFile = "dependencies.lock"
+
+type resolvedDependency struct {
+	// Spec is the resolved Maven coordinate like group:name:version@aar.
+	Spec string
+	// File is the name of the copied artifact.
+	File string
+}
+
+func parseDependencyLock(content string) ([]resolvedDependency, error) {
+	var deps []resolvedDependency
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("illegal dependency lock line %q", line)
+		}
+		deps = append(deps, resolvedDependency{Spec: fields[0], File: fields[1]})
+	}
+	return deps, scanner.Err()
+}
+
+func readDependencyLock(path string) ([]resolvedDependency, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDependencyLock(string(bs))
+}
+
+func renderDependencyLock(deps []resolvedDependency) []byte {
+	var sb strings.Builder
+	sb.WriteString("# resolved by upack, do not edit\n")
+	for _, d := range deps {
+		sb.WriteString(d.Spec + " " + d.File + "\n")
+	}
+	return []byte(sb.String())
+}
+
+// resolveDependencies runs Gradle to download the runtime dependencies of the
+// module into dir, the resolved artifacts are returned.
+func resolveDependencies(dir string) ([]resolvedDependency, error) {
+	defer timePhase("dependency resolution")()
+	script := filepath.Join(dir, "upack-init.gradle")
+	if err := ioutil.WriteFile(script, []byte(resolveDependenciesScript), 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(script)
+
+	outDir := filepath.Join(dir, "artifacts")
+	task := fmt.Sprintf(":%s:upackCopyDependencies", opts.AndroidModuleName)
+	err := withRetries("resolve dependencies", func() error {
+		return runGradleAt(opts.AndroidProjectPath, gradleCommand(opts.AndroidProjectPath), gradleArgs("-I", script, task,
+			"-PupackOutputDir="+outDir,
+			"-PupackConfiguration="+opts.DependencyConfiguration,
+			"-PupackLockFile="+dependencyLockFile)...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resolve dependencies fail %w", err)
+	}
+	deps, err := readDependencyLock(filepath.Join(outDir, dependencyLockFile))
+	if err != nil {
+		return nil, err
+	}
+	for i := range deps {
+		deps[i].File = filepath.Join(outDir, deps[i].File)
+	}
+	return deps, nil
+}
+
+func (o *Options) dependencyLockPath(dir string) string {
+	return filepath.Join(dir, o.AndroidModuleName+"."+dependencyLockFile)
+}
+
+// copyDependencies copies the resolved artifacts into dir and records them
+// in a lock file, artifacts recorded by the previous lock file are removed
+// first so outdated versions don't pile up.
+func copyDependencies(dir string, deps []resolvedDependency, backupExt string) error {
+	defer timePhase("copies")()
+	lockPath := opts.dependencyLockPath(dir)
+	if prev, err := readDependencyLock(lockPath); err == nil {
+		for _, d := range prev {
+			path := filepath.Join(dir, d.File)
+			if err := removeOrBackup(path, backupExt); err != nil {
+				return err
+			}
+			if err := saveOriginal(path + ".meta"); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := makeDir(dir, false); err != nil {
+		return err
+	}
+	locked := make([]resolvedDependency, 0, len(deps))
+	for _, d := range deps {
+		name := filepath.Base(d.File)
+		logTrace("copying dependency %s to %s ...", d.Spec, dir)
+		if err := saveOriginal(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		if err := copyFile(d.File, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		locked = append(locked, resolvedDependency{Spec: d.Spec, File: name})
+	}
+	return backupAndWriteFile(lockPath, renderDependencyLock(locked), backupExt)
+}
+
+// addDependencyMetaFiles generates .meta files for the copied artifacts and
+// the lock file in dir.
+func addDependencyMetaFiles(assetRoot, dir string, deps []resolvedDependency) error {
+	for _, d := range deps {
+		if err := addMetaFiles(assetRoot, filepath.Join(dir, filepath.Base(d.File))); err != nil {
+			return err
+		}
+	}
+	return addMetaFiles(assetRoot, opts.dependencyLockPath(dir))
+}
@@ -0,0 +1,381 @@
+package pack
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+const diffContextLines = 3
+
+// diffTextExts are the extensions of the files shown as a textual diff when
+// they are modified.
+var diffTextExts = map[string]bool{
+	".xml":        true,
+	".txt":        true,
+	".json":       true,
+	".properties": true,
+	".pro":        true,
+	".gradle":     true,
+}
+
+type diffCommand struct {
+	Aar string `long:"aar" description:"Prebuilt AAR compared with the outputs instead of building the Android project"`
+}
+
+var (
+	// diffing tells the run to compare the plugin with the outputs rather
+	// than writing it.
+	diffing bool
+	// prebuiltAar replaces the AAR built from the Android project if not "".
+	prebuiltAar string
+)
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the shortest edit script turning a into b, found with
+// the linear space variant of the Myers algorithm so large files don't need
+// a table of every pair of lines.
+func diffLines(a, b []string) []diffOp {
+	return appendDiff(nil, a, b)
+}
+
+// appendDiff appends the edit script turning a into b to ops, the common
+// prefix and suffix are kept and the rest is split at a middle snake.
+func appendDiff(ops []diffOp, a, b []string) []diffOp {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+	case len(b) == 0:
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+	default:
+		x, y, u, v := middleSnake(a, b)
+		ops = appendDiff(ops, a[:x], b[:y])
+		for _, l := range a[x:u] {
+			ops = append(ops, diffOp{' ', l})
+		}
+		ops = appendDiff(ops, a[u:], b[v:])
+	}
+	for _, l := range common {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// middleSnake returns the run of equal lines from (x, y) to (u, v) halfway
+// along a shortest edit script of a and b, found by searching from both ends
+// at once. Only the furthest point reached on each diagonal is kept.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+	off := max + 1
+	// forward[off+k] is the furthest x on the diagonal x-y=k from the start,
+	// backward[off+k] the same from the end, on the reversed sequences
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && forward[off+k-1] < forward[off+k+1] {
+				x = forward[off+k+1]
+			} else {
+				x = forward[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[off+k] = x
+			if kr := delta - k; odd && kr >= -(d-1) && kr <= d-1 && x+backward[off+kr] >= n {
+				return sx, sy, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && backward[off+k-1] < backward[off+k+1] {
+				x = backward[off+k+1]
+			} else {
+				x = backward[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[off+k] = x
+			if kf := delta - k; !odd && kf >= -d && kf <= d && forward[off+kf]+x >= n {
+				return n - x, m - y, n - sx, m - sy
+			}
+		}
+	}
+	// not reached, the paths meet within max steps
+	return 0, 0, n, m
+}
+
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n"), "\n")
+}
+
+// writeUnifiedDiff writes the changes from old to new of the file at path to
+// w in the unified format.
+func writeUnifiedDiff(w io.Writer, path string, old, new []byte) {
+	a, b := splitLines(old), splitLines(new)
+	ops := diffLines(a, b)
+	fmt.Fprintf(w, "--- %s\n+++ %s (new)\n", path, path)
+
+	for start := 0; start < len(ops); {
+		// find the next change and the end of its hunk
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			return
+		}
+		begin := first - diffContextLines
+		if begin < start {
+			begin = start
+		}
+		end := first
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContextLines; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > first && ops[end-1].kind == ' ' {
+			end--
+		}
+		stop := end + diffContextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		aLine, bLine := 1, 1
+		for _, op := range ops[:begin] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[begin:stop] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		// an empty range starts at the line before it
+		if aCount == 0 {
+			aLine--
+		}
+		if bCount == 0 {
+			bLine--
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		for _, op := range ops[begin:stop] {
+			fmt.Fprintf(w, "%c%s\n", op.kind, op.line)
+		}
+		start = stop
+	}
+}
+
+// diffFile prints how the file at path changes into content.
+func diffFile(path string, content []byte) error {
+	old, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		fmt.Printf("A %s\n", path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if string(old) == string(content) {
+		return nil
+	}
+	fmt.Printf("M %s\n", path)
+	if diffTextExts[strings.ToLower(filepath.Ext(path))] {
+		writeUnifiedDiff(os.Stdout, path, old, content)
+	}
+	return nil
+}
+
+// diffDir prints how syncing srcDir into dstDir changes dstDir.
+func diffDir(srcDir, dstDir string) error {
+	if !pathExists(dstDir) {
+		fmt.Printf("A %s\n", dstDir)
+		return nil
+	}
+	updates, removals, err := dirsync.Changes(srcDir, dstDir)
+	if err != nil {
+		return fmt.Errorf("compare %s: %w", dstDir, err)
+	}
+	for _, relPath := range removals {
+		fmt.Printf("D %s\n", filepath.Join(dstDir, relPath))
+	}
+	for _, relPath := range updates {
+		src, dst := filepath.Join(srcDir, relPath), filepath.Join(dstDir, relPath)
+		info, err := os.Lstat(src)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if !pathExists(dst) {
+				fmt.Printf("A %s\n", dst)
+			}
+			continue
+		}
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := diffFile(dst, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffArchive prints whether the archive at dstFile changes into the one at
+// srcFile.
+func diffArchive(srcFile, dstFile string) error {
+	if !pathExists(dstFile) {
+		fmt.Printf("A %s\n", dstFile)
+		return nil
+	}
+	srcHash, err := dirsync.FileHash(srcFile)
+	if err != nil {
+		return err
+	}
+	dstHash, err := dirsync.FileHash(dstFile)
+	if err != nil {
+		return err
+	}
+	if string(srcHash) != string(dstHash) {
+		fmt.Printf("M %s\n", dstFile)
+	}
+	return nil
+}
+
+// diffOutput prints what packing the plugin into baseDir would change, the
+// plugin is staged in a temporary directory.
+func diffOutput(baseDir string, result *buildResult) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "upack-diff")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	printHeader("output %s (%s):", baseDir, format)
+
+	manifestDir := baseDir
+	switch format {
+	case formatAar, formatSrcAar:
+		aarFile := filepath.Join(tmpDir, "plugin.aar")
+		if err := repackAar(opts.moduleAarFile(), aarFile); err != nil {
+			return err
+		}
+		dstFile := opts.outputAarFile(baseDir)
+		if format == formatSrcAar {
+			dstFile = filepath.Join(opts.m2ArtifactDir(baseDir), opts.MavenVersion,
+				fmt.Sprintf("%s-%s.srcaar", opts.AndroidModuleName, opts.MavenVersion))
+		}
+		if err := diffArchive(aarFile, dstFile); err != nil {
+			return err
+		}
+	default:
+		plugDir, layout := opts.libraryPluginDir(baseDir), func(string) error { return nil }
+		switch format {
+		case formatAndroidLib:
+			plugDir, layout = opts.androidLibPluginDir(baseDir), moveClassesJar
+		case formatUpm:
+			manifestDir = upmPluginDir(upmPackageDir(baseDir))
+			plugDir = opts.libraryPluginDir(manifestDir)
+		}
+		stageDir, err := stagePlugin(tmpDir, format, baseDir, plugDir, layout)
+		if err != nil {
+			return err
+		}
+		if err := diffDir(stageDir, plugDir); err != nil {
+			return err
+		}
+	}
+
+	if err := diffFile(filepath.Join(manifestDir, "AndroidManifest.xml"), result.Manifests[baseDir]); err != nil {
+		return err
+	}
+	for _, f := range result.Files[baseDir] {
+		if err := diffFile(filepath.Join(pluginDir(format, baseDir), f.Path), f.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffOutputs prints the changes of every output directory, one after
+// another so they don't interleave.
+func diffOutputs(args []string, result *buildResult) error {
+	for _, baseDir := range args {
+		if err := diffOutput(baseDir, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Execute builds the plugin, or takes the prebuilt AAR, and prints what
+// packing it would change in each output directory given by args.
+func (c *diffCommand) Execute(args []string) error {
+	if c.Aar != "" {
+		if err := setAbsPath("AAR", &c.Aar); err != nil {
+			return err
+		}
+		if err := checkFileExist(c.Aar); err != nil {
+			return fmt.Errorf("AAR no found: %w", err)
+		}
+		prebuiltAar = c.Aar
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	diffing = true
+	return main1(args)
+}
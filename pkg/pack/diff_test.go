@@ -0,0 +1,153 @@
+package pack
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// opLines renders an edit script as lines prefixed by their kind.
+func opLines(ops []diffOp) []string {
+	var lines []string
+	for _, op := range ops {
+		lines = append(lines, string(op.kind)+op.line)
+	}
+	return lines
+}
+
+// checkScript fails unless ops turns a into b.
+func checkScript(t *testing.T, a, b []string, ops []diffOp) {
+	t.Helper()
+	var gotA, gotB []string
+	for _, op := range ops {
+		if op.kind != '+' {
+			gotA = append(gotA, op.line)
+		}
+		if op.kind != '-' {
+			gotB = append(gotB, op.line)
+		}
+	}
+	if !reflect.DeepEqual(gotA, a) || !reflect.DeepEqual(gotB, b) {
+		t.Errorf("script %q turns %q into %q, want %q into %q", opLines(ops), gotA, gotB, a, b)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []string
+		// edits is checked instead of want where several shortest scripts
+		// exist
+		edits int
+	}{
+		{name: "both empty"},
+		{name: "identical", a: "a b c", b: "a b c", want: []string{" a", " b", " c"}},
+		{name: "insert only", b: "a b", want: []string{"+a", "+b"}},
+		{name: "delete only", a: "a b", want: []string{"-a", "-b"}},
+		{name: "insert in the middle", a: "a c", b: "a b c", want: []string{" a", "+b", " c"}},
+		{name: "delete in the middle", a: "a b c", b: "a c", want: []string{" a", "-b", " c"}},
+		{name: "append", a: "a b", b: "a b c d", want: []string{" a", " b", "+c", "+d"}},
+		{name: "replace", a: "a b c", b: "a x c", want: []string{" a", "-b", "+x", " c"}},
+		{name: "nothing in common", a: "a b", b: "c d", edits: 4},
+		{name: "classic example", a: "a b c a b b a", b: "c b a b a c", edits: 5},
+		{name: "repeated lines", a: "x x x x y", b: "y x x x x", edits: 2},
+	}
+	fields := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Fields(s)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := fields(tt.a), fields(tt.b)
+			ops := diffLines(a, b)
+			checkScript(t, a, b, ops)
+			if tt.want != nil || tt.edits == 0 {
+				if got := opLines(ops); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("diffLines() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			edits := 0
+			for _, op := range ops {
+				if op.kind != ' ' {
+					edits++
+				}
+			}
+			if edits != tt.edits {
+				t.Errorf("diffLines() = %q with %d edits, want %d", opLines(ops), edits, tt.edits)
+			}
+		})
+	}
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	numbered := func(n int) string {
+		var sb strings.Builder
+		for i := 1; i <= n; i++ {
+			sb.WriteString(strings.Repeat("l", i) + "\n")
+		}
+		return sb.String()
+	}
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "new file",
+			new:  "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "emptied file",
+			old:  "a\nb\n",
+			want: "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "change with context",
+			old:  numbered(10),
+			new:  strings.Replace(numbered(10), "lllll\n", "five\n", 1),
+			want: "@@ -2,7 +2,7 @@\n ll\n lll\n llll\n-lllll\n+five\n llllll\n lllllll\n llllllll\n",
+		},
+		{
+			name: "close changes share a hunk",
+			old:  "a\nb\nc\nd\ne\nf\ng\nh\n",
+			new:  "A\nb\nc\nd\ne\nf\ng\nH\n",
+			want: "@@ -1,8 +1,8 @@\n-a\n+A\n b\n c\n d\n e\n f\n g\n-h\n+H\n",
+		},
+		{
+			name: "distant changes get hunks of their own",
+			old:  numbered(20),
+			new:  "x\n" + strings.SplitN(numbered(20), "\n", 2)[1] + "y\n",
+			want: "@@ -1,4 +1,4 @@\n-l\n+x\n ll\n lll\n llll\n" +
+				"@@ -18,3 +18,4 @@\n " + strings.Repeat("l", 18) + "\n " + strings.Repeat("l", 19) + "\n " +
+				strings.Repeat("l", 20) + "\n+y\n",
+		},
+		{
+			name: "line endings are ignored",
+			old:  "a\r\nb\r\n",
+			new:  "a\nc\n",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeUnifiedDiff(&buf, "res/values/values.xml", []byte(tt.old), []byte(tt.new))
+			want := "--- res/values/values.xml\n+++ res/values/values.xml (new)\n" + tt.want
+			if got := buf.String(); got != want {
+				t.Errorf("writeUnifiedDiff() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
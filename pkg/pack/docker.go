@@ -0,0 +1,36 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+)
+
+const dockerProjectDir = "/project"
+
+// dockerRunArgs returns the arguments of docker to run Gradle in image with
+// the Android project mounted, the Gradle user home is kept under .gradle of
+// the project so dependencies are downloaded once.
+func dockerRunArgs(projectDir, image string) []string {
+	args := []string{
+		"run", "--rm",
+		"-v", projectDir + ":" + dockerProjectDir,
+		"-w", dockerProjectDir,
+		"-e", "GRADLE_USER_HOME=" + dockerProjectDir + "/.gradle/docker-home",
+	}
+	// files written into the mounted project are owned by the current user
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		args = append(args, "-u", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	args = append(args, image, "./gradlew")
+	return append(args, gradleArgs("assembleDebug")...)
+}
+
+// buildAndroidDocker builds the Android project inside a container of image,
+// which brings the JDK and Android SDK.
+func buildAndroidDocker(projectDir, image string) error {
+	logDebug("building %s in docker image %s ...", projectDir, image)
+	if err := runGradleAt(projectDir, "docker", dockerRunArgs(projectDir, image)...); err != nil {
+		return fmt.Errorf("build Android project in %s fail %w", image, err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/aar"
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+// planf prints a step of the dry run plan.
+func planf(f string, a ...interface{}) {
+	fmt.Printf("  "+f+"\n", a...)
+}
+
+// previewing tells whether the run only shows what it would change, the
+// plugin is then staged without writing anything outside the staging
+// directory or running the commands of the pipeline.
+func previewing() bool {
+	return opts.DryRun || diffing
+}
+
+// planBuild prints how the Android project would be prepared and built, it
+// tells whether the Gradle build would run.
+func planBuild(projectDir string, sourceHash string) bool {
+	printHeader("Android project %s:", projectDir)
+	if props := opts.localProperties(); len(props) > 0 {
+		path := filepath.Join(projectDir, localPropertiesName)
+		origin, _ := ioutil.ReadFile(path)
+		if setProperties(string(origin), props) != string(origin) {
+			keys := make([]string, 0, len(props))
+			for _, p := range props {
+				keys = append(keys, p.Key)
+			}
+			planf("patch %s with %s", path, strings.Join(keys, ", "))
+		}
+	}
+	if opts.BootstrapGradle != "" && checkFileExist(filepath.Join(projectDir, gradleWrapperName())) != nil {
+		planf("bootstrap the Gradle %s wrapper", opts.BootstrapGradle)
+	}
+
+	if !opts.NoCache && buildCached(gradleInputsKey(sourceHash)) {
+		planf("skip the Gradle build, sources unchanged since the last build")
+		return false
+	}
+	switch {
+	case remote != nil:
+		planf("upload the sources to %s", remote)
+		planf("run on %s: ./gradlew %s", remote.Host, strings.Join(gradleArgs("assembleDebug"), " "))
+		planf("download the AAR to %s", opts.moduleAarFile())
+	case opts.DockerImage != "":
+		planf("run: docker %s", strings.Join(dockerRunArgs(projectDir, opts.DockerImage), " "))
+	default:
+		planf("run: %s %s", gradleCommand(projectDir), strings.Join(gradleArgs("assembleDebug"), " "))
+	}
+	if opts.ResolveDependencies {
+		planf("resolve the dependencies of configuration %s", opts.DependencyConfiguration)
+	}
+	return true
+}
+
+// planAar prints the entries of the AAR which would be left out of the
+// plugin, rebuild tells whether the AAR on disk is going to be replaced.
+func planAar(rebuild bool) error {
+	aarFile := opts.moduleAarFile()
+	if checkFileExist(aarFile) != nil {
+		printHeader("AAR %s: not built yet, the outputs are planned without it", aarFile)
+		return nil
+	}
+	if rebuild {
+		printHeader("AAR %s, planned with the previous build:", aarFile)
+	} else {
+		printHeader("AAR %s:", aarFile)
+	}
+	r, err := zip.OpenReader(aarFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		isDir := f.FileInfo().IsDir()
+		if !keepAarEntry(f.Name, isDir) {
+			planf("drop entry %s", f.Name)
+			continue
+		}
+		if isDir || !filterJarEnabled() || path.Ext(f.Name) != ".jar" ||
+			(f.Name != "classes.jar" && path.Dir(f.Name) != "libs") {
+			continue
+		}
+		content, err := aar.ReadEntry(f)
+		if err != nil {
+			return err
+		}
+		jar, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		for _, e := range jar.File {
+			if !e.FileInfo().IsDir() && !keepJarEntry(e.Name, false) {
+				planf("remove %s from %s", e.Name, f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// planWrite prints what writing content to path would do.
+func planWrite(path string, content []byte) {
+	switch {
+	case dirsync.SameFileContent(path, content):
+		planf("keep %s, unchanged", path)
+	case pathExists(path) && opts.BackupExtension != "":
+		planf("back up %s to %s and write it", path, backupPath(path, opts.BackupExtension))
+	case pathExists(path):
+		planf("overwrite %s", path)
+	default:
+		planf("create %s", path)
+	}
+}
+
+// planPluginDir prints the changes syncing the extracted AAR into plugDir
+// would make.
+func planPluginDir(format, baseDir, plugDir string, layout func(dir string) error) error {
+	if checkFileExist(opts.moduleAarFile()) != nil {
+		planf("write %s from the built AAR", plugDir)
+		return nil
+	}
+	if !pathExists(plugDir) {
+		planf("create %s", plugDir)
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "upack-plan")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	stageDir, err := stagePlugin(tmpDir, format, baseDir, plugDir, layout)
+	if err != nil {
+		return err
+	}
+	updates, removals, err := dirsync.Changes(stageDir, plugDir)
+	if err != nil {
+		return fmt.Errorf("compare %s: %w", plugDir, err)
+	}
+	if len(updates) == 0 && len(removals) == 0 {
+		planf("keep %s, up to date", plugDir)
+		return nil
+	}
+	if opts.BackupExtension != "" {
+		planf("back up %s to %s", plugDir, backupPath(plugDir, opts.BackupExtension))
+	}
+	for _, relPath := range removals {
+		planf("delete %s", filepath.Join(plugDir, relPath))
+	}
+	for _, relPath := range updates {
+		planf("update %s", filepath.Join(plugDir, relPath))
+	}
+	return nil
+}
+
+// planOutput prints what packing the plugin into baseDir would do.
+func planOutput(baseDir string, result *buildResult) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	printHeader("output %s (%s):", baseDir, format)
+	if !pathExists(baseDir) {
+		planf("create %s", baseDir)
+	}
+
+	manifestDir := baseDir
+	switch format {
+	case formatAar:
+		aarFile := opts.outputAarFile(baseDir)
+		if pathExists(aarFile) && opts.BackupExtension != "" {
+			planf("back up %s to %s", aarFile, backupPath(aarFile, opts.BackupExtension))
+		}
+		planf("write %s from the built AAR", aarFile)
+	case formatSrcAar:
+		versionDir := filepath.Join(opts.m2ArtifactDir(baseDir), opts.MavenVersion)
+		if pathExists(versionDir) {
+			planf("delete %s", versionDir)
+		}
+		planf("write %s-%s.srcaar and .pom into %s", opts.AndroidModuleName, opts.MavenVersion, versionDir)
+	case formatAndroidLib:
+		if err := planPluginDir(format, baseDir, opts.androidLibPluginDir(baseDir), moveClassesJar); err != nil {
+			return err
+		}
+	case formatUpm:
+		manifestDir = upmPluginDir(upmPackageDir(baseDir))
+		planf("write %s", filepath.Join(upmPackageDir(baseDir), "package.json"))
+		if err := planPluginDir(format, baseDir, opts.libraryPluginDir(manifestDir), nil); err != nil {
+			return err
+		}
+	default:
+		if err := planPluginDir(format, baseDir, opts.libraryPluginDir(baseDir), nil); err != nil {
+			return err
+		}
+	}
+
+	manifestFile := filepath.Join(manifestDir, "AndroidManifest.xml")
+	manifest := result.Manifests[baseDir]
+	planWrite(manifestFile, manifest)
+	if !dirsync.SameFileContent(manifestFile, manifest) {
+		for _, l := range strings.Split(strings.TrimRight(string(manifest), "\n"), "\n") {
+			planf("  | %s", l)
+		}
+	}
+	for _, f := range result.Files[baseDir] {
+		planWrite(filepath.Join(pluginDir(format, baseDir), f.Path), f.Content)
+	}
+	for _, c := range result.Copies[baseDir] {
+		planf("copy %s to %s", c.Src, filepath.Join(pluginDir(format, baseDir), c.Dst))
+	}
+	return nil
+}
+
+// dryRun prints the plan of packing the plugin into the output directories
+// args without building or writing anything.
+func dryRun(args []string, result *buildResult) error {
+	sourceHash, err := buildCacheKey(opts.AndroidProjectPath, opts.AndroidModuleName)
+	if err != nil {
+		return fmt.Errorf("hash sources of %s: %w", opts.AndroidProjectPath, err)
+	}
+	printHeader("dry run, nothing is built or written")
+	rebuild := planBuild(opts.AndroidProjectPath, sourceHash)
+	if err := planAar(rebuild); err != nil {
+		return err
+	}
+	for _, baseDir := range args {
+		if err := planOutput(baseDir, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
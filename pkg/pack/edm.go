@@ -0,0 +1,102 @@
+package pack
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+)
+
+// runtimeConfigurations lists the Gradle configurations whose dependencies
+// are needed at runtime by the plugin.
+const runtimeConfigurations = `implementation|api|compile|runtimeOnly`
+
+var (
+	gradleStringDependency = regexp.MustCompile(`(?m)^\s*(?:` + runtimeConfigurations + `)\s*\(?\s*['"]([^'":\s]+:[^'":\s]+:[^'"\s]+)['"]`)
+	gradleMapDependency    = regexp.MustCompile(`(?m)^\s*(?:` + runtimeConfigurations + `)\s*\(?\s*group\s*[:=]\s*['"]([^'"]+)['"]\s*,\s*name\s*[:=]\s*['"]([^'"]+)['"]\s*,\s*version\s*[:=]\s*['"]([^'"]+)['"]`)
+)
+
+func (o *Options) moduleBuildFile() (string, error) {
+	for _, name := range []string{"build.gradle", "build.gradle.kts"} {
+		path := filepath.Join(o.moduleDir(), name)
+		if checkFileExist(path) == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no build.gradle found in %s", o.moduleDir())
+}
+
+// parseGradleDependencies returns the Maven coordinates of the runtime
+// dependencies declared in a Gradle build script, project and file
+// dependencies are ignored.
+func parseGradleDependencies(content string) []string {
+	var deps []string
+	seen := make(map[string]bool)
+	add := func(dep string) {
+		if !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+	for _, m := range gradleStringDependency.FindAllStringSubmatch(content, -1) {
+		add(m[1])
+	}
+	for _, m := range gradleMapDependency.FindAllStringSubmatch(content, -1) {
+		add(fmt.Sprintf("%s:%s:%s", m[1], m[2], m[3]))
+	}
+	return deps
+}
+
+func loadModuleDependencies() ([]string, error) {
+	path, err := opts.moduleBuildFile()
+	if err != nil {
+		return nil, err
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseGradleDependencies(string(bs)), nil
+}
+
+type edmAndroidPackage struct {
+	Spec string `xml:"spec,attr"`
+}
+
+type edmAndroidPackages struct {
+	Repositories []string            `xml:"repositories>repository,omitempty"`
+	Packages     []edmAndroidPackage `xml:"androidPackage"`
+}
+
+type edmDependencies struct {
+	XMLName         xml.Name           `xml:"dependencies"`
+	AndroidPackages edmAndroidPackages `xml:"androidPackages"`
+}
+
+func renderEdmDependencies(deps, repos []string) ([]byte, error) {
+	doc := edmDependencies{AndroidPackages: edmAndroidPackages{Repositories: repos}}
+	for _, d := range deps {
+		doc.AndroidPackages.Packages = append(doc.AndroidPackages.Packages, edmAndroidPackage{Spec: d})
+	}
+	return marshalXML(&doc)
+}
+
+func (o *Options) edmDependenciesFile(dir string) string {
+	return filepath.Join(dir, "Editor", o.AndroidModuleName+"Dependencies.xml")
+}
+
+// addEdmDependenciesFile writes the module dependencies as an External
+// Dependency Manager for Unity *Dependencies.xml file into dir/Editor.
+func addEdmDependenciesFile(dir string, deps, repos []string, backupExt string) error {
+	content, err := renderEdmDependencies(deps, repos)
+	if err != nil {
+		return err
+	}
+	path := opts.edmDependenciesFile(dir)
+	if err := makeDir(filepath.Dir(path), false); err != nil {
+		return err
+	}
+	logTrace("start generating EDM dependencies file %s ...", path)
+	return backupAndWriteFile(path, content, backupExt)
+}
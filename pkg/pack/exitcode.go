@@ -0,0 +1,89 @@
+package pack
+
+import (
+	"errors"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/zhiruili/upack/pkg/build"
+)
+
+// The exit codes tell CI what kind of failure stopped the run, a canceled
+// run exits with 128 plus the signal.
+const (
+	exitFailure = 1
+	// exitUsage is for illegal arguments and options.
+	exitUsage = 2
+	// exitEnvironment is for a missing Android project, JDK or tool, or
+	// outputs locked by another run.
+	exitEnvironment = 3
+	exitGradle      = 4
+	exitPackage     = 5
+	// exitValidation is for invalid config files, manifests and templates
+	// and stale outputs found by verify.
+	exitValidation = 6
+)
+
+// exitError gives the exit code of a failure, the errors without one exit
+// with exitFailure.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode gives err the exit code, unless it has one already.
+func withExitCode(code int, err error) error {
+	var ee *exitError
+	if err == nil || errors.As(err, &ee) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+func usageError(err error) error {
+	return withExitCode(exitUsage, err)
+}
+
+func environmentError(err error) error {
+	return withExitCode(exitEnvironment, err)
+}
+
+// exitCode returns the exit code of a run ending with err.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if code, ok := canceledExitCode(); ok {
+		return code
+	}
+	var fe *flags.Error
+	if errors.As(err, &fe) {
+		if fe.Type == flags.ErrHelp {
+			return 0
+		}
+		return exitUsage
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	var ge *build.Error
+	if errors.As(err, &ge) {
+		return exitGradle
+	}
+	return exitFailure
+}
+
+// exit ends the process with the exit code of err.
+func exit(err error) {
+	closeLogFile()
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,89 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+type renderedFile struct {
+	Path    string
+	Content []byte
+}
+
+// renderFiles renders the extra files declared in the config file for the
+// output directory out, with the same data as the manifest template.
+func renderFiles(out *outputConfig) ([]renderedFile, error) {
+	files := conf.files(out)
+	if len(files) == 0 {
+		return nil, nil
+	}
+	data, err := newManifestData(out)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]renderedFile, 0, len(files))
+	for _, f := range files {
+		if f.Template == "" || f.Path == "" {
+			return nil, fmt.Errorf("both template and path are required by files in config file")
+		}
+		if filepath.IsAbs(f.Path) || strings.HasPrefix(filepath.Clean(f.Path), "..") {
+			return nil, fmt.Errorf("file path %s must be relative to the plugin directory", f.Path)
+		}
+		content, err := loadTemplateContent(f.Template)
+		if err != nil {
+			return nil, fmt.Errorf("file template %s load fail: %w", f.Template, err)
+		}
+		tmpl, err := template.New("File:" + f.Template).Funcs(templateFuncs(data.AndroidPermissions)).Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("file template %s load fail: %w", f.Template, err)
+		}
+		if err := strictTemplate(tmpl, data, data.vars, f.Template); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("file %s generate fail: %w", f.Path, err)
+		}
+		rendered = append(rendered, renderedFile{Path: filepath.Clean(f.Path), Content: buf.Bytes()})
+	}
+	return rendered, nil
+}
+
+// writeRenderedFiles writes the rendered extra files into dir.
+func writeRenderedFiles(dir string, files []renderedFile) error {
+	for _, f := range files {
+		path := filepath.Join(dir, f.Path)
+		if err := makeDir(filepath.Dir(path), false); err != nil {
+			return err
+		}
+		logTrace("start generating file %s ...", path)
+		if err := backupAndWriteFile(path, f.Content, opts.BackupExtension); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderedFilePaths(files []renderedFile) []string {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+// addExtraMetaFiles generates .meta files for the extra files written into
+// dir and the directories created for them, paths are relative to dir.
+func addExtraMetaFiles(assetRoot, dir string, paths []string) error {
+	for _, p := range paths {
+		top := strings.SplitN(filepath.ToSlash(p), "/", 2)[0]
+		if err := addMetaFiles(assetRoot, filepath.Join(dir, top)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
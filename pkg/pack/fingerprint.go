@@ -0,0 +1,155 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+// fingerprint identifies the build a plugin output comes from, it is written
+// into every output directory so a stale Unity copy can be detected.
+type fingerprint struct {
+	Module        string `json:"module"`
+	Commit        string `json:"commit,omitempty"`
+	SourceHash    string `json:"sourceHash"`
+	AarHash       string `json:"aarHash"`
+	ToolVersion   string `json:"toolVersion"`
+	ToolCommit    string `json:"toolCommit,omitempty"`
+	ToolBuildDate string `json:"toolBuildDate,omitempty"`
+	Time          string `json:"time"`
+	// Outputs are the paths written by upack relative to the directory of
+	// the fingerprint, clean removes them.
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// newFingerprint describes the AAR just built from the sources hashed to
+// sourceHash.
+func newFingerprint(sourceHash string) (*fingerprint, error) {
+	aarHash, err := dirsync.FileHash(opts.moduleAarFile())
+	if err != nil {
+		return nil, err
+	}
+	// the commit is informative only, the project may not be a git repository
+	commit, _ := commandOutput(opts.AndroidProjectPath, "git", "rev-parse", "HEAD")
+	return &fingerprint{
+		Module:        opts.AndroidModuleName,
+		Commit:        commit,
+		SourceHash:    sourceHash,
+		AarHash:       hex.EncodeToString(aarHash),
+		ToolVersion:   toolVersion(),
+		ToolCommit:    buildCommit,
+		ToolBuildDate: buildDate,
+		Time:          time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (o *Options) fingerprintFile(dir string) string {
+	return filepath.Join(dir, o.AndroidModuleName+".fingerprint.json")
+}
+
+// readFingerprint reads the fingerprint in dir, nil is returned if there is
+// none.
+func readFingerprint(dir string) (*fingerprint, error) {
+	content, err := ioutil.ReadFile(opts.fingerprintFile(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var fp fingerprint
+	if err := json.Unmarshal(content, &fp); err != nil {
+		return nil, fmt.Errorf("illegal fingerprint %s: %w", opts.fingerprintFile(dir), err)
+	}
+	return &fp, nil
+}
+
+// sameFingerprint tells whether a and b only differ in their time.
+func sameFingerprint(a, b *fingerprint) bool {
+	x, y := *a, *b
+	x.Time, y.Time = "", ""
+	xc, xerr := json.Marshal(&x)
+	yc, yerr := json.Marshal(&y)
+	return xerr == nil && yerr == nil && bytes.Equal(xc, yc)
+}
+
+// addFingerprintFile writes fp into dir, the file is left alone if only the
+// time differs from the previous fingerprint so unchanged outputs stay
+// untouched.
+func addFingerprintFile(dir string, fp *fingerprint, backupExt string) error {
+	path := opts.fingerprintFile(dir)
+	if prev, err := readFingerprint(dir); err == nil && prev != nil && sameFingerprint(prev, fp) {
+		logTrace("%s is up to date", path)
+		return nil
+	}
+	content, err := json.MarshalIndent(fp, "", "  ")
+	if err != nil {
+		return err
+	}
+	logTrace("start generating fingerprint file %s ...", path)
+	return backupAndWriteFile(path, append(content, '\n'), backupExt)
+}
+
+// verifyFingerprint checks the plugin output in baseDir against the current
+// sources of the Android project hashed to sourceHash.
+func verifyFingerprint(baseDir, sourceHash string) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	if format == formatUpm && opts.upmPackageName() == "" {
+		// verify doesn't require the entry activity the name derives from
+		return fmt.Errorf("the UPM package of %s no found, --upm-name or --entry-activity expected", baseDir)
+	}
+	fp, err := readFingerprint(outputRootDir(format, baseDir))
+	if err != nil {
+		return err
+	}
+	if fp == nil {
+		return fmt.Errorf("no fingerprint of module %s found, pack the plugin first", opts.AndroidModuleName)
+	}
+	if fp.SourceHash != sourceHash {
+		return fmt.Errorf("stale, Android sources changed since the plugin was packed at %s", fp.Time)
+	}
+	if fp.ToolVersion != toolVersion() {
+		logWarning("%s was packed by upack %s, current is %s", baseDir, fp.ToolVersion, toolVersion())
+	}
+	fmt.Printf("%s is up to date (packed at %s)\n", baseDir, fp.Time)
+	return nil
+}
+
+type verifyCommand struct{}
+
+// Execute reports whether the plugin in each output directory given by args
+// is stale relative to the Android sources.
+func (c *verifyCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	if err := setAbsPath("Android project", &opts.AndroidProjectPath); err != nil {
+		return err
+	}
+	for i := range args {
+		if err := setAbsPath("Output directory", &args[i]); err != nil {
+			return err
+		}
+	}
+	if err := checkDirExist(opts.AndroidProjectPath); err != nil {
+		return environmentError(fmt.Errorf("Android project no found: %w", err))
+	}
+	sourceHash, err := buildCacheKey(opts.AndroidProjectPath, opts.AndroidModuleName)
+	if err != nil {
+		return fmt.Errorf("hash sources of %s: %w", opts.AndroidProjectPath, err)
+	}
+	err = forEachOutput(args, func(baseDir string) error {
+		return verifyFingerprint(baseDir, sourceHash)
+	})
+	return withExitCode(exitValidation, err)
+}
@@ -0,0 +1,58 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/build"
+)
+
+// gradleHints suggest the option fixing a failure recognized by a line of
+// the Gradle output.
+var gradleHints = []build.Hint{
+	{Match: "SDK location not found", Text: "pass --android-sdk or set ANDROID_HOME"},
+	{Match: "NDK is not installed", Text: "pass --android-ndk"},
+	{Match: "Unsupported class file major version", Text: "pick another JDK with --java-home"},
+	{Match: "requires Java 17", Text: "pick JDK 17 or later with --java-home"},
+	{Match: "Could not resolve all", Text: "check the network, or drop --offline if it is given"},
+}
+
+func (o *Options) gradleLogFile() string {
+	return filepath.Join(o.moduleDir(), "build", "upack", "gradle.log")
+}
+
+func createLogFile(path string) (*os.File, error) {
+	if err := makeDir(filepath.Dir(path), false); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+// runGradleAt runs a Gradle command in path, the output is only shown in
+// verbose mode but always saved to the Gradle log file, and a summary of it
+// is attached to the returned error.
+func runGradleAt(path string, name string, args ...string) error {
+	g := &build.Gradle{Dir: path, Name: name, Args: args, Hints: gradleHints, Runner: runCmd}
+	logFile := opts.gradleLogFile()
+	if f, err := createLogFile(logFile); err != nil {
+		logWarning("create Gradle log %s: %v", logFile, err)
+	} else {
+		defer f.Close()
+		fmt.Fprintf(f, "$ %s %s\n", name, strings.Join(args, " "))
+		g.Log, g.LogFile = f, logFile
+	}
+
+	stdout, stderr := newLogWriter("gradle", levelDebug), newLogWriter("gradle", levelDebug)
+	g.Stdout, g.Stderr = stdout, stderr
+	defer stderr.Flush()
+	defer stdout.Flush()
+	if err := g.Run(); err != nil {
+		if cerr := checkCanceled(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const markerPrefix = "upack"
+
+type markerBlock struct {
+	// Name identifies the block, the marker comments are generated from it.
+	Name string
+	// Comment is the line comment leader of the patched file.
+	Comment string
+	// Indent is prepended to every line of the block.
+	Indent string
+	Lines  []string
+}
+
+func (b *markerBlock) begin() string {
+	return fmt.Sprintf("%s %s %s begin", b.Comment, markerPrefix, b.Name)
+}
+
+func (b *markerBlock) end() string {
+	return fmt.Sprintf("%s %s %s end", b.Comment, markerPrefix, b.Name)
+}
+
+func (b *markerBlock) render() string {
+	var sb strings.Builder
+	sb.WriteString(b.Indent + b.begin() + "\n")
+	for _, l := range b.Lines {
+		sb.WriteString(b.Indent + l + "\n")
+	}
+	sb.WriteString(b.Indent + b.end() + "\n")
+	return sb.String()
+}
+
+// replaceMarkerBlock replaces an existing marked block in content, false is
+// returned if the markers are not found.
+func replaceMarkerBlock(content string, b *markerBlock) (string, bool, error) {
+	begin := strings.Index(content, b.begin())
+	if begin < 0 {
+		return content, false, nil
+	}
+	end := strings.Index(content[begin:], b.end())
+	if end < 0 {
+		return "", false, fmt.Errorf("unterminated marker %q", b.begin())
+	}
+	end += begin + len(b.end())
+	// the whole lines holding the markers are replaced
+	begin = strings.LastIndex(content[:begin], "\n") + 1
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return content[:begin] + b.render() + content[end:], true, nil
+}
+
+// gradleBlockStart returns the position right after the line opening the
+// first block of content whose path of enclosing block names, e.g.
+// "allprojects/repositories", is one of paths. Comments and strings are
+// skipped, -1 is returned if there is no such block.
+func gradleBlockStart(content string, paths ...string) int {
+	var stack []string
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case strings.HasPrefix(content[i:], "//"):
+			end := strings.IndexByte(content[i:], '\n')
+			if end < 0 {
+				return -1
+			}
+			i += end
+		case strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				return -1
+			}
+			i += end + 3
+		case c == '\'' || c == '"':
+			for i++; i < len(content) && content[i] != c; i++ {
+				if content[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{':
+			stack = append(stack, gradleBlockName(content[:i]))
+			path := strings.Join(stack, "/")
+			for _, p := range paths {
+				if path != p {
+					continue
+				}
+				end := strings.IndexByte(content[i:], '\n')
+				if end < 0 {
+					return len(content)
+				}
+				return i + end + 1
+			}
+		case c == '}':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return -1
+}
+
+// gradleBlockName returns the identifier right before the brace opening a
+// block, before is the content up to the brace.
+func gradleBlockName(before string) string {
+	before = strings.TrimRight(before, " \t\r\n")
+	start := strings.LastIndexFunc(before, func(r rune) bool {
+		return !(r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	return before[start+1:]
+}
+
+// insertInBlock inserts the block at the start of the first Gradle block
+// found at one of paths, false is returned if there is none.
+func insertInBlock(content string, b *markerBlock, paths ...string) (string, bool) {
+	pos := gradleBlockStart(content, paths...)
+	if pos < 0 {
+		return content, false
+	}
+	if pos == len(content) && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+		pos++
+	}
+	return content[:pos] + b.render() + content[pos:], true
+}
+
+// insertBefore inserts the block in a new line right before the first
+// occurrence of placeholder, false is returned if there is none.
+func insertBefore(content, placeholder string, b *markerBlock) (string, bool) {
+	pos := strings.Index(content, placeholder)
+	if pos < 0 {
+		return content, false
+	}
+	prefix := content[:pos]
+	if len(prefix) > 0 && !strings.HasSuffix(prefix, "\n") {
+		prefix += "\n"
+	}
+	return prefix + b.render() + content[pos:], true
+}
+
+// removeMarkerBlock removes the marked block and the lines of its markers
+// from content.
+func removeMarkerBlock(content string, b *markerBlock) (string, error) {
+	empty := &markerBlock{Name: b.Name, Comment: b.Comment}
+	c, ok, err := replaceMarkerBlock(content, empty)
+	if err != nil || !ok {
+		return content, err
+	}
+	return strings.Replace(c, empty.render(), "", 1), nil
+}
+
+func appendBlock(content string, b *markerBlock) string {
+	if len(content) > 0 && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + b.render()
+}
+
+// patchFile rewrites path with patch, the file is untouched if the patch
+// changes nothing so repeated runs don't produce churn.
+func patchFile(path string, backupExt string, patch func(string) (string, error)) error {
+	origin, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	content, err := patch(string(origin))
+	if err != nil {
+		return fmt.Errorf("patch %s: %w", path, err)
+	}
+	if bytes.Equal(origin, []byte(content)) {
+		logTrace("%s is up to date", path)
+		return nil
+	}
+	logDebug("patching %s", path)
+	return backupAndWriteFile(path, []byte(content), backupExt)
+}
+
+const (
+	gradleDepsPlaceholder            = "**DEPS**"
+	gradleBuildScriptDepsPlaceholder = "**BUILD_SCRIPT_DEPS**"
+	gradlePropertiesPlaceholder      = "**ADDITIONAL_PROPERTIES**"
+	gradleIndent                     = "    "
+)
+
+func gradleDependencyLines(configuration string, deps []string) []string {
+	lines := make([]string, 0, len(deps))
+	for _, d := range deps {
+		lines = append(lines, fmt.Sprintf("%s '%s'", configuration, d))
+	}
+	return lines
+}
+
+func gradleRepositoryLines(repos []string) []string {
+	lines := make([]string, 0, len(repos))
+	for _, r := range repos {
+		lines = append(lines, fmt.Sprintf("maven { url '%s' }", r))
+	}
+	return lines
+}
+
+// patchGradleDependencies inserts deps of the given configuration right
+// before placeholder if the template has one, or else into the first
+// dependencies block at the path block, "dependencies" for the top-level one
+// and "buildscript/dependencies" for the build script one.
+func patchGradleDependencies(content, configuration, placeholder, indent, block string, deps []string) (string, error) {
+	b := &markerBlock{
+		Name:    "dependencies",
+		Comment: "//",
+		Indent:  indent,
+		Lines:   gradleDependencyLines(configuration, deps),
+	}
+	if len(deps) == 0 {
+		return removeMarkerBlock(content, b)
+	}
+	if c, ok, err := replaceMarkerBlock(content, b); err != nil || ok {
+		return c, err
+	}
+	if c, ok := insertBefore(content, placeholder, b); ok {
+		return c, nil
+	}
+	if c, ok := insertInBlock(content, b, block); ok {
+		return c, nil
+	}
+	return "", fmt.Errorf("no %s block found", block)
+}
+
+// patchGradleRepositories inserts repos into the repositories block of
+// allprojects or the top-level one, those of buildscript only resolve Gradle
+// plugins. A block of its own is appended if the template has none.
+func patchGradleRepositories(content string, repos []string) (string, error) {
+	lines := gradleRepositoryLines(repos)
+	b := &markerBlock{
+		Name:    "repositories",
+		Comment: "//",
+		Indent:  gradleIndent + gradleIndent,
+		Lines:   lines,
+	}
+	// a standalone repositories block is added when the template has none
+	wrapped := &markerBlock{
+		Name:    "repositories block",
+		Comment: "//",
+		Lines:   []string{"repositories {"},
+	}
+	for _, l := range lines {
+		wrapped.Lines = append(wrapped.Lines, gradleIndent+l)
+	}
+	wrapped.Lines = append(wrapped.Lines, "}")
+
+	if len(repos) == 0 {
+		c, err := removeMarkerBlock(content, b)
+		if err != nil {
+			return "", err
+		}
+		return removeMarkerBlock(c, wrapped)
+	}
+	if c, ok, err := replaceMarkerBlock(content, b); err != nil || ok {
+		return c, err
+	}
+	if c, ok, err := replaceMarkerBlock(content, wrapped); err != nil || ok {
+		return c, err
+	}
+	if c, ok := insertInBlock(content, b, "allprojects/repositories", "repositories"); ok {
+		return c, nil
+	}
+	return appendBlock(content, wrapped), nil
+}
+
+// gradleProperties returns the properties to set in gradleTemplate.properties,
+// the --androidx switch expands to the AndroidX and Jetifier properties.
+func gradleProperties() []string {
+	var props []string
+	if opts.AndroidX {
+		props = append(props, "android.useAndroidX=true", "android.enableJetifier=true")
+	}
+	return append(props, opts.GradleProperties...)
+}
+
+func patchGradleProperties(content string, props []string) (string, error) {
+	b := &markerBlock{
+		Name:    "properties",
+		Comment: "#",
+		Lines:   props,
+	}
+	if len(props) == 0 {
+		return removeMarkerBlock(content, b)
+	}
+	if c, ok, err := replaceMarkerBlock(content, b); err != nil || ok {
+		return c, err
+	}
+	if c, ok := insertBefore(content, gradlePropertiesPlaceholder, b); ok {
+		return c, nil
+	}
+	return appendBlock(content, b), nil
+}
+
+func checkTemplateExist(path, name string) error {
+	if err := checkFileExist(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s no found, enable %s in Unity player settings first", path, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// patchTemplate patches the template at path. A missing template is only an
+// error if there is something to add, the blocks of earlier runs are removed
+// when there is nothing.
+func patchTemplate(path, name string, empty bool, patch func(string) (string, error)) error {
+	if _, err := os.Stat(path); empty && os.IsNotExist(err) {
+		return nil
+	}
+	if err := checkTemplateExist(path, name); err != nil {
+		return err
+	}
+	return patchFile(path, opts.BackupExtension, patch)
+}
+
+// patchGradlePropertiesTemplate sets the properties required by the plugin
+// in gradleTemplate.properties.
+func patchGradlePropertiesTemplate(templateDir string) error {
+	props := gradleProperties()
+	path := filepath.Join(templateDir, "gradleTemplate.properties")
+	return patchTemplate(path, "Custom Gradle Properties Template", len(props) == 0, func(content string) (string, error) {
+		return patchGradleProperties(content, props)
+	})
+}
+
+// patchLauncherTemplate inserts the dependencies of the launcher module into
+// launcherTemplate.gradle.
+func patchLauncherTemplate(templateDir string) error {
+	path := filepath.Join(templateDir, "launcherTemplate.gradle")
+	return patchTemplate(path, "Custom Launcher Gradle Template", len(opts.LauncherDependencies) == 0, func(content string) (string, error) {
+		return patchGradleDependencies(content, "implementation", gradleDepsPlaceholder, gradleIndent, "dependencies", opts.LauncherDependencies)
+	})
+}
+
+// patchBaseProjectTemplate inserts the build script classpath entries, e.g.
+// Gradle plugins the packaged plugin relies on, into
+// baseProjectTemplate.gradle.
+func patchBaseProjectTemplate(templateDir string) error {
+	path := filepath.Join(templateDir, "baseProjectTemplate.gradle")
+	return patchTemplate(path, "Custom Base Gradle Template", len(opts.BaseProjectClasspath) == 0, func(content string) (string, error) {
+		return patchGradleDependencies(content, "classpath", gradleBuildScriptDepsPlaceholder, gradleIndent+gradleIndent, "buildscript/dependencies", opts.BaseProjectClasspath)
+	})
+}
+
+// unityTemplateDir returns the directory holding the custom Gradle templates
+// of the Unity project baseDir belongs to.
+func unityTemplateDir(baseDir string) string {
+	projectDir := findUnityProject(baseDir)
+	if projectDir == "" {
+		return baseDir
+	}
+	return filepath.Join(projectDir, "Assets", "Plugins", "Android")
+}
+
+// patchMainTemplate inserts the Maven dependencies and repositories of the
+// plugin into mainTemplate.gradle.
+func patchMainTemplate(templateDir string) error {
+	path := filepath.Join(templateDir, "mainTemplate.gradle")
+	empty := len(opts.GradleDependencies) == 0 && len(opts.GradleRepositories) == 0
+	return patchTemplate(path, "Custom Main Gradle Template", empty, func(content string) (string, error) {
+		content, err := patchGradleDependencies(content, "implementation", gradleDepsPlaceholder, gradleIndent, "dependencies", opts.GradleDependencies)
+		if err != nil {
+			return "", err
+		}
+		return patchGradleRepositories(content, opts.GradleRepositories)
+	})
+}
+
+// templateLock serializes patching, output directories in the same Unity
+// project share the templates.
+var templateLock sync.Mutex
+
+// patchUnityTemplates patches the custom Gradle templates of the Unity
+// project baseDir belongs to.
+func patchUnityTemplates(baseDir string) error {
+	templateLock.Lock()
+	defer templateLock.Unlock()
+	templateDir := unityTemplateDir(baseDir)
+	logTrace("start patching Gradle templates in %s ...", templateDir)
+	if err := patchMainTemplate(templateDir); err != nil {
+		return err
+	}
+	if err := patchGradlePropertiesTemplate(templateDir); err != nil {
+		return err
+	}
+	if err := patchLauncherTemplate(templateDir); err != nil {
+		return err
+	}
+	if err := patchBaseProjectTemplate(templateDir); err != nil {
+		return err
+	}
+	return patchProguardUserFile(templateDir)
+}
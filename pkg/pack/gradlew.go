@@ -0,0 +1,202 @@
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/zhiruili/upack/pkg/aar"
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+const gradleDistributionsURL = "https://services.gradle.org/distributions"
+
+func gradleWrapperName() string {
+	if runtime.GOOS == "windows" {
+		return "gradlew.bat"
+	}
+	return "gradlew"
+}
+
+// gradleCommand returns the Gradle wrapper of the Android project, the
+// gradlew found in PATH is used if the project has none.
+func gradleCommand(projectDir string) string {
+	path := filepath.Join(projectDir, gradleWrapperName())
+	if checkFileExist(path) == nil {
+		return path
+	}
+	return "gradlew"
+}
+
+func gradleCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "upack", "gradle"), nil
+}
+
+func httpGet(url string, timeout time.Duration) (*http.Response, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// fetchChecksum downloads the published SHA-256 checksum of url.
+func fetchChecksum(url string) (string, error) {
+	resp, err := httpGet(url+".sha256", 30*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	sum := strings.TrimSpace(string(body))
+	if len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("illegal checksum %q of %s", sum, url)
+	}
+	return sum, nil
+}
+
+// downloadFile downloads url to dstFile, which is only written if the content
+// matches the SHA-256 checksum sum.
+func downloadFile(url, dstFile, sum string) error {
+	resp, err := httpGet(url, 30*time.Minute)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dstFile), "download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("checksum mismatch of %s, expect %s but got %s", url, sum, got)
+	}
+	return moveFile(tmp.Name(), dstFile)
+}
+
+// gradleDistribution returns the gradle command of the given version, the
+// distribution is downloaded into the user cache once and verified with its
+// published checksum, which is returned too.
+func gradleDistribution(version string) (string, string, error) {
+	url := fmt.Sprintf("%s/gradle-%s-bin.zip", gradleDistributionsURL, version)
+	sum, err := fetchChecksum(url)
+	if err != nil {
+		return "", "", err
+	}
+
+	cacheDir, err := gradleCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir := filepath.Join(cacheDir, "gradle-"+version+"-"+sum[:12])
+	gradle := filepath.Join(dir, "gradle-"+version, "bin", "gradle")
+	if runtime.GOOS == "windows" {
+		gradle += ".bat"
+	}
+	if checkFileExist(gradle) == nil {
+		return gradle, sum, nil
+	}
+
+	if err := makeDir(cacheDir, false); err != nil {
+		return "", "", err
+	}
+	zipFile := dir + ".zip"
+	logDebug("downloading Gradle %s from %s ...", version, url)
+	if err := downloadFile(url, zipFile, sum); err != nil {
+		return "", "", err
+	}
+	defer os.Remove(zipFile)
+	if err := cleanAndUnzipFile(zipFile, dir, "", aar.KeepAll); err != nil {
+		return "", "", err
+	}
+	return gradle, sum, nil
+}
+
+// verifyGradleWrapper checks the wrapper jar of the Android project against
+// the checksum published for the Gradle version.
+func verifyGradleWrapper(projectDir, version string) error {
+	want, err := fetchChecksum(fmt.Sprintf("%s/gradle-%s-wrapper.jar", gradleDistributionsURL, version))
+	if err != nil {
+		return err
+	}
+	jarFile := filepath.Join(projectDir, "gradle", "wrapper", "gradle-wrapper.jar")
+	got, err := dirsync.FileHash(jarFile)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(got) != want {
+		return fmt.Errorf("checksum mismatch of %s, expect %s but got %x", jarFile, want, got)
+	}
+	return nil
+}
+
+// bootstrapGradleWrapper generates the Gradle wrapper of the given version
+// into the Android project if it has none.
+func bootstrapGradleWrapper(projectDir, version string) error {
+	if checkFileExist(filepath.Join(projectDir, gradleWrapperName())) == nil {
+		return nil
+	}
+	logDebug("no Gradle wrapper found in %s, bootstrapping Gradle %s ...", projectDir, version)
+	var gradle, sum string
+	err := withRetries("download Gradle "+version, func() (err error) {
+		gradle, sum, err = gradleDistribution(version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("download Gradle %s: %w", version, err)
+	}
+	if err := runGradleAt(projectDir, gradle, "wrapper",
+		"--gradle-version", version,
+		"--distribution-type", "bin",
+		"--gradle-distribution-sha256-sum", sum); err != nil {
+		return fmt.Errorf("generate Gradle wrapper fail %w", err)
+	}
+	if err := verifyGradleWrapper(projectDir, version); err != nil {
+		// an unverified wrapper must not be picked up by later runs
+		removeGradleWrapper(projectDir)
+		return fmt.Errorf("verify Gradle wrapper: %w", err)
+	}
+	return nil
+}
+
+func removeGradleWrapper(projectDir string) {
+	for _, name := range []string{
+		"gradlew",
+		"gradlew.bat",
+		filepath.Join("gradle", "wrapper", "gradle-wrapper.jar"),
+		filepath.Join("gradle", "wrapper", "gradle-wrapper.properties"),
+	} {
+		if err := os.Remove(filepath.Join(projectDir, name)); err != nil && !os.IsNotExist(err) {
+			logWarning("remove %s: %v", name, err)
+		}
+	}
+}
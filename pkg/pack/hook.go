@@ -0,0 +1,98 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	hookPreBuild  = "pre-build"
+	hookPostBuild = "post-build"
+	hookPrePack   = "pre-pack"
+	hookPostPack  = "post-pack"
+)
+
+// hooksConfig holds the hooks section of the config file, the shell commands
+// run around the build and the packing of each output.
+type hooksConfig struct {
+	PreBuild  []string `yaml:"pre-build"`
+	PostBuild []string `yaml:"post-build"`
+	PrePack   []string `yaml:"pre-pack"`
+	PostPack  []string `yaml:"post-pack"`
+}
+
+func (c *hooksConfig) commands(hook string) []string {
+	switch hook {
+	case hookPreBuild:
+		return c.PreBuild
+	case hookPostBuild:
+		return c.PostBuild
+	case hookPrePack:
+		return c.PrePack
+	case hookPostPack:
+		return c.PostPack
+	}
+	return nil
+}
+
+func checkHooksConfig(c *hooksConfig) error {
+	for _, hook := range []string{hookPreBuild, hookPostBuild, hookPrePack, hookPostPack} {
+		for _, script := range c.commands(hook) {
+			if strings.TrimSpace(script) == "" {
+				return fmt.Errorf("empty %s hook", hook)
+			}
+		}
+	}
+	return nil
+}
+
+// hookEnv describes the run to the hooks, the output variables are only set
+// for the hooks of an output directory, baseDir is "" otherwise.
+func hookEnv(hook string, baseDirs []string, baseDir string) ([]string, error) {
+	env := append([]string{"UPACK_HOOK=" + hook}, runEnv()...)
+	env = append(env, "UPACK_OUTPUTS="+strings.Join(baseDirs, string(os.PathListSeparator)))
+	if baseDir == "" {
+		return env, nil
+	}
+	outputEnv, err := outputEnv(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return append(env, outputEnv...), nil
+}
+
+// outputEnv describes the output directory baseDir to the commands run for
+// it.
+func outputEnv(baseDir string) ([]string, error) {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		"UPACK_OUTPUT_DIR=" + baseDir,
+		"UPACK_OUTPUT_FORMAT=" + format,
+		"UPACK_PLUGIN_DIR=" + pluginDir(format, baseDir),
+	}, nil
+}
+
+// runHooks runs the commands of hook in the directory of the config file,
+// the first failing one fails the run.
+func runHooks(hook string, baseDirs []string, baseDir string) error {
+	scripts := conf.Hooks.commands(hook)
+	if len(scripts) == 0 {
+		return nil
+	}
+	defer timePhase("hooks")()
+	env, err := hookEnv(hook, baseDirs, baseDir)
+	if err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		logDebug("running %s hook: %s", hook, script)
+		if err := runCommand(hook, script, env); err != nil {
+			return fmt.Errorf("%s hook %s fail %w", hook, script, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	ignoreFileName = ".upackignore"
+	// regexpPatternPrefix marks a pattern as a regular expression matched
+	// against the whole slash separated path instead of a glob.
+	regexpPatternPrefix = "re:"
+	// containsPatternPrefix marks a pattern as a string matching the paths
+	// containing it instead of a glob.
+	containsPatternPrefix = "contains:"
+)
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreList filters archive entries with gitignore-style patterns, the last
+// matching pattern decides and a ! prefix negates it.
+type ignoreList struct {
+	rules []ignoreRule
+}
+
+// unityClassPatterns matches the classes of the Unity player which are
+// provided by Unity's own classes.jar at build time and must not be shipped
+// by plugins.
+var unityClassPatterns = []string{
+	"com/unity3d/player/",
+	"UnityPlayer*.class",
+	"bitter/jnibridge/",
+	"org/fmod/",
+}
+
+// signaturePatterns matches the jar signature files, which are stale once the
+// jar is repackaged, and the Kotlin module metadata.
+var signaturePatterns = []string{
+	"META-INF/*.SF",
+	"META-INF/*.RSA",
+	"META-INF/*.DSA",
+	"META-INF/*.EC",
+	"*.kotlin_module",
+}
+
+var (
+	// ignores holds the patterns of the ignore file, nil if there is none.
+	ignores *ignoreList
+	// jarRemovals holds the patterns of jar content removal options.
+	jarRemovals *ignoreList
+	// jarKeeps holds the patterns of jar content allowlist options.
+	jarKeeps *ignoreList
+)
+
+// globToRegexp translates a gitignore-style glob into a regular expression
+// matching slash separated paths.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(glob, "/"), "/")
+	glob = strings.TrimPrefix(glob, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				sb.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func parseIgnoreRule(line string) (*ignoreRule, error) {
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasPrefix(line, containsPatternPrefix) {
+		r.re = regexp.MustCompile(regexp.QuoteMeta(strings.TrimPrefix(line, containsPatternPrefix)))
+		return &r, nil
+	}
+	if strings.HasPrefix(line, regexpPatternPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(line, regexpPatternPrefix))
+		if err != nil {
+			return nil, err
+		}
+		r.re = re
+		return &r, nil
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	re, err := globToRegexp(line)
+	if err != nil {
+		return nil, err
+	}
+	r.re = re
+	return &r, nil
+}
+
+// newIgnoreList compiles patterns given by options, nil is returned if there
+// is none.
+func newIgnoreList(patterns []string) (*ignoreList, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	var l ignoreList
+	for _, p := range patterns {
+		r, err := parseIgnoreRule(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		l.rules = append(l.rules, *r)
+	}
+	return &l, nil
+}
+
+func parseIgnoreList(content []byte) (*ignoreList, error) {
+	var l ignoreList
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseIgnoreRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		l.rules = append(l.rules, *r)
+	}
+	return &l, s.Err()
+}
+
+// loadIgnoreList loads the ignore file given by options, or the one in the
+// module directory if there is any.
+func loadIgnoreList() (*ignoreList, error) {
+	path := opts.IgnoreFile
+	if path == "" {
+		path = filepath.Join(opts.moduleDir(), ignoreFileName)
+		if err := checkFileExist(path); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+	logDebug("ignore file at: %s", path)
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l, err := parseIgnoreList(bs)
+	if err != nil {
+		return nil, fmt.Errorf("parse ignore file %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *ignoreList) matchSelf(path string, isDir bool) bool {
+	ignored := false
+	for _, r := range l.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(path) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// match tells whether path is ignored, like git a path in an ignored
+// directory can't be included again.
+func (l *ignoreList) match(path string, isDir bool) bool {
+	if l == nil || len(l.rules) == 0 {
+		return false
+	}
+	path = strings.Trim(filepath.ToSlash(path), "/")
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && l.matchSelf(path[:i], true) {
+			return true
+		}
+	}
+	return l.matchSelf(path, isDir)
+}
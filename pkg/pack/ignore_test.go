@@ -0,0 +1,157 @@
+package pack
+
+import "testing"
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		// a glob without a slash matches the name at any depth
+		{"*.class", "Main.class", true},
+		{"*.class", "com/example/Main.class", true},
+		{"*.class", "com/example/Main.classes", false},
+		{"UnityPlayer*.class", "com/unity3d/player/UnityPlayerActivity.class", true},
+		// a glob with a slash is anchored at the root
+		{"META-INF/*.SF", "META-INF/CERT.SF", true},
+		{"META-INF/*.SF", "lib/META-INF/CERT.SF", false},
+		{"/Main.class", "Main.class", true},
+		{"/Main.class", "com/Main.class", false},
+		// * and ? stay within a path segment, ** crosses them
+		{"com/*/Main.class", "com/example/Main.class", true},
+		{"com/*/Main.class", "com/example/sub/Main.class", false},
+		{"com/**/Main.class", "com/Main.class", true},
+		{"com/**/Main.class", "com/example/sub/Main.class", true},
+		{"**/R.class", "R.class", true},
+		{"**/R.class", "com/example/R.class", true},
+		{"com/**", "com/example/sub/Main.class", true},
+		{"com/**", "org/Main.class", false},
+		{"R?.class", "R1.class", true},
+		{"R?.class", "R/.class", false},
+		{"R?.class", "R12.class", false},
+		// character classes
+		{"R[0-9].class", "R7.class", true},
+		{"R[0-9].class", "Rx.class", false},
+		{"R[!0-9].class", "Rx.class", true},
+		{"R[!0-9].class", "R7.class", false},
+		// regexp metacharacters and escapes are literal
+		{"BuildConfig.class", "BuildConfigXclass", false},
+		{"a+b(c).txt", "a+b(c).txt", true},
+		{`\*.class`, "*.class", true},
+		{`\*.class`, "Main.class", false},
+		{`R\?.class`, "R?.class", true},
+		{`R\?.class`, "R1.class", false},
+		// the whole path is matched, not a part of it
+		{"Main", "Main.class", false},
+		{"example", "com/example/Main.class", false},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Errorf("globToRegexp(%q) = %v", tt.glob, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("%q (%s) matches %q = %v, want %v", tt.glob, re, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestGlobToRegexpErrors(t *testing.T) {
+	for _, glob := range []string{"R[0-9.class", "["} {
+		if _, err := globToRegexp(glob); err == nil {
+			t.Errorf("globToRegexp(%q) succeeded, error expected", glob)
+		}
+	}
+}
+
+func TestIgnoreListMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		match    bool
+	}{
+		{name: "unity player class", patterns: unityClassPatterns, path: "com/unity3d/player/UnityPlayer.class", match: true},
+		{name: "unity player package", patterns: unityClassPatterns, path: "com/unity3d/player", isDir: true, match: true},
+		{name: "unity player class elsewhere", patterns: unityClassPatterns, path: "com/example/UnityPlayerBridge.class", match: true},
+		{name: "fmod classes", patterns: unityClassPatterns, path: "org/fmod/FMOD.class", match: true},
+		{name: "plugin class", patterns: unityClassPatterns, path: "com/example/Main.class"},
+		{name: "signature file", patterns: signaturePatterns, path: "META-INF/CERT.SF", match: true},
+		{name: "nested signature file", patterns: signaturePatterns, path: "lib/META-INF/CERT.SF"},
+		{name: "kotlin module", patterns: signaturePatterns, path: "META-INF/app_release.kotlin_module", match: true},
+		{name: "manifest kept", patterns: signaturePatterns, path: "META-INF/MANIFEST.MF"},
+		{name: "whole path of a plain pattern", patterns: []string{"META-INF/CERT"}, path: "META-INF/CERT.SF"},
+		{name: "contains", patterns: []string{"contains:BuildConfig"}, path: "com/example/BuildConfig.class", match: true},
+		{name: "contains is literal", patterns: []string{"contains:Build.onfig"}, path: "com/example/BuildConfig.class"},
+		{name: "regexp", patterns: []string{`re:^com/example/R(\$.*)?\.class$`}, path: "com/example/R$string.class", match: true},
+		{name: "regexp not matching", patterns: []string{`re:^com/example/R(\$.*)?\.class$`}, path: "com/example/Rx.class"},
+		{name: "directory pattern skips files", patterns: []string{"build/"}, path: "build"},
+		{name: "directory pattern", patterns: []string{"build/"}, path: "build", isDir: true, match: true},
+		{name: "file in ignored directory", patterns: []string{"build/"}, path: "build/Main.class", match: true},
+		{name: "last pattern decides", patterns: []string{"*.class", "!Main.class"}, path: "com/example/Main.class"},
+		{name: "negated then ignored again", patterns: []string{"*.class", "!Main.class", "com/**"}, path: "com/example/Main.class", match: true},
+		{name: "no reinclusion in ignored directory", patterns: []string{"com/unity3d/", "!com/unity3d/Keep.class"}, path: "com/unity3d/Keep.class", match: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newIgnoreList(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := l.match(tt.path, tt.isDir); got != tt.match {
+				t.Errorf("match(%q) = %v, want %v", tt.path, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestIgnoreListEmpty(t *testing.T) {
+	var l *ignoreList
+	if l.match("com/example/Main.class", false) {
+		t.Error("nil list matches")
+	}
+	l, err := newIgnoreList(nil)
+	if err != nil || l != nil {
+		t.Errorf("newIgnoreList(nil) = %v, %v", l, err)
+	}
+	if _, err := newIgnoreList([]string{"re:("}); err == nil {
+		t.Error("illegal regexp accepted")
+	}
+}
+
+func TestKeepJarEntry(t *testing.T) {
+	defer func(i, r, k *ignoreList) { ignores, jarRemovals, jarKeeps = i, r, k }(ignores, jarRemovals, jarKeeps)
+	var err error
+	if ignores, err = newIgnoreList([]string{"*.kotlin_module"}); err != nil {
+		t.Fatal(err)
+	}
+	if jarRemovals, err = newIgnoreList(append([]string{"contains:BuildConfig"}, unityClassPatterns...)); err != nil {
+		t.Fatal(err)
+	}
+	if jarKeeps, err = newIgnoreList([]string{"com/example/**", "META-INF/services/*"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		keep  bool
+	}{
+		{"com/example/Main.class", false, true},
+		{"com/example/BuildConfig.class", false, false},
+		{"com/unity3d/player/UnityPlayer.class", false, false},
+		{"com/unity3d/player", true, false},
+		{"META-INF/services/com.example.Factory", false, true},
+		{"META-INF/app.kotlin_module", false, false},
+		{"org/other/Lib.class", false, false},
+		// directories are walked anyway, their files are checked one by one
+		{"org/other", true, true},
+	}
+	for _, tt := range tests {
+		if got := keepJarEntry(tt.path, tt.isDir); got != tt.keep {
+			t.Errorf("keepJarEntry(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.keep)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/aar"
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+type inspectCommand struct{}
+
+// treeNode is a line of the tree printed by inspect.
+type treeNode struct {
+	label    string
+	children []*treeNode
+}
+
+func (n *treeNode) add(f string, a ...interface{}) *treeNode {
+	c := &treeNode{label: fmt.Sprintf(f, a...)}
+	n.children = append(n.children, c)
+	return c
+}
+
+// addPath adds the nodes of the slash separated path under n, the ones
+// already there are reused. The node of the last element is returned.
+func (n *treeNode) addPath(p string) *treeNode {
+	for _, name := range strings.Split(p, "/") {
+		var next *treeNode
+		for _, c := range n.children {
+			if c.label == name {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			next = n.add("%s", name)
+		}
+		n = next
+	}
+	return n
+}
+
+func (n *treeNode) print(prefix string) {
+	for i, c := range n.children {
+		branch, indent := "├── ", "│   "
+		if i == len(n.children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Printf("%s%s%s\n", prefix, branch, c.label)
+		c.print(prefix + indent)
+	}
+}
+
+func formatSize(size uint64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// inspectManifest adds the package, SDK versions and permissions declared by
+// the manifest of the AAR under n.
+func inspectManifest(n *treeNode, content []byte) error {
+	root, err := manifest.Parse(content)
+	if err != nil {
+		return fmt.Errorf("parse manifest: %w", err)
+	}
+	if root == nil {
+		return fmt.Errorf("empty manifest")
+	}
+	if pkg := root.Package(); pkg != "" {
+		n.add("package: %s", pkg)
+	}
+	if sdk := root.Child("uses-sdk"); sdk != nil {
+		for _, attr := range []string{"minSdkVersion", "targetSdkVersion"} {
+			if v, ok := sdk.AndroidAttr(attr); ok {
+				n.add("%s: %s", attr, v)
+			}
+		}
+	}
+	var permissions []string
+	for _, c := range root.Children {
+		if c.Name.Local != "uses-permission" && c.Name.Local != "uses-permission-sdk-23" {
+			continue
+		}
+		if name, ok := c.AndroidAttr("name"); ok {
+			permissions = append(permissions, name)
+		}
+	}
+	if len(permissions) == 0 {
+		n.add("permissions: none")
+		return nil
+	}
+	perms := n.add("permissions")
+	for _, p := range permissions {
+		perms.add("%s", p)
+	}
+	return nil
+}
+
+// inspectAar prints the contents of the AAR at aarFile as a tree.
+func inspectAar(aarFile string) error {
+	r, err := zip.OpenReader(aarFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var total uint64
+	var manifest []byte
+	abis := make(map[string][]string)
+	contents, jars := &treeNode{}, &treeNode{}
+	for _, f := range r.File {
+		name := strings.TrimSuffix(f.Name, "/")
+		if f.FileInfo().IsDir() {
+			contents.addPath(name)
+			continue
+		}
+		total += f.UncompressedSize64
+		node := contents.addPath(name)
+		node.label = fmt.Sprintf("%s (%s)", node.label, formatSize(f.UncompressedSize64))
+
+		switch {
+		case name == "AndroidManifest.xml":
+			if manifest, err = aar.ReadEntry(f); err != nil {
+				return err
+			}
+		case isNestedJarEntry(name):
+			content, err := aar.ReadEntry(f)
+			if err != nil {
+				return err
+			}
+			jar, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				return fmt.Errorf("open %s in %s: %w", name, aarFile, err)
+			}
+			jars.add("%s: %d classes", name, len(jarClasses(jar)))
+		case strings.HasPrefix(name, "jni/") && path.Ext(name) == ".so":
+			parts := strings.Split(name, "/")
+			if len(parts) >= 3 {
+				abis[parts[1]] = append(abis[parts[1]], path.Base(name))
+			}
+		}
+	}
+
+	tree := &treeNode{}
+	if manifest == nil {
+		tree.add("manifest: none")
+	} else if err := inspectManifest(tree, manifest); err != nil {
+		return fmt.Errorf("%s: %w", aarFile, err)
+	}
+	if len(abis) == 0 {
+		tree.add("ABIs: none")
+	} else {
+		names := make([]string, 0, len(abis))
+		for abi := range abis {
+			names = append(names, abi)
+		}
+		sort.Strings(names)
+		node := tree.add("ABIs")
+		for _, abi := range names {
+			node.add("%s: %s", abi, strings.Join(abis[abi], ", "))
+		}
+	}
+	if len(jars.children) == 0 {
+		tree.add("jars: none")
+	} else {
+		tree.add("jars").children = jars.children
+	}
+	tree.add("contents").children = contents.children
+
+	printHeader("%s (%d entries, %s)", aarFile, len(r.File), formatSize(total))
+	tree.print("")
+	if manifest != nil {
+		printHeader("embedded AndroidManifest.xml:")
+		for _, l := range strings.Split(strings.TrimRight(string(manifest), "\n"), "\n") {
+			fmt.Printf("    %s\n", strings.TrimRight(l, "\r"))
+		}
+	}
+	return nil
+}
+
+// Execute prints what each AAR given by args holds, it needs no Android
+// project.
+func (c *inspectCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return usageError(fmt.Errorf("inspect requires the path of an AAR"))
+	}
+	for _, aarFile := range args {
+		if err := checkFileExist(aarFile); err != nil {
+			return fmt.Errorf("AAR no found: %w", err)
+		}
+		if err := inspectAar(aarFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
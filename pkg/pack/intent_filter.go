@@ -0,0 +1,179 @@
+package pack
+
+import (
+	"fmt"
+	"strings"
+)
+
+type intentData struct {
+	Scheme      string `yaml:"scheme"`
+	Host        string `yaml:"host"`
+	Port        string `yaml:"port"`
+	Path        string `yaml:"path"`
+	PathPrefix  string `yaml:"path-prefix"`
+	PathPattern string `yaml:"path-pattern"`
+	MimeType    string `yaml:"mime-type"`
+}
+
+// Attrs is used by manifest templates, it returns the android attributes of
+// the data element in a stable order.
+func (d *intentData) Attrs() []keyValue {
+	var attrs []keyValue
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, keyValue{Key: key, Value: value})
+		}
+	}
+	add("scheme", d.Scheme)
+	add("host", d.Host)
+	add("port", d.Port)
+	add("path", d.Path)
+	add("pathPrefix", d.PathPrefix)
+	add("pathPattern", d.PathPattern)
+	add("mimeType", d.MimeType)
+	return attrs
+}
+
+// field returns the field of d set by the intent filter spec key.
+func (d *intentData) field(key string) *string {
+	switch key {
+	case "scheme":
+		return &d.Scheme
+	case "host":
+		return &d.Host
+	case "port":
+		return &d.Port
+	case "path":
+		return &d.Path
+	case "path-prefix":
+		return &d.PathPrefix
+	case "path-pattern":
+		return &d.PathPattern
+	case "mime-type":
+		return &d.MimeType
+	}
+	return nil
+}
+
+type intentFilter struct {
+	// Activity is the activity the filter belongs to, the entry activity by
+	// default.
+	Activity   string       `yaml:"activity"`
+	Actions    []string     `yaml:"actions"`
+	Categories []string     `yaml:"categories"`
+	Data       []intentData `yaml:"data"`
+	AutoVerify bool         `yaml:"auto-verify"`
+}
+
+// parseIntentFilter parses intent filters given by flags like
+// action=android.intent.action.VIEW,category=android.intent.category.BROWSABLE,scheme=myapp,
+// a data key given again starts a new data element.
+func parseIntentFilter(spec string) (intentFilter, error) {
+	var f intentFilter
+	var data *intentData
+	for _, item := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return f, fmt.Errorf("illegal intent filter %s, key=value expected in %s", spec, item)
+		}
+		key, value := kv[0], kv[1]
+		switch key {
+		case "activity":
+			f.Activity = value
+		case "action":
+			f.Actions = append(f.Actions, value)
+		case "category":
+			f.Categories = append(f.Categories, value)
+		case "auto-verify":
+			f.AutoVerify = value == "true"
+		default:
+			if (&intentData{}).field(key) == nil {
+				return f, fmt.Errorf("illegal intent filter %s, unknown key %s", spec, key)
+			}
+			if data == nil || *data.field(key) != "" {
+				f.Data = append(f.Data, intentData{})
+				data = &f.Data[len(f.Data)-1]
+			}
+			*data.field(key) = value
+		}
+	}
+	if len(f.Actions) == 0 {
+		return f, fmt.Errorf("illegal intent filter %s, no action given", spec)
+	}
+	return f, nil
+}
+
+type activityFilters struct {
+	Name          string
+	IntentFilters []intentFilter
+}
+
+// intentFilters returns the intent filters given by both flags and the config
+// file.
+func (o *Options) intentFilters() ([]intentFilter, error) {
+	filters := append([]intentFilter{}, conf.IntentFilters...)
+	for _, spec := range o.IntentFilters {
+		f, err := parseIntentFilter(spec)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// EntryIntentFilters is used by manifest templates, it returns the extra
+// intent filters of the entry activity.
+func (o *Options) EntryIntentFilters() ([]intentFilter, error) {
+	filters, err := o.intentFilters()
+	if err != nil {
+		return nil, err
+	}
+	var entry []intentFilter
+	for _, f := range filters {
+		if f.Activity == "" || f.Activity == o.AndroidEntryActivity {
+			entry = append(entry, f)
+		}
+	}
+	return entry, nil
+}
+
+// ExtraActivities is used by manifest templates, it returns the activities
+// besides the entry activity declared by intent filters.
+func (o *Options) ExtraActivities() ([]activityFilters, error) {
+	filters, err := o.intentFilters()
+	if err != nil {
+		return nil, err
+	}
+	var activities []activityFilters
+	index := make(map[string]int)
+	for _, f := range filters {
+		if f.Activity == "" || f.Activity == o.AndroidEntryActivity {
+			continue
+		}
+		i, ok := index[f.Activity]
+		if !ok {
+			i = len(activities)
+			index[f.Activity] = i
+			activities = append(activities, activityFilters{Name: f.Activity})
+		}
+		activities[i].IntentFilters = append(activities[i].IntentFilters, f)
+	}
+	return activities, nil
+}
+
+// manifestPartials defines the named templates available to every manifest
+// template.
+const manifestPartials string = `{{define "intentFilter"}}
+            <intent-filter{{if .AutoVerify}} android:autoVerify="true"{{end}}>
+{{- range .Actions}}
+                <action android:name="{{.}}" />
+{{- end}}
+{{- range .Categories}}
+                <category android:name="{{.}}" />
+{{- end}}
+{{- range .Data}}
+                <data{{range .Attrs}} android:{{.Key}}="{{.Value}}"{{end}} />
+{{- end}}
+            </intent-filter>
+{{- end}}`
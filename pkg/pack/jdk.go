@@ -0,0 +1,155 @@
+package pack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+var (
+	javaVersionLine = regexp.MustCompile(`version "([^"]+)"`)
+	agpVersionDecls = []*regexp.Regexp{
+		regexp.MustCompile(`com\.android\.tools\.build:gradle:([0-9][\w.-]*)`),
+		regexp.MustCompile(`id\s*\(?\s*["']com\.android\.(?:application|library)["']\s*\)?\s*version\s*\(?\s*["']([0-9][\w.-]*)["']`),
+		regexp.MustCompile(`(?m)^\s*(?:agp|androidGradlePlugin|android-gradle-plugin)\s*=\s*"([0-9][\w.-]*)"`),
+	}
+)
+
+// javaHome returns the JDK given by options or the config file.
+func (o *Options) javaHome() string {
+	if o.JavaHome != "" {
+		return o.JavaHome
+	}
+	return conf.JavaHome
+}
+
+// useJavaHome makes Gradle and the other Java tools run with the JDK at
+// home.
+func useJavaHome(home string) error {
+	if err := checkDirExist(home); err != nil {
+		return fmt.Errorf("JDK no found: %w", err)
+	}
+	logDebug("using JDK at: %s", home)
+	if os.Getenv("JAVA_HOME") == home {
+		return nil
+	}
+	if err := os.Setenv("JAVA_HOME", home); err != nil {
+		return err
+	}
+	return os.Setenv("PATH", filepath.Join(home, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// javaCommand returns the java Gradle is going to run with.
+func javaCommand() string {
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		return filepath.Join(home, "bin", "java")
+	}
+	return "java"
+}
+
+// javaMajorVersion returns the major version of java, e.g. 8 for 1.8.0_292
+// and 17 for 17.0.2.
+func javaMajorVersion(java string) (int, error) {
+	out, err := exec.Command(java, "-version").CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("%s -version: %w", java, err)
+	}
+	m := javaVersionLine.FindSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("no version found in output of %s -version", java)
+	}
+	parts := versionNumber.FindAllString(string(m[1]), -1)
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("illegal version %q in output of %s -version", m[1], java)
+	}
+	if len(parts) > 1 && parts[0] == "1" {
+		parts = parts[1:]
+	}
+	return strconv.Atoi(parts[0])
+}
+
+// agpVersion returns the Android Gradle Plugin version declared by the
+// Android project, "" is returned if none is found.
+func agpVersion(projectDir string) string {
+	files := []string{
+		"build.gradle",
+		"build.gradle.kts",
+		"settings.gradle",
+		"settings.gradle.kts",
+		filepath.Join("gradle", "libs.versions.toml"),
+		filepath.Join(opts.AndroidModuleName, "build.gradle"),
+		filepath.Join(opts.AndroidModuleName, "build.gradle.kts"),
+	}
+	for _, name := range files {
+		content, err := ioutil.ReadFile(filepath.Join(projectDir, name))
+		if err != nil {
+			continue
+		}
+		for _, re := range agpVersionDecls {
+			if m := re.FindSubmatch(content); m != nil {
+				return string(m[1])
+			}
+		}
+	}
+	return ""
+}
+
+// agpJDKs lists the lowest JDK each major version of the Android Gradle
+// Plugin runs on and the highest one it is known to work with, 0 if that is
+// unknown. The newest versions come first.
+var agpJDKs = []struct {
+	agp      string
+	min, max int
+}{
+	{"9.0", 17, 0},
+	{"8.0", 17, 21},
+	{"7.0", 11, 17},
+	{"", 8, 11},
+}
+
+// supportedJDKs returns the lowest and the highest JDK the Android Gradle
+// Plugin works with.
+func supportedJDKs(agp string) (int, int) {
+	for _, j := range agpJDKs {
+		if !versionLess(agp, j.agp) {
+			return j.min, j.max
+		}
+	}
+	last := agpJDKs[len(agpJDKs)-1]
+	return last.min, last.max
+}
+
+// checkJDK makes sure the JDK Gradle is going to run with is new enough for
+// the Android Gradle Plugin of the project, which otherwise fails with a
+// confusing stack trace.
+func checkJDK(projectDir string) error {
+	agp := agpVersion(projectDir)
+	if agp == "" {
+		logDebug("Android Gradle Plugin version of %s unknown, JDK check skipped", projectDir)
+		return nil
+	}
+	java := javaCommand()
+	v, err := javaMajorVersion(java)
+	if err != nil {
+		if opts.javaHome() != "" {
+			return err
+		}
+		logDebug("JDK version unknown, JDK check skipped: %v", err)
+		return nil
+	}
+	lowest, highest := supportedJDKs(agp)
+	if v < lowest {
+		return fmt.Errorf("JDK %d at %s is too old for Android Gradle Plugin %s, which requires JDK %d or later, pick another one with --java-home",
+			v, java, agp, lowest)
+	}
+	if highest > 0 && v > highest {
+		logWarning("JDK %d at %s is newer than Android Gradle Plugin %s is known to work with, which is JDK %d, pick another one with --java-home if the build fails",
+			v, java, agp, highest)
+	}
+	logDebug("building with JDK %d and Android Gradle Plugin %s", v, agp)
+	return nil
+}
@@ -0,0 +1,159 @@
+package pack
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct{}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// runCase is a phase of the run reported as a test case.
+type runCase struct {
+	name    string
+	elapsed time.Duration
+	err     error
+}
+
+var (
+	// runCases are the phases of the current run finished so far.
+	runCases     map[string]*runCase
+	runCasesLock sync.Mutex
+	// stage is the running phase of the run started with startStage, "" if
+	// there is none.
+	stage      string
+	stageStart time.Time
+)
+
+func resetRunCases() {
+	runCasesLock.Lock()
+	defer runCasesLock.Unlock()
+	runCases = make(map[string]*runCase)
+	stage = ""
+}
+
+// recordCase adds the time and error of a step to the phase name.
+func recordCase(name string, elapsed time.Duration, err error) {
+	runCasesLock.Lock()
+	defer runCasesLock.Unlock()
+	c := runCases[name]
+	if c == nil {
+		c = &runCase{name: name}
+		runCases[name] = c
+	}
+	c.elapsed += elapsed
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// startStage ends the running stage as passed and starts the stage name, the
+// stages run one after another. An empty name only ends the running stage.
+func startStage(name string) {
+	if stage != "" {
+		recordCase(stage, time.Since(stageStart), nil)
+	}
+	stage, stageStart = name, time.Now()
+}
+
+// failStage ends the running stage with err.
+func failStage(err error) {
+	if stage != "" {
+		recordCase(stage, time.Since(stageStart), err)
+		stage = ""
+	}
+}
+
+// runStep runs f as a step of the phase name, which may run alongside the
+// steps of other phases.
+func runStep(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	recordCase(name, time.Since(start), err)
+	return err
+}
+
+func outputCaseName(baseDir string) string {
+	return "package " + baseDir
+}
+
+// writeJUnitReport writes the phases of the run packing into the output
+// directories args to path as a JUnit test suite, the phases not reached
+// are skipped. runErr fails the run as a whole if no phase failed with it.
+func writeJUnitReport(path string, args []string, runErr error) error {
+	runCasesLock.Lock()
+	defer runCasesLock.Unlock()
+
+	names := []string{"validate", "build"}
+	for _, baseDir := range args {
+		names = append(names, outputCaseName(baseDir))
+	}
+	failed := false
+	for _, c := range runCases {
+		failed = failed || c.err != nil
+	}
+	if runErr != nil && !failed {
+		names = append(names, "finish")
+		runCases["finish"] = &runCase{name: "finish", err: runErr}
+	}
+
+	suite := junitTestSuite{
+		Name:      "upack." + opts.AndroidModuleName,
+		Time:      fmt.Sprintf("%.3f", time.Since(runStart).Seconds()),
+		Timestamp: runStart.Format("2006-01-02T15:04:05"),
+	}
+	for _, name := range names {
+		tc := junitTestCase{ClassName: suite.Name, Name: name}
+		c := runCases[name]
+		switch {
+		case c == nil:
+			tc.Time = "0"
+			tc.Skipped = &junitSkipped{}
+			suite.Skipped++
+		case c.err != nil:
+			tc.Time = fmt.Sprintf("%.3f", c.elapsed.Seconds())
+			// the message is shown in a single line, the details follow
+			msg := c.err.Error()
+			tc.Failure = &junitFailure{Message: strings.SplitN(msg, "\n", 2)[0], Text: msg}
+			suite.Failures++
+		default:
+			tc.Time = fmt.Sprintf("%.3f", c.elapsed.Seconds())
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	content, err := marshalXML(&suite)
+	if err != nil {
+		return err
+	}
+	return dirsync.WriteFileAtomic(path, content, 0644)
+}
@@ -0,0 +1,80 @@
+package pack
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	mccMncQualifier   = regexp.MustCompile(`^(mcc|mnc)\d+$`)
+	languageQualifier = regexp.MustCompile(`^[a-z]{2,3}$`)
+	regionQualifier   = regexp.MustCompile(`^r[A-Z]{2}$`)
+)
+
+// nonLocaleQualifiers are the resource qualifiers which look like a language
+// but are not, e.g. the car UI mode of values-car.
+var nonLocaleQualifiers = map[string]bool{
+	"car": true,
+}
+
+// resLocales returns the locales given by options, comma separated lists are
+// split.
+func (o *Options) resLocales() []string {
+	var locales []string
+	for _, l := range o.ResKeepLocales {
+		for _, s := range strings.Split(l, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				locales = append(locales, strings.Replace(s, "_", "-r", 1))
+			}
+		}
+	}
+	return locales
+}
+
+// resDirLocale returns the locale qualifier of a resource directory name
+// like values-zh-rCN, the language and the region are returned separately,
+// the language is empty if the directory has no locale qualifier.
+func resDirLocale(dirName string) (language, region string) {
+	parts := strings.Split(dirName, "-")
+	i := 1
+	for i < len(parts) && mccMncQualifier.MatchString(parts[i]) {
+		i++
+	}
+	if i >= len(parts) {
+		return "", ""
+	}
+	if strings.HasPrefix(parts[i], "b+") {
+		// BCP 47 tags like b+sr+Latn
+		tags := strings.Split(parts[i], "+")
+		return strings.ToLower(tags[1]), ""
+	}
+	if nonLocaleQualifiers[parts[i]] || !languageQualifier.MatchString(parts[i]) {
+		return "", ""
+	}
+	language = parts[i]
+	if i+1 < len(parts) && regionQualifier.MatchString(parts[i+1]) {
+		region = parts[i+1]
+	}
+	return language, region
+}
+
+// keepLocale tells whether an AAR entry is kept by the locale filter, only
+// the resource directories qualified by a locale are filtered.
+func keepLocale(path string) bool {
+	locales := opts.resLocales()
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(locales) == 0 || len(parts) < 2 || parts[0] != "res" {
+		return true
+	}
+	language, region := resDirLocale(parts[1])
+	if language == "" {
+		return true
+	}
+	for _, l := range locales {
+		if l == language || (region != "" && l == language+"-"+region) {
+			return true
+		}
+	}
+	return false
+}
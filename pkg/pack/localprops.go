@@ -0,0 +1,94 @@
+package pack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+const localPropertiesName = "local.properties"
+
+// escapeProperty escapes a value of a Java properties file, which matters for
+// Windows paths like C:\Android\sdk.
+func escapeProperty(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `:`, `\:`, `=`, `\=`)
+	return r.Replace(v)
+}
+
+// propertyKey returns the key of a line of a Java properties file, "" is
+// returned for blank lines and comments.
+func propertyKey(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == '!' {
+		return ""
+	}
+	if i := strings.IndexAny(line, "=:"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// setProperties sets props in content of a Java properties file, existing
+// keys are replaced in place and the others appended.
+func setProperties(content string, props []keyValue) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	for _, p := range props {
+		line := p.Key + "=" + escapeProperty(p.Value)
+		found := false
+		for i, l := range lines {
+			if propertyKey(l) == p.Key {
+				lines[i] = line
+				found = true
+			}
+		}
+		if !found {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// localProperties returns the entries of local.properties given by options.
+func (o *Options) localProperties() []keyValue {
+	var props []keyValue
+	if o.AndroidSdk != "" {
+		props = append(props, keyValue{Key: "sdk.dir", Value: o.AndroidSdk})
+	}
+	if o.AndroidNdk != "" {
+		props = append(props, keyValue{Key: "ndk.dir", Value: o.AndroidNdk})
+	}
+	return props
+}
+
+// patchLocalProperties writes the SDK and NDK directories given by options
+// into local.properties of the Android project, so Gradle finds them on
+// machines without a preconfigured SDK.
+func patchLocalProperties(projectDir string) error {
+	props := opts.localProperties()
+	if len(props) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(projectDir, localPropertiesName)
+	origin, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content := setProperties(string(origin), props)
+	if content == string(origin) {
+		logTrace("%s is up to date", path)
+		return nil
+	}
+	logDebug("patching %s", path)
+	if err := dirsync.WriteFileAtomic(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("patch %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package pack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const lockFileName = ".upack.lock"
+
+// acquireLock creates the lock file in dir so concurrent runs on the same
+// directory fail fast, the returned function removes it.
+func acquireLock(dir string) (func(), error) {
+	path := filepath.Join(dir, lockFileName)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			holder, _ := ioutil.ReadFile(path)
+			return nil, fmt.Errorf("%s is locked by another upack run (%s), remove %s if that run is gone",
+				dir, strings.TrimSpace(string(holder)), path)
+		}
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	_, err = fmt.Fprintf(f, "pid %d on %s since %s\n", os.Getpid(), host, time.Now().Format(time.RFC3339))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	logTrace("locked %s", dir)
+	return func() {
+		if err := os.Remove(path); err != nil {
+			logError("unlock %s: %v", dir, err)
+		}
+	}, nil
+}
+
+// acquireLocks locks every directory in dirs, nothing is left locked on
+// failure.
+func acquireLocks(dirs []string) (func(), error) {
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	locked := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		if locked[d] {
+			continue
+		}
+		locked[d] = true
+		r, err := acquireLock(d)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
@@ -0,0 +1,222 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelTrace logLevel = iota
+	levelDebug
+	levelInfo
+	levelWarning
+	levelError
+)
+
+var logLevelNames = []string{"trace", "debug", "info", "warning", "error"}
+
+var levelColors = map[logLevel]string{
+	levelWarning: colorYellow,
+	levelError:   colorRed,
+}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var (
+	// logOutput receives the log records, the results of commands go to
+	// stdout so they can be piped apart from the log.
+	logOutput io.Writer = os.Stderr
+	// logFileOutput receives every record regardless of the log level when
+	// --log-file is given, nil otherwise.
+	logFileOutput io.Writer
+	logLock       sync.Mutex
+)
+
+// openLogFile starts teeing the log to path until closeLogFile is called.
+func openLogFile(path string) error {
+	f, err := createLogFile(path)
+	if err != nil {
+		return err
+	}
+	logLock.Lock()
+	defer logLock.Unlock()
+	logFileOutput = f
+	return nil
+}
+
+func closeLogFile() {
+	logLock.Lock()
+	defer logLock.Unlock()
+	if f, ok := logFileOutput.(*os.File); ok {
+		f.Close()
+	}
+	logFileOutput = nil
+}
+
+// logFileError records the error a command fails with in the log file only,
+// the flags parser shows it on the console.
+func logFileError(err error) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	if logFileOutput != nil {
+		fmt.Fprintln(logFileOutput, formatLogRecord(time.Now(), levelError, "", err.Error(), true))
+	}
+}
+
+// logLevel returns the lowest level logged, given by --log-level or else by
+// --quiet and how many times -v is repeated.
+func (o *Options) logLevel() logLevel {
+	for i, name := range logLevelNames {
+		if o.LogLevel == name {
+			return logLevel(i)
+		}
+	}
+	if o.Quiet {
+		return levelError
+	}
+	switch len(o.Verbose) {
+	case 0:
+		return levelInfo
+	case 1:
+		return levelDebug
+	}
+	return levelTrace
+}
+
+type logRecord struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Module string `json:"module,omitempty"`
+	Msg    string `json:"msg"`
+}
+
+// logAt logs a record of the level, module names the part of upack or the
+// external command the record comes from and is "" for upack itself.
+func logAt(level logLevel, module string, f string, a ...interface{}) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	console := level >= opts.logLevel()
+	if !console && logFileOutput == nil {
+		return
+	}
+	msg := fmt.Sprintf(f, a...)
+	now := time.Now()
+
+	if console {
+		line := formatLogRecord(now, level, module, msg, opts.LogTimestamps)
+		if level >= levelWarning && opts.LogFormat != logFormatJSON && logOutput == os.Stderr && colorEnabled(os.Stderr) {
+			line = colorize(levelColors[level], line)
+		}
+		// a bar is only drawn where escapes are enabled
+		if progressBar != "" {
+			fmt.Fprint(logOutput, "\r\x1b[K")
+		}
+		fmt.Fprintln(logOutput, line)
+		if progressBar != "" {
+			fmt.Fprint(logOutput, progressBar)
+		}
+	}
+	if logFileOutput != nil {
+		// the log file is read after the fact, the time always matters
+		fmt.Fprintln(logFileOutput, formatLogRecord(now, level, module, msg, true))
+	}
+}
+
+func formatLogRecord(t time.Time, level logLevel, module, msg string, timestamp bool) string {
+	if opts.LogFormat == logFormatJSON {
+		bs, _ := json.Marshal(&logRecord{
+			Time:   t.Format(time.RFC3339Nano),
+			Level:  level.String(),
+			Module: module,
+			Msg:    msg,
+		})
+		return string(bs)
+	}
+	if module != "" {
+		msg = "[" + module + "] " + msg
+	}
+	if level >= levelWarning {
+		msg = level.String() + ": " + msg
+	}
+	if timestamp {
+		msg = t.Format("2006-01-02 15:04:05.000") + " " + msg
+	}
+	return msg
+}
+
+// printProgress prints what a command is doing on stdout unless --quiet is
+// given, unlike the results of the commands.
+func printProgress(f string, a ...interface{}) {
+	if !opts.Quiet {
+		fmt.Printf(f+"\n", a...)
+	}
+}
+
+func logTrace(f string, a ...interface{}) {
+	logAt(levelTrace, "", f, a...)
+}
+
+func logDebug(f string, a ...interface{}) {
+	logAt(levelDebug, "", f, a...)
+}
+
+func logInfo(f string, a ...interface{}) {
+	logAt(levelInfo, "", f, a...)
+}
+
+func logError(f string, a ...interface{}) {
+	logAt(levelError, "", f, a...)
+}
+
+func logWarning(f string, a ...interface{}) {
+	recordWarning(fmt.Sprintf(f, a...))
+	logAt(levelWarning, "", f, a...)
+}
+
+// logWriter logs every line written to it as a record of the level, it takes
+// the output of external commands.
+type logWriter struct {
+	module string
+	level  logLevel
+	buf    []byte
+}
+
+func newLogWriter(module string, level logLevel) *logWriter {
+	return &logWriter{module: module, level: level}
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		logAt(w.level, w.module, "%s", strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Flush logs what is left after the last line break.
+func (w *logWriter) Flush() {
+	if len(w.buf) > 0 {
+		logAt(w.level, w.module, "%s", strings.TrimRight(string(w.buf), "\r"))
+		w.buf = nil
+	}
+}
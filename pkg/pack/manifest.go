@@ -0,0 +1,77 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// manifestData is the data of manifest templates, it allows the settings of
+// an output directory to override the global ones.
+type manifestData struct {
+	*Options
+	AndroidPermissions []string
+	vars               map[string]string
+}
+
+// Vars is used by templates, it returns the user defined variables.
+func (d *manifestData) Vars() (map[string]string, error) {
+	return d.vars, nil
+}
+
+func newManifestData(out *outputConfig) (*manifestData, error) {
+	vars, err := opts.Vars()
+	if err != nil {
+		return nil, err
+	}
+	data := &manifestData{
+		Options:            &opts,
+		AndroidPermissions: opts.AndroidPermissions,
+		vars:               vars,
+	}
+	if out == nil {
+		return data, nil
+	}
+	for k, v := range out.Vars {
+		vars[k] = v
+	}
+	data.AndroidPermissions = append(append([]string{}, opts.AndroidPermissions...), out.Permissions...)
+	return data, nil
+}
+
+// renderManifest renders, validates and lints the Android manifest of an
+// output directory, out holds the settings of the directory in the config
+// file and may be nil.
+func renderManifest(out *outputConfig) ([]byte, error) {
+	path, preset := opts.AndroidManifestTemplate, opts.ManifestPreset
+	if out != nil {
+		if out.ManifestTemplate != "" {
+			path = out.ManifestTemplate
+		}
+		if out.ManifestPreset != "" {
+			preset = out.ManifestPreset
+		}
+	}
+
+	data, err := newManifestData(out)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := loadManifestTemplate(path, preset, data.AndroidPermissions)
+	if err != nil {
+		return nil, fmt.Errorf("Android manifest template load fail: %w", err)
+	}
+	if err := strictTemplate(tmpl, data, data.vars, path); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("Andoird manifest generate fail: %w", err)
+	}
+	if err := checkManifest(buf.Bytes(), path); err != nil {
+		return nil, err
+	}
+	if err := lintManifest(buf.Bytes(), path, path == "" && preset == "debug"); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
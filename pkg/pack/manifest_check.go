@@ -0,0 +1,24 @@
+package pack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+// checkManifest validates the manifest rendered from the template at
+// source, which is "" for the built-in ones. The positions of the problems
+// are in the rendered manifest, the annotations only point to the template.
+func checkManifest(content []byte, source string) error {
+	problems := manifest.Validate(content)
+	if len(problems) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(problems))
+	for _, p := range problems {
+		msgs = append(msgs, "AndroidManifest.xml:"+p.String())
+		annotate(annotationError, annotationFile(source), 0, 0, "invalid Android manifest, AndroidManifest.xml:%s", p)
+	}
+	return fmt.Errorf("invalid Android manifest:\n  %s", strings.Join(msgs, "\n  "))
+}
@@ -0,0 +1,60 @@
+package pack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+// lintManifest reports risky settings in the manifest rendered from the
+// template at source, findings with error severity fail the run. The built-in
+// debug preset is debuggable and installed on external storage on purpose,
+// those rules are off for it unless set explicitly.
+func lintManifest(content []byte, source string, debugPreset bool) error {
+	severities, err := manifest.ParseSeverities(opts.ManifestLint)
+	if err != nil {
+		return err
+	}
+	if debugPreset {
+		for _, rule := range []string{manifest.RuleDebuggable, manifest.RuleInstallLocation} {
+			if !lintRuleSet(rule) {
+				severities[rule] = manifest.SeverityOff
+			}
+		}
+	}
+	root, err := manifest.Parse(content)
+	if err != nil || root == nil {
+		// malformed manifests are reported by the validation
+		return err
+	}
+
+	var errs []string
+	for _, f := range manifest.Lint(root, severities) {
+		level := annotationWarning
+		if f.Severity == manifest.SeverityError {
+			level = annotationError
+		}
+		// the position is in the rendered manifest, not in the template
+		annotate(level, annotationFile(source), 0, 0, "%s", f)
+		if f.Severity == manifest.SeverityError {
+			errs = append(errs, f.String())
+		} else {
+			logWarning("%s", f.String())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Android manifest lint errors:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// lintRuleSet tells whether the severity of rule is given by --manifest-lint.
+func lintRuleSet(rule string) bool {
+	for _, s := range opts.ManifestLint {
+		if strings.TrimSpace(strings.SplitN(s, "=", 2)[0]) == rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package pack
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mergedJarManifest is the jar entry kept silently when jars are merged, every
+// jar has one.
+const mergedJarManifest = "META-INF/MANIFEST.MF"
+
+// copyJarEntries copies the file entries of jarFile into w, entries already
+// in seen are handled by the duplicate entry policy.
+func copyJarEntries(w *zip.Writer, jarFile string, seen map[string]string) error {
+	r, err := zip.OpenReader(jarFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if prev, ok := seen[f.Name]; ok {
+			if f.Name == mergedJarManifest {
+				continue
+			}
+			msg := fmt.Sprintf("%s in %s is already provided by %s", f.Name, filepath.Base(jarFile), filepath.Base(prev))
+			switch opts.MergeDuplicates {
+			case policyError:
+				return fmt.Errorf("merge jars: %s", msg)
+			case policyWarn:
+				logWarning("%s, skipped", msg)
+			default:
+				logDebug("%s, skipped", msg)
+			}
+			continue
+		}
+		seen[f.Name] = jarFile
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		header := f.FileHeader
+		out, err := w.CreateHeader(&header)
+		if err == nil {
+			_, err = io.Copy(out, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("write %s to merged jar: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// mergeJars combines classes.jar and the jars under libs of the extracted AAR
+// in plugDir into a single classes.jar.
+func mergeJars(plugDir string) error {
+	jarFiles, err := filepath.Glob(filepath.Join(plugDir, "libs", "*.jar"))
+	if err != nil {
+		return err
+	}
+	if len(jarFiles) == 0 {
+		return nil
+	}
+	jarFile := filepath.Join(plugDir, "classes.jar")
+	if err := checkFileExist(jarFile); err == nil {
+		jarFiles = append([]string{jarFile}, jarFiles...)
+	}
+
+	logTrace("start merging %d jars into %s ...", len(jarFiles), jarFile)
+	out, err := os.CreateTemp("", "upack-*.jar")
+	if err != nil {
+		return err
+	}
+	tmpFile := out.Name()
+	w := zip.NewWriter(out)
+	seen := make(map[string]string)
+	for _, f := range jarFiles {
+		logDebug("merging %s", strings.TrimPrefix(f, plugDir+string(os.PathSeparator)))
+		if err := copyJarEntries(w, f, seen); err != nil {
+			w.Close()
+			out.Close()
+			os.Remove(tmpFile)
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		out.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	perm := fileMode(jarFiles[0])
+	for _, f := range jarFiles {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return replaceFile(tmpFile, jarFile, perm)
+}
@@ -0,0 +1,260 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+const folderMetaTemplate string = `fileFormatVersion: 2
+guid: {{.GUID}}
+folderAsset: yes
+DefaultImporter:
+  externalObjects: {}
+  userData:
+  assetBundleName:
+  assetBundleVariant:
+`
+
+const defaultMetaTemplate string = `fileFormatVersion: 2
+guid: {{.GUID}}
+{{.Importer}}:
+  externalObjects: {}
+  userData:
+  assetBundleName:
+  assetBundleVariant:
+`
+
+const pluginMetaTemplate string = `fileFormatVersion: 2
+guid: {{.GUID}}
+{{- if .Folder}}
+folderAsset: yes
+{{- end}}
+PluginImporter:
+  externalObjects: {}
+  serializedVersion: 2
+  iconMap: {}
+  executionOrder: {}
+  defineConstraints: []
+  isPreloaded: 0
+  isOverridable: 0
+  isExplicitlyReferenced: 0
+  validateReferences: 1
+  platformData:
+  - first:
+      : Any
+    second:
+      enabled: 0
+      settings:
+        Exclude Android: 0
+        Exclude Editor: 1
+        Exclude Linux64: 1
+        Exclude OSXUniversal: 1
+        Exclude Win: 1
+        Exclude Win64: 1
+  - first:
+      Android: Android
+    second:
+      enabled: 1
+      settings:
+        CPU: {{.CPU}}
+  - first:
+      Any:
+    second:
+      enabled: 0
+      settings: {}
+  - first:
+      Editor: Editor
+    second:
+      enabled: 0
+      settings:
+        DefaultValueInitialized: true
+  userData:
+  assetBundleName:
+  assetBundleVariant:
+`
+
+var (
+	folderMeta  = template.Must(template.New("FolderMeta").Parse(folderMetaTemplate))
+	defaultMeta = template.Must(template.New("DefaultMeta").Parse(defaultMetaTemplate))
+	pluginMeta  = template.Must(template.New("PluginMeta").Parse(pluginMetaTemplate))
+)
+
+type metaData struct {
+	GUID     string
+	Importer string
+	CPU      string
+	Folder   bool
+}
+
+var abiCPUs = map[string]string{
+	"armeabi-v7a": "ARMv7",
+	"arm64-v8a":   "ARM64",
+	"x86":         "X86",
+	"x86_64":      "X86_64",
+}
+
+var textAssetExts = []string{".txt", ".html", ".htm", ".xml", ".bytes", ".json", ".csv", ".yaml", ".fnt"}
+
+// unityGUID derives a GUID from the asset path so the same asset gets the
+// same GUID on every run.
+func unityGUID(relPath string) string {
+	sum := md5.Sum([]byte(filepath.ToSlash(relPath)))
+	return hex.EncodeToString(sum[:])
+}
+
+// nativeLibCPU returns the Unity CPU setting of a native library according to
+// the ABI directory it lives in.
+func nativeLibCPU(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := len(parts) - 2; i >= 0; i-- {
+		if cpu, ok := abiCPUs[parts[i]]; ok {
+			return cpu
+		}
+	}
+	return "AnyCPU"
+}
+
+func isPluginFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jar", ".aar", ".so":
+		return true
+	}
+	return false
+}
+
+func isTextAsset(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range textAssetExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func renderMeta(path, relPath string, isDir bool) ([]byte, error) {
+	data := metaData{GUID: unityGUID(relPath), Importer: "DefaultImporter", CPU: "AnyCPU"}
+	tmpl := defaultMeta
+	switch {
+	case isDir && strings.HasSuffix(path, ".androidlib"):
+		tmpl = pluginMeta
+		data.Folder = true
+	case isDir:
+		tmpl = folderMeta
+	case isPluginFile(path):
+		tmpl = pluginMeta
+		if strings.ToLower(filepath.Ext(path)) == ".so" {
+			data.CPU = nativeLibCPU(relPath)
+		} else if abi := splitAbiOf(path); abi != "" {
+			data.CPU = abiCPUs[abi]
+		}
+	case filepath.Base(path) == "package.json":
+		data.Importer = "PackageManifestImporter"
+	case isTextAsset(path):
+		data.Importer = "TextScriptImporter"
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMetaFile(path, relPath string, isDir bool) error {
+	content, err := renderMeta(path, relPath, isDir)
+	if err != nil {
+		return err
+	}
+	if dirsync.SameFileContent(path+".meta", content) {
+		return nil
+	}
+	if err := saveOriginal(path + ".meta"); err != nil {
+		return err
+	}
+	logTrace("writing meta file for %s", path)
+	return dirsync.WriteFileAtomic(path+".meta", content, 0644)
+}
+
+// addMetaFiles generates .meta files for path and everything below it, the
+// GUIDs are hashed from the path relative to the Unity project assetRoot
+// belongs to, so outputs in the same project never share GUIDs, or to
+// assetRoot outside of any project.
+func addMetaFiles(assetRoot, path string) error {
+	if projectDir := findUnityProject(assetRoot); projectDir != "" {
+		assetRoot = projectDir
+	}
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(p, ".meta") {
+			return nil
+		}
+		if isSavedPath(p) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(assetRoot, p)
+		if err != nil {
+			return err
+		}
+		return writeMetaFile(p, relPath, info.IsDir())
+	})
+}
+
+// addLibraryMetaFiles generates .meta files for the plugin directory and the
+// Android manifest written into baseDir.
+func addLibraryMetaFiles(baseDir, plugDir string) error {
+	if err := addMetaFiles(baseDir, plugDir); err != nil {
+		return err
+	}
+	return addMetaFiles(baseDir, filepath.Join(baseDir, "AndroidManifest.xml"))
+}
+
+// addAarMetaFiles generates .meta files for the AAR and the Android manifest
+// written into baseDir.
+func addAarMetaFiles(baseDir string) error {
+	if err := addMetaFiles(baseDir, opts.outputAarFile(baseDir)); err != nil {
+		return err
+	}
+	return addMetaFiles(baseDir, filepath.Join(baseDir, "AndroidManifest.xml"))
+}
+
+// addOutputMetaFiles generates .meta files for everything written into
+// baseDir with the layout of the given format.
+func addOutputMetaFiles(format, baseDir string) error {
+	var err error
+	switch format {
+	case formatUpm:
+		return addMetaFiles(baseDir, upmPackageDir(baseDir))
+	case formatAar:
+		err = addAarMetaFiles(baseDir)
+	case formatAndroidLib:
+		err = addLibraryMetaFiles(baseDir, opts.androidLibPluginDir(baseDir))
+	case formatSrcAar:
+		err = addLibraryMetaFiles(baseDir, m2RepositoryDir(baseDir))
+	default:
+		err = addLibraryMetaFiles(baseDir, opts.libraryPluginDir(baseDir))
+	}
+	if err != nil {
+		return err
+	}
+	if opts.EdmDependencies {
+		if err := addMetaFiles(baseDir, filepath.Dir(opts.edmDependenciesFile(baseDir))); err != nil {
+			return err
+		}
+	}
+	if info != nil {
+		return addMetaFiles(baseDir, opts.buildInfoFile(baseDir))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package pack
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// abis returns the ABIs given by options, comma separated lists are split.
+func (o *Options) abis() []string {
+	var abis []string
+	for _, a := range o.Abis {
+		for _, s := range strings.Split(a, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				abis = append(abis, s)
+			}
+		}
+	}
+	return abis
+}
+
+func checkAbis(abis []string) error {
+	for _, a := range abis {
+		if _, ok := abiCPUs[a]; !ok {
+			return fmt.Errorf("unknown ABI %s", a)
+		}
+	}
+	return nil
+}
+
+// keepAbi tells whether an AAR entry is kept by the ABI filter, only native
+// libraries under jni are filtered.
+func keepAbi(path string) bool {
+	abis := opts.abis()
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	if len(abis) == 0 || len(parts) < 2 || parts[0] != "jni" {
+		return true
+	}
+	for _, a := range abis {
+		if parts[1] == a {
+			return true
+		}
+	}
+	return false
+}
+
+// nativeLibs returns the native libraries under jni of the AAR extracted to
+// dir.
+func nativeLibs(dir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(dir, "jni", "*", "*.so"))
+}
+
+// stripTool returns the tool stripping native libraries, llvm-strip of the
+// newest NDK in the Android SDK is preferred over the one on PATH.
+func stripTool() (string, error) {
+	if opts.StripTool != "" {
+		return opts.StripTool, nil
+	}
+	if sdkDir, err := androidSdkDir(); err == nil {
+		tools, err := filepath.Glob(filepath.Join(sdkDir, "ndk", "*", "toolchains", "llvm", "prebuilt", "*", "bin", "llvm-strip*"))
+		if err != nil {
+			return "", err
+		}
+		sort.Slice(tools, func(i, j int) bool {
+			return versionLess(tools[i], tools[j])
+		})
+		if len(tools) > 0 {
+			return tools[len(tools)-1], nil
+		}
+	}
+	path, err := exec.LookPath("llvm-strip")
+	if err != nil {
+		return "", fmt.Errorf("llvm-strip no found, install the Android NDK or use --strip-tool")
+	}
+	return path, nil
+}
+
+// symbolsLock serializes writing the native symbols directory shared by the
+// output directories.
+var symbolsLock sync.Mutex
+
+func (o *Options) nativeSymbolsDir() string {
+	if o.NativeSymbolsDir != "" {
+		return o.NativeSymbolsDir
+	}
+	return filepath.Join(o.moduleDir(), "build", "upack", "symbols")
+}
+
+// keepNativeSymbols copies the unstripped lib to symbolFile, nothing is
+// written when previewing.
+func keepNativeSymbols(lib, symbolFile string) error {
+	if opts.DryRun {
+		planf("keep the unstripped %s at %s", filepath.Base(lib), symbolFile)
+	}
+	if previewing() {
+		return nil
+	}
+	if err := makeDir(filepath.Dir(symbolFile), false); err != nil {
+		return err
+	}
+	logTrace("keeping unstripped %s at %s", filepath.Base(lib), symbolFile)
+	symbolsLock.Lock()
+	defer symbolsLock.Unlock()
+	return copyFile(lib, symbolFile)
+}
+
+// stripNativeLibs strips the native libraries of the AAR extracted to dir,
+// the unstripped libraries are copied to the native symbols directory for
+// symbolication.
+func stripNativeLibs(dir string) error {
+	if !opts.StripNative {
+		return nil
+	}
+	libs, err := nativeLibs(dir)
+	if err != nil {
+		return err
+	}
+	if len(libs) == 0 {
+		return nil
+	}
+	tool, err := stripTool()
+	if err != nil {
+		return err
+	}
+	symbolsDir := opts.nativeSymbolsDir()
+	for _, lib := range libs {
+		relPath, err := filepath.Rel(dir, lib)
+		if err != nil {
+			return err
+		}
+		if err := keepNativeSymbols(lib, filepath.Join(symbolsDir, relPath)); err != nil {
+			return err
+		}
+		logDebug("stripping %s", relPath)
+		if err := runCommandAt(dir, tool, "--strip-unneeded", lib); err != nil {
+			return fmt.Errorf("strip %s fail: %w", relPath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const notifyTimeout = 10 * time.Second
+
+const (
+	notifySuccess = "success"
+	notifyFailure = "failure"
+)
+
+// notifyConfig holds the notify section of the config file.
+type notifyConfig struct {
+	URL string `yaml:"url"`
+	// On lists the results notified, success and failure, both by default.
+	On      []string          `yaml:"on"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// notifyPayload is POSTed to the notify URL at the end of a run, Text makes
+// it readable as is by Slack compatible incoming webhooks.
+type notifyPayload struct {
+	Text        string   `json:"text"`
+	Status      string   `json:"status"`
+	Module      string   `json:"module"`
+	Error       string   `json:"error,omitempty"`
+	Outputs     []string `json:"outputs"`
+	Seconds     float64  `json:"seconds"`
+	VersionName string   `json:"versionName,omitempty"`
+	VersionCode int      `json:"versionCode,omitempty"`
+	Commit      string   `json:"commit,omitempty"`
+	Host        string   `json:"host,omitempty"`
+	ToolVersion string   `json:"toolVersion"`
+}
+
+func (c *notifyConfig) notifies(status string) bool {
+	if len(c.On) == 0 {
+		return true
+	}
+	for _, on := range c.On {
+		if on == status {
+			return true
+		}
+	}
+	return false
+}
+
+func checkNotifyConfig(c *notifyConfig) error {
+	for _, on := range c.On {
+		if on != notifySuccess && on != notifyFailure {
+			return fmt.Errorf("illegal notify result %s, success or failure expected", on)
+		}
+	}
+	return nil
+}
+
+// notify POSTs the result of the run packing into the output directories
+// args to --notify-url, or the URL of the config file.
+func notify(args []string, runErr error) error {
+	c := conf.Notify
+	if opts.NotifyURL != "" {
+		c.URL = opts.NotifyURL
+	}
+	status := notifySuccess
+	if runErr != nil {
+		status = notifyFailure
+	}
+	if c.URL == "" || !c.notifies(status) {
+		return nil
+	}
+
+	p := notifyPayload{
+		Status:      status,
+		Module:      opts.AndroidModuleName,
+		Outputs:     args,
+		Seconds:     time.Since(runStart).Seconds(),
+		ToolVersion: toolVersion(),
+	}
+	p.Host, _ = os.Hostname()
+	if info != nil {
+		p.VersionName, p.VersionCode, p.Commit = info.VersionName, info.VersionCode, info.Commit
+	}
+	if runErr != nil {
+		p.Error = runErr.Error()
+		p.Text = fmt.Sprintf("upack failed to pack %s: %s", p.Module, strings.SplitN(p.Error, "\n", 2)[0])
+	} else {
+		p.Text = fmt.Sprintf("upack packed %s into %s in %.1fs", p.Module, strings.Join(args, ", "), p.Seconds)
+	}
+	body, err := json.Marshal(&p)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	// webhook URLs hold secrets, only their hosts are logged
+	resp, err := client.Do(req)
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return fmt.Errorf("notify %s: %w", req.URL.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notify %s: %s", req.URL.Host, resp.Status)
+	}
+	logDebug("notified %s of the %s", req.URL.Host, status)
+	return nil
+}
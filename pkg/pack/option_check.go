@@ -0,0 +1,147 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// optionProblems collects what is wrong with the options, so that they are
+// all reported by one run.
+type optionProblems []string
+
+func (p *optionProblems) add(err error) {
+	if err != nil {
+		*p = append(*p, err.Error())
+	}
+}
+
+func (p *optionProblems) addf(f string, a ...interface{}) {
+	*p = append(*p, fmt.Sprintf(f, a...))
+}
+
+func (p optionProblems) err() error {
+	// the settings shared by the outputs are checked with each of them
+	var problems []string
+	seen := make(map[string]bool, len(p))
+	for _, s := range p {
+		if !seen[s] {
+			seen[s] = true
+			problems = append(problems, s)
+		}
+	}
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return usageError(errors.New(problems[0]))
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d problems with the options", len(problems))
+	for _, s := range problems {
+		sb.WriteString("\n    " + s)
+	}
+	return usageError(errors.New(sb.String()))
+}
+
+// checkFile adds a problem if the file given as option name doesn't
+// exist, templates may be URLs fetched later.
+func (p *optionProblems) checkFile(name, path string) {
+	if path == "" || isURL(path) {
+		return
+	}
+	if err := checkFileExist(path); err != nil {
+		p.addf("%s no found: %v", name, err)
+	}
+}
+
+// checkOptions validates the options and the config file together before
+// anything is touched, every problem is reported at once.
+func checkOptions() error {
+	var p optionProblems
+
+	if opts.BackupExtension != "" && !strings.HasPrefix(opts.BackupExtension, ".") {
+		p.addf("backup extension %s must start with a dot, like .bak", opts.BackupExtension)
+	}
+	if opts.BackupExtension == "" {
+		if opts.BackupDir != "" {
+			p.addf("--backup-dir requires --backup-extension")
+		}
+		if opts.BackupTimestamp {
+			p.addf("--backup-timestamp requires --backup-extension")
+		}
+	}
+	if opts.BackupKeep < 0 {
+		p.addf("illegal backup keep %d", opts.BackupKeep)
+	}
+	if opts.BackupKeep > 0 && !opts.BackupTimestamp {
+		p.addf("--backup-keep requires --backup-timestamp")
+	}
+
+	if opts.Remote != "" && opts.DockerImage != "" {
+		p.addf("--remote and --docker-image can't be used together")
+	}
+	if opts.Remote != "" {
+		_, err := parseRemote(opts.Remote)
+		p.add(err)
+	}
+	if opts.Watch && opts.DryRun {
+		p.addf("--watch and --dry-run can't be used together")
+	}
+	if opts.Retries < 0 {
+		p.addf("illegal retries %d", opts.Retries)
+	}
+	if opts.Jobs < 0 {
+		p.addf("illegal jobs %d", opts.Jobs)
+	}
+	p.add(checkSdkOptions())
+	p.add(checkAbis(opts.abis()))
+
+	if !opts.StripNative {
+		if opts.StripTool != "" {
+			p.addf("--strip-tool requires --strip-native")
+		}
+		if opts.NativeSymbolsDir != "" {
+			p.addf("--native-symbols-dir requires --strip-native")
+		}
+	}
+	if opts.R8Jar != "" && len(opts.R8Rules) == 0 {
+		p.addf("--r8-jar requires --r8-rules")
+	}
+
+	if _, err := newIgnoreList(opts.AndroidRemoveJarContent); err != nil {
+		p.addf("invalid jar content removal: %v", err)
+	}
+	if _, err := newIgnoreList(opts.AndroidKeepJarContent); err != nil {
+		p.addf("invalid jar content allowlist: %v", err)
+	}
+	_, err := parseRelocations(opts.Relocations)
+	p.add(err)
+	_, err = parseKeyValues("Gradle project property", opts.GradleBuildProps)
+	p.add(err)
+
+	p.checkFile("ignore file", opts.IgnoreFile)
+	p.checkFile("R8 jar", opts.R8Jar)
+	for _, r := range opts.R8Rules {
+		p.checkFile("R8 rules", r)
+	}
+	p.checkFile("manifest template", opts.AndroidManifestTemplate)
+	for _, f := range conf.Files {
+		p.checkFile("template", f.Template)
+	}
+	for _, out := range conf.Outputs {
+		p.checkFile("manifest template of "+out.Path, out.ManifestTemplate)
+		for _, f := range out.Files {
+			p.checkFile("template of "+out.Path, f.Template)
+		}
+	}
+	p.add(checkHooksConfig(&conf.Hooks))
+	p.add(checkPipeline(conf.Pipeline))
+	_, err = copySpecs(nil)
+	p.add(err)
+	for i := range conf.Outputs {
+		_, err := copySpecs(&conf.Outputs[i])
+		p.add(err)
+	}
+	return p.err()
+}
@@ -0,0 +1,66 @@
+// Package pack builds an Android library module and packs it as a Unity
+// plugin into output directories. The upack command is a thin wrapper of
+// Main, build systems and editor tools call Run instead.
+package pack
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// runLock serializes the runs of Run, a run keeps its options and
+// configuration until it is done.
+var runLock sync.Mutex
+
+// NewOptions returns the options with the defaults of the command line,
+// including those set by the UPACK_* environment variables.
+func NewOptions() (*Options, error) {
+	var o Options
+	parser := flags.NewParser(&o, flags.None)
+	// the Android project is checked by Run
+	takeRequiredOptions(parser)
+	if _, err := parser.ParseArgs(nil); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Run packs the plugin into each of outputDirs with the options o the way
+// the command does without a subcommand, "." is used if none is given. The
+// runs in a process are serialized.
+func Run(o *Options, outputDirs ...string) error {
+	runLock.Lock()
+	defer runLock.Unlock()
+	saved := opts
+	defer func() { opts = saved }()
+	opts = *o
+	if err := checkRequiredFields(o); err != nil {
+		return err
+	}
+	args := append([]string(nil), outputDirs...)
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	return main1(args)
+}
+
+// checkRequiredFields fails if any of the options the command requires is
+// empty.
+func checkRequiredFields(o *Options) error {
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"AndroidModuleName", o.AndroidModuleName},
+		{"AndroidProjectPath", o.AndroidProjectPath},
+		{"AndroidEntryActivity", o.AndroidEntryActivity},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return withExitCode(exitUsage, fmt.Errorf("option %s expected", r.name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package pack
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// outputErrors aggregates the failures of the output directories.
+type outputErrors []error
+
+func (e outputErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d output directories failed:\n%s", len(e), strings.Join(msgs, "\n"))
+}
+
+func (o *Options) jobs(n int) int {
+	jobs := o.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > n {
+		jobs = n
+	}
+	return jobs
+}
+
+// forEachOutput runs fn for every output directory with a pool of workers,
+// every directory is processed even if others fail and the failures are
+// reported together.
+func forEachOutput(baseDirs []string, fn func(baseDir string) error) error {
+	jobs := make(chan int)
+	errs := make([]error, len(baseDirs))
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.jobs(len(baseDirs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := checkCanceled()
+				if err == nil {
+					err = fn(baseDirs[i])
+				}
+				if err != nil {
+					errs[i] = fmt.Errorf("output %s: %w", baseDirs[i], err)
+				}
+			}
+		}()
+	}
+	for i := range baseDirs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed outputErrors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	}
+	return failed
+}
@@ -0,0 +1,220 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The built-in stages of the pipeline, in their default order. The stages
+// from extract to sync run for each output directory on the plugin staged in
+// a temporary directory.
+const (
+	stageBuild    = "build"
+	stageExtract  = "extract"
+	stageFilter   = "filter"
+	stageGenerate = "generate"
+	stageSync     = "sync"
+)
+
+var builtinStages = []string{stageBuild, stageExtract, stageFilter, stageGenerate, stageSync}
+
+// pipelineStage is an entry of the pipeline section of the config file, a
+// built-in stage given by its name or a command run at that point.
+type pipelineStage struct {
+	Name     string `yaml:"name"`
+	Exec     string `yaml:"exec,omitempty"`
+	Disabled bool   `yaml:"disabled,omitempty"`
+}
+
+// UnmarshalYAML accepts the name alone for a built-in stage.
+func (s *pipelineStage) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&s.Name)
+	}
+	type plain pipelineStage
+	return value.Decode((*plain)(s))
+}
+
+// MarshalYAML writes an enabled built-in stage as its name alone.
+func (s pipelineStage) MarshalYAML() (interface{}, error) {
+	if s.isBuiltin() && !s.Disabled {
+		return s.Name, nil
+	}
+	type plain pipelineStage
+	return plain(s), nil
+}
+
+func (s *pipelineStage) isBuiltin() bool {
+	return s.Exec == ""
+}
+
+// pipeline returns the stages of a run, the built-in ones in their default
+// order if the config file has none.
+func (c *config) pipeline() []pipelineStage {
+	if len(c.Pipeline) > 0 {
+		return c.Pipeline
+	}
+	stages := make([]pipelineStage, 0, len(builtinStages))
+	for _, name := range builtinStages {
+		stages = append(stages, pipelineStage{Name: name})
+	}
+	return stages
+}
+
+// stageEnabled tells whether the built-in stage name runs.
+func (c *config) stageEnabled(name string) bool {
+	for _, s := range c.pipeline() {
+		if s.isBuiltin() && s.Name == name {
+			return !s.Disabled
+		}
+	}
+	return false
+}
+
+// stagesBetween returns the enabled stages after the built-in stage from and
+// before the built-in stage to, "" stands for the start or the end.
+func (c *config) stagesBetween(from, to string) []pipelineStage {
+	var stages []pipelineStage
+	in := from == ""
+	for _, s := range c.pipeline() {
+		if s.isBuiltin() && s.Name == to {
+			break
+		}
+		if in && !s.Disabled {
+			stages = append(stages, s)
+		}
+		if s.isBuiltin() && s.Name == from {
+			in = true
+		}
+	}
+	return stages
+}
+
+// hasExecStages tells whether commands run on the staged plugin.
+func (c *config) hasExecStages() bool {
+	for _, s := range c.stagesBetween(stageExtract, stageSync) {
+		if !s.isBuiltin() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPipeline makes sure every built-in stage is there once, in an order
+// where each one finds what it works on.
+func checkPipeline(stages []pipelineStage) error {
+	if len(stages) == 0 {
+		return nil
+	}
+	index := make(map[string]int)
+	for i, s := range stages {
+		if !s.isBuiltin() && s.Name == "" {
+			return fmt.Errorf("pipeline stage running %s has no name", s.Exec)
+		}
+		if _, ok := index[s.Name]; ok {
+			return fmt.Errorf("duplicate pipeline stage %s", s.Name)
+		}
+		index[s.Name] = i
+		if s.isBuiltin() {
+			builtin := false
+			for _, name := range builtinStages {
+				builtin = builtin || s.Name == name
+			}
+			if !builtin {
+				return fmt.Errorf("unknown pipeline stage %s, %s or a stage with exec expected", s.Name, strings.Join(builtinStages, ", "))
+			}
+			if s.Disabled && (s.Name == stageExtract || s.Name == stageSync) {
+				return fmt.Errorf("pipeline stage %s can't be disabled", s.Name)
+			}
+		} else {
+			for _, name := range builtinStages {
+				if s.Name == name {
+					return fmt.Errorf("pipeline stage %s runs %s, built-in stage names can't be used", s.Name, s.Exec)
+				}
+			}
+		}
+	}
+	for _, name := range builtinStages {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("pipeline stage %s missing, disable it instead", name)
+		}
+	}
+	order := [][2]string{
+		{stageBuild, stageExtract},
+		{stageExtract, stageFilter},
+		{stageExtract, stageGenerate},
+		{stageFilter, stageSync},
+		{stageGenerate, stageSync},
+	}
+	for _, o := range order {
+		if index[o[0]] > index[o[1]] {
+			return fmt.Errorf("pipeline stage %s must come before %s", o[0], o[1])
+		}
+	}
+	return nil
+}
+
+// runEnv describes the run to the commands it starts.
+func runEnv() []string {
+	return []string{
+		"UPACK_PROJECT_DIR=" + opts.AndroidProjectPath,
+		"UPACK_MODULE=" + opts.AndroidModuleName,
+		"UPACK_MODULE_DIR=" + opts.moduleDir(),
+		"UPACK_AAR=" + opts.moduleAarFile(),
+	}
+}
+
+// runCommand runs script with the shell in the directory of the config file,
+// its output is logged under module.
+func runCommand(module, script string, env []string) error {
+	cmd := shellCommand(script)
+	cmd.Dir = conf.dir
+	cmd.Env = append(os.Environ(), env...)
+	stdout, stderr := newLogWriter(module, levelInfo), newLogWriter(module, levelInfo)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := runCmd(cmd)
+	stdout.Flush()
+	stderr.Flush()
+	if err != nil {
+		if cerr := checkCanceled(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return nil
+}
+
+// runExecStage runs the command of the stage s, env tells it what it works
+// on.
+func runExecStage(s pipelineStage, env []string) error {
+	defer timePhase(s.Name)()
+	logDebug("running pipeline stage %s: %s", s.Name, s.Exec)
+	env = append(append([]string{"UPACK_STAGE=" + s.Name}, runEnv()...), env...)
+	if err := runCommand(s.Name, s.Exec, env); err != nil {
+		return fmt.Errorf("pipeline stage %s fail %w", s.Name, err)
+	}
+	return nil
+}
+
+// runStages runs the stages, builtin runs the built-in ones.
+func runStages(stages []pipelineStage, env []string, builtin func(name string) error) error {
+	for _, s := range stages {
+		var err error
+		if s.isBuiltin() {
+			err = builtin(s.Name)
+		} else if opts.DryRun {
+			planf("run pipeline stage %s: %s", s.Name, s.Exec)
+		} else if diffing {
+			logDebug("skip pipeline stage %s in diff", s.Name)
+		} else {
+			err = runExecStage(s, env)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
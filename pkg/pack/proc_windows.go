@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package pack
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in a process group of its own, so the processes
+// it starts can be stopped together.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcessGroup kills the process tree, Windows has no gentle way to
+// stop a console process of another group.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return killProcessGroup(cmd)
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// shellCommand runs script with the command interpreter.
+func shellCommand(script string) *exec.Cmd {
+	return exec.Command("cmd", "/C", script)
+}
@@ -0,0 +1,164 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// progressDelay is how long an operation runs before its bar is drawn,
+	// quick ones show nothing.
+	progressDelay  = 500 * time.Millisecond
+	progressRedraw = 200 * time.Millisecond
+	// progressInterval is how often the progress lines are logged when
+	// stderr is not a terminal.
+	progressInterval = 15 * time.Second
+	progressBarWidth = 24
+	// progressMinCopy is the size from which copies report progress.
+	progressMinCopy = 16 << 20
+)
+
+var spinner = []string{"|", "/", "-", "\\"}
+
+var (
+	// progressOwner is the operation whose bar is drawn on the last line of
+	// stderr and progressBar the bar, they are guarded by logLock so that
+	// the log records are written over the bar and the bar is drawn again
+	// after them.
+	progressOwner *progress
+	progressBar   string
+)
+
+// progress reports how far a long operation is, as a bar drawn in place on
+// terminals or as a log line every progressInterval otherwise.
+type progress struct {
+	name string
+	// total is the size of the operation, 0 when unknown
+	total   int64
+	done    int64
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startProgress starts reporting the progress of the operation name until
+// finish is called, add tells how much of total is done.
+func startProgress(name string, total int64) *progress {
+	p := &progress{
+		name:    name,
+		total:   total,
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if levelInfo < opts.logLevel() {
+		close(p.stopped)
+		return p
+	}
+	// the bar is redrawn with escapes, the log lines printed over it too
+	bar := opts.LogFormat != logFormatJSON && logOutput == os.Stderr && escapesEnabled(os.Stderr)
+	go p.run(bar)
+	return p
+}
+
+func (p *progress) add(n int64) {
+	atomic.AddInt64(&p.done, n)
+}
+
+// Write counts the bytes written as done, so copies can tee into p.
+func (p *progress) Write(data []byte) (int, error) {
+	p.add(int64(len(data)))
+	return len(data), nil
+}
+
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *progress) run(bar bool) {
+	defer close(p.stopped)
+	delay, every := progressInterval, progressInterval
+	if bar {
+		delay, every = progressDelay, progressRedraw
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-p.stop:
+		return
+	case <-timer.C:
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for tick := 0; ; tick++ {
+		if bar {
+			p.draw(p.barLine(tick))
+		} else {
+			logAt(levelInfo, "", "%s", p.statusLine())
+		}
+		select {
+		case <-p.stop:
+			if bar {
+				p.clear()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *progress) elapsed() time.Duration {
+	return time.Since(p.start).Round(time.Second)
+}
+
+// barLine is like "extracting x.aar [=====>     ]  45% 12.3 MB/27.1 MB 3s",
+// a spinner stands for the bar when the total is unknown.
+func (p *progress) barLine(tick int) string {
+	if p.total <= 0 {
+		return fmt.Sprintf("%s %s %s", p.name, spinner[tick%len(spinner)], p.elapsed())
+	}
+	done := atomic.LoadInt64(&p.done)
+	if done > p.total {
+		done = p.total
+	}
+	filled := int(done * progressBarWidth / p.total)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return fmt.Sprintf("%s [%s] %3d%% %s/%s %s", p.name, bar, done*100/p.total,
+		formatSize(uint64(done)), formatSize(uint64(p.total)), p.elapsed())
+}
+
+func (p *progress) statusLine() string {
+	if p.total <= 0 {
+		return fmt.Sprintf("%s, %s", p.name, p.elapsed())
+	}
+	done := atomic.LoadInt64(&p.done)
+	return fmt.Sprintf("%s, %d%% of %s, %s", p.name, done*100/p.total, formatSize(uint64(p.total)), p.elapsed())
+}
+
+// draw draws the bar of p unless the bar of another operation is shown.
+func (p *progress) draw(line string) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	if progressOwner != nil && progressOwner != p {
+		return
+	}
+	progressOwner, progressBar = p, line
+	fmt.Fprint(os.Stderr, "\r"+line+"\x1b[K")
+}
+
+func (p *progress) clear() {
+	logLock.Lock()
+	defer logLock.Unlock()
+	if progressOwner == p {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		progressOwner, progressBar = nil, ""
+	}
+}
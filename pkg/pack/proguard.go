@@ -0,0 +1,64 @@
+package pack
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/aar"
+)
+
+// aarProguardRules returns the consumer ProGuard rules packed in the AAR at
+// path, an empty string is returned if there is none.
+func aarProguardRules(path string) (string, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if f.Name != "proguard.txt" {
+			continue
+		}
+		content, err := aar.ReadEntry(f)
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	}
+	return "", nil
+}
+
+// patchProguardUserFile merges the consumer ProGuard rules of the AAR into
+// proguard-user.txt, the rules of each module are kept in their own marked
+// block so repeated runs replace them.
+func patchProguardUserFile(templateDir string) error {
+	if !opts.ProguardUserRules {
+		return nil
+	}
+	rules, err := aarProguardRules(opts.moduleAarFile())
+	if err != nil {
+		return err
+	}
+	rules = strings.TrimSpace(rules)
+	if rules == "" {
+		logDebug("no consumer ProGuard rules in %s", opts.moduleAarFile())
+		return nil
+	}
+	path := filepath.Join(templateDir, "proguard-user.txt")
+	if err := checkTemplateExist(path, "Custom Proguard File"); err != nil {
+		return err
+	}
+	b := &markerBlock{
+		Name:    opts.AndroidModuleName + " rules",
+		Comment: "#",
+		Lines:   strings.Split(strings.ReplaceAll(rules, "\r\n", "\n"), "\n"),
+	}
+	return patchFile(path, opts.BackupExtension, func(content string) (string, error) {
+		if c, ok, err := replaceMarkerBlock(content, b); err != nil || ok {
+			return c, err
+		}
+		return appendBlock(content, b), nil
+	})
+}
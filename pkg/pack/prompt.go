@@ -0,0 +1,228 @@
+package pack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+var (
+	settingsInclude = regexp.MustCompile(`(?m)^\s*include\b(.*)$`)
+	quotedModule    = regexp.MustCompile(`["']:?([^"']+)["']`)
+	sourcePackage   = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)`)
+	unityActivity   = regexp.MustCompile(`(extends|:)\s*UnityPlayer(Game)?Activity\b`)
+)
+
+// optionGiven tells whether the option has a value, from the command line,
+// the environment or a prompt.
+func optionGiven(o *flags.Option) bool {
+	return o.IsSet() || !reflect.ValueOf(o.Value()).IsZero()
+}
+
+// canPrompt tells whether the missing options can be asked for, which needs
+// someone at a terminal.
+func canPrompt() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// promptRequiredOptions asks for the required options not given, offering
+// what is found in the Android project. The project is asked for first, the
+// module and the activity are looked up in it.
+func promptRequiredOptions(required []*flags.Option) error {
+	missing := make(map[string]bool)
+	for _, o := range required {
+		if !optionGiven(o) {
+			missing[o.LongName] = true
+		}
+	}
+	in := bufio.NewReader(os.Stdin)
+	if missing["android-path"] {
+		v, err := prompt(in, "Android project path", androidProjectCandidates())
+		if err != nil {
+			return err
+		}
+		opts.AndroidProjectPath = v
+	}
+	if missing["android-module-name"] {
+		v, err := prompt(in, "Android module name", androidModuleCandidates(opts.AndroidProjectPath))
+		if err != nil {
+			return err
+		}
+		opts.AndroidModuleName = v
+	}
+	if missing["entry-activity"] {
+		v, err := prompt(in, "Entry activity", entryActivityCandidates(opts.moduleDir()))
+		if err != nil {
+			return err
+		}
+		opts.AndroidEntryActivity = v
+	}
+	return nil
+}
+
+// prompt asks for the value of name on stderr, one of the candidates can be
+// picked by its number and the first one is the default.
+func prompt(in *bufio.Reader, name string, candidates []string) (string, error) {
+	for i, c := range candidates {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, c)
+	}
+	for {
+		if len(candidates) > 0 {
+			fmt.Fprintf(os.Stderr, "%s [%s]: ", name, candidates[0])
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: ", name)
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("read %s: %w", name, err)
+		}
+		answer := strings.TrimSpace(line)
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(candidates) {
+			return candidates[n-1], nil
+		}
+		switch {
+		case answer != "":
+			return answer, nil
+		case len(candidates) > 0:
+			return candidates[0], nil
+		}
+	}
+}
+
+func hasGradleSettings(dir string) bool {
+	for _, name := range []string{"settings.gradle", "settings.gradle.kts"} {
+		if checkFileExist(filepath.Join(dir, name)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// androidProjectCandidates lists the current directory and the directories
+// under it holding Gradle settings.
+func androidProjectCandidates() []string {
+	var dirs []string
+	if hasGradleSettings(".") {
+		dirs = append(dirs, ".")
+	}
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		return dirs
+	}
+	for _, e := range entries {
+		if e.IsDir() && hasGradleSettings(e.Name()) {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	return dirs
+}
+
+// androidModuleCandidates lists the modules included by the Gradle settings
+// of the project, or else its directories with a build script. Library
+// modules come first, they are what plugins are built from.
+func androidModuleCandidates(projectDir string) []string {
+	var modules []string
+	for _, name := range []string{"settings.gradle", "settings.gradle.kts"} {
+		content, err := ioutil.ReadFile(filepath.Join(projectDir, name))
+		if err != nil {
+			continue
+		}
+		for _, m := range settingsInclude.FindAllSubmatch(content, -1) {
+			for _, q := range quotedModule.FindAllSubmatch(m[1], -1) {
+				modules = append(modules, strings.ReplaceAll(string(q[1]), ":", string(os.PathSeparator)))
+			}
+		}
+	}
+	if len(modules) == 0 {
+		entries, err := os.ReadDir(projectDir)
+		if err != nil {
+			return nil
+		}
+		for _, e := range entries {
+			if e.IsDir() && moduleBuildScript(filepath.Join(projectDir, e.Name())) != "" {
+				modules = append(modules, e.Name())
+			}
+		}
+	}
+	isLibrary := func(m string) bool {
+		content, _ := ioutil.ReadFile(moduleBuildScript(filepath.Join(projectDir, m)))
+		return strings.Contains(string(content), "com.android.library")
+	}
+	sort.SliceStable(modules, func(i, j int) bool {
+		return isLibrary(modules[i]) && !isLibrary(modules[j])
+	})
+	return modules
+}
+
+func moduleBuildScript(dir string) string {
+	for _, name := range []string{"build.gradle", "build.gradle.kts"} {
+		if path := filepath.Join(dir, name); checkFileExist(path) == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// entryActivityCandidates lists the classes of the module sources extending
+// the Unity activity, then the activities declared by its manifest.
+func entryActivityCandidates(moduleDir string) []string {
+	var activities []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			activities = append(activities, name)
+		}
+	}
+
+	srcDir := filepath.Join(moduleDir, "src", "main")
+	filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if ext != ".java" && ext != ".kt" {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil || !unityActivity.Match(content) {
+			return nil
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ext)
+		if m := sourcePackage.FindSubmatch(content); m != nil {
+			name = string(m[1]) + "." + name
+		}
+		add(name)
+		return nil
+	})
+
+	if content, err := ioutil.ReadFile(filepath.Join(srcDir, "AndroidManifest.xml")); err == nil {
+		if root, err := manifest.Parse(content); err == nil && root != nil {
+			pkg := root.Package()
+			if app := root.Child("application"); app != nil {
+				for _, c := range app.Children {
+					name, ok := c.AndroidAttr("name")
+					if c.Name.Local != "activity" || !ok {
+						continue
+					}
+					if strings.HasPrefix(name, ".") {
+						name = pkg + name
+					}
+					add(name)
+				}
+			}
+		}
+	}
+	return activities
+}
@@ -0,0 +1,121 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const r8MainClass = "com.android.tools.r8.R8"
+
+// androidSdkDir returns the Android SDK directory given by options or the
+// environment.
+func androidSdkDir() (string, error) {
+	for _, dir := range []string{opts.AndroidSdk, os.Getenv("ANDROID_HOME"), os.Getenv("ANDROID_SDK_ROOT")} {
+		if dir != "" {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("Android SDK no found, set ANDROID_HOME or --android-sdk")
+}
+
+var versionNumber = regexp.MustCompile(`\d+`)
+
+// versionLess compares versions like 30.0.3 or android-33 number by number.
+func versionLess(a, b string) bool {
+	an := versionNumber.FindAllString(a, -1)
+	bn := versionNumber.FindAllString(b, -1)
+	for i := 0; i < len(an) && i < len(bn); i++ {
+		x, _ := strconv.Atoi(an[i])
+		y, _ := strconv.Atoi(bn[i])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(an) < len(bn)
+}
+
+// latestSdkFile returns the file named name in the newest versioned
+// directory of the Android SDK matching pattern, e.g. build-tools/*.
+func latestSdkFile(sdkDir, pattern, name string) (string, error) {
+	dirs, err := filepath.Glob(filepath.Join(sdkDir, pattern))
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return versionLess(filepath.Base(dirs[i]), filepath.Base(dirs[j]))
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := filepath.Join(dirs[i], name)
+		if checkFileExist(path) == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s no found in %s", name, filepath.Join(sdkDir, pattern))
+}
+
+// r8Jar returns the jar providing R8, the one shipped with the newest build
+// tools of the Android SDK by default.
+func r8Jar(sdkDir string) (string, error) {
+	if opts.R8Jar != "" {
+		return opts.R8Jar, nil
+	}
+	return latestSdkFile(sdkDir, "build-tools/*", filepath.Join("lib", "d8.jar"))
+}
+
+// minifyJar runs R8 with the given rules over classes.jar of the extracted
+// AAR in plugDir, the other jars of the AAR and the Android platform are
+// referenced as libraries.
+func minifyJar(plugDir string) error {
+	if len(opts.R8Rules) == 0 {
+		return nil
+	}
+	if opts.DryRun {
+		planf("minify classes.jar with R8, not run in dry run")
+		return nil
+	}
+	jarFile := filepath.Join(plugDir, "classes.jar")
+	if err := checkFileExist(jarFile); err != nil {
+		return fmt.Errorf("minify: %w", err)
+	}
+	sdkDir, err := androidSdkDir()
+	if err != nil {
+		return err
+	}
+	r8, err := r8Jar(sdkDir)
+	if err != nil {
+		return err
+	}
+	androidJar, err := latestSdkFile(sdkDir, "platforms/android-*", "android.jar")
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "upack-r8")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	outFile := filepath.Join(tmpDir, "classes.jar")
+	args := []string{"-cp", r8, r8MainClass, "--release", "--classfile", "--output", outFile, "--lib", androidJar}
+	for _, r := range opts.R8Rules {
+		args = append(args, "--pg-conf", r)
+	}
+	libJars, err := filepath.Glob(filepath.Join(plugDir, "libs", "*.jar"))
+	if err != nil {
+		return err
+	}
+	for _, j := range libJars {
+		args = append(args, "--classpath", j)
+	}
+	args = append(args, jarFile)
+
+	logTrace("start minifying %s with R8 ...", jarFile)
+	if err := runCommandAt(plugDir, "java", args...); err != nil {
+		return fmt.Errorf("minify %s fail: %w", jarFile, err)
+	}
+	return moveFile(outFile, jarFile)
+}
@@ -0,0 +1,252 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// relocation moves the classes of a package, e.g. com.google.gson to
+// shaded.com.google.gson.
+type relocation struct {
+	// From and To are internal names like com/google/gson/.
+	From string
+	To   string
+}
+
+// relocations holds the relocations given by options.
+var relocations []relocation
+
+func parseRelocations(pairs []string) ([]relocation, error) {
+	kvs, err := parseKeyValues("relocation", pairs)
+	if err != nil {
+		return nil, err
+	}
+	rs := make([]relocation, 0, len(kvs))
+	for _, kv := range kvs {
+		if kv.Value == "" {
+			return nil, fmt.Errorf("illegal relocation %s=, target package expected", kv.Key)
+		}
+		rs = append(rs, relocation{
+			From: strings.ReplaceAll(kv.Key, ".", "/") + "/",
+			To:   strings.ReplaceAll(kv.Value, ".", "/") + "/",
+		})
+	}
+	return rs, nil
+}
+
+// relocateName rewrites the internal class names in s, names are matched at
+// the start of s or right after the L of a type descriptor.
+func relocateName(s string, rs []relocation) string {
+	for _, r := range rs {
+		if !strings.Contains(s, r.From) {
+			continue
+		}
+		var sb strings.Builder
+		for {
+			i := strings.Index(s, r.From)
+			if i < 0 {
+				break
+			}
+			sb.WriteString(s[:i])
+			if i == 0 || s[i-1] == 'L' {
+				sb.WriteString(r.To)
+			} else {
+				sb.WriteString(r.From)
+			}
+			s = s[i+len(r.From):]
+		}
+		sb.WriteString(s)
+		s = sb.String()
+	}
+	return s
+}
+
+// relocateDottedName rewrites a dotted class name like com.google.gson.Gson,
+// which is how classes are referenced by reflection and service files.
+func relocateDottedName(s string, rs []relocation) string {
+	for _, r := range rs {
+		from := strings.ReplaceAll(r.From, "/", ".")
+		if strings.HasPrefix(s, from) {
+			return strings.ReplaceAll(r.To, "/", ".") + s[len(from):]
+		}
+	}
+	return s
+}
+
+const (
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+// constantSize returns the size of a constant pool entry following its tag,
+// except for CONSTANT_Utf8 which has a variable size.
+func constantSize(tag byte) (int, error) {
+	switch tag {
+	case constantClass, constantString, constantMethodType, constantModule, constantPackage:
+		return 2, nil
+	case constantMethodHandle:
+		return 3, nil
+	case constantInteger, constantFloat, constantFieldref, constantMethodref, constantInterfaceMethodref,
+		constantNameAndType, constantDynamic, constantInvokeDynamic:
+		return 4, nil
+	case constantLong, constantDouble:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("unknown constant pool tag %d", tag)
+}
+
+type classConstant struct {
+	tag  byte
+	utf8 string
+	raw  []byte
+}
+
+// parseConstantPool parses the constant pool of a class file, the offset
+// right after the pool is returned too. Index 0 and the entries following
+// 8-byte constants are left empty.
+func parseConstantPool(class []byte) ([]classConstant, int, error) {
+	if len(class) < 10 || binary.BigEndian.Uint32(class) != 0xCAFEBABE {
+		return nil, 0, fmt.Errorf("not a class file")
+	}
+	count := int(binary.BigEndian.Uint16(class[8:]))
+	pos := 10
+	pool := make([]classConstant, count)
+	for i := 1; i < count; i++ {
+		if pos >= len(class) {
+			return nil, 0, fmt.Errorf("truncated constant pool")
+		}
+		tag := class[pos]
+		pos++
+		if tag == constantUtf8 {
+			if pos+2 > len(class) {
+				return nil, 0, fmt.Errorf("truncated constant pool")
+			}
+			n := int(binary.BigEndian.Uint16(class[pos:]))
+			if pos+2+n > len(class) {
+				return nil, 0, fmt.Errorf("truncated constant pool")
+			}
+			pool[i] = classConstant{tag: tag, utf8: string(class[pos+2 : pos+2+n])}
+			pos += 2 + n
+			continue
+		}
+		size, err := constantSize(tag)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pos+size > len(class) {
+			return nil, 0, fmt.Errorf("truncated constant pool")
+		}
+		pool[i] = classConstant{tag: tag, raw: class[pos : pos+size]}
+		pos += size
+		if tag == constantLong || tag == constantDouble {
+			// 8-byte constants take two entries
+			i++
+		}
+	}
+	return pool, pos, nil
+}
+
+// ref returns the n-th constant pool index referenced by a constant.
+func (c *classConstant) ref(n int) int {
+	return int(binary.BigEndian.Uint16(c.raw[2*n:]))
+}
+
+// relocateClass rewrites the class names in the constant pool of a class
+// file, the rest of the class file refers to constants by index and is kept
+// as is.
+func relocateClass(class []byte, rs []relocation) ([]byte, error) {
+	pool, pos, err := parseConstantPool(class)
+	if err != nil {
+		return nil, err
+	}
+	literals := make(map[int]bool)
+	for _, c := range pool {
+		if c.tag == constantString {
+			literals[c.ref(0)] = true
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(class[:10])
+	for i := 1; i < len(pool); i++ {
+		c := pool[i]
+		if c.tag == 0 {
+			continue
+		}
+		buf.WriteByte(c.tag)
+		if c.tag != constantUtf8 {
+			buf.Write(c.raw)
+			continue
+		}
+		s := relocateName(c.utf8, rs)
+		if literals[i] {
+			s = relocateDottedName(s, rs)
+		}
+		if len(s) > 0xFFFF {
+			return nil, fmt.Errorf("relocated constant too long")
+		}
+		var n [2]byte
+		binary.BigEndian.PutUint16(n[:], uint16(len(s)))
+		buf.Write(n[:])
+		buf.WriteString(s)
+	}
+	buf.Write(class[pos:])
+	return buf.Bytes(), nil
+}
+
+// relocateServiceFile rewrites the implementation class names listed in a
+// META-INF/services file.
+func relocateServiceFile(content []byte, rs []relocation) []byte {
+	lines := strings.Split(string(content), "\n")
+	for i, l := range lines {
+		lines[i] = relocateDottedName(l, rs)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// relocatePath returns the path of a jar entry after relocation.
+func relocatePath(path string, rs []relocation) string {
+	path = filepath.ToSlash(path)
+	const services = "META-INF/services/"
+	if strings.HasPrefix(path, services) {
+		return services + relocateDottedName(strings.TrimPrefix(path, services), rs)
+	}
+	return relocateName(path, rs)
+}
+
+// needRelocate tells whether the content of a jar entry is rewritten by
+// relocation.
+func needRelocate(name string) bool {
+	return len(relocations) > 0 &&
+		(strings.HasSuffix(name, ".class") || strings.HasPrefix(name, "META-INF/services/"))
+}
+
+// relocateEntry rewrites the content of a jar entry named name.
+func relocateEntry(name string, content []byte) ([]byte, error) {
+	if strings.HasSuffix(name, ".class") {
+		relocated, err := relocateClass(content, relocations)
+		if err != nil {
+			return nil, fmt.Errorf("relocate %s: %w", name, err)
+		}
+		return relocated, nil
+	}
+	return relocateServiceFile(content, relocations), nil
+}
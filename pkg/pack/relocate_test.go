@@ -0,0 +1,189 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// classFile assembles a class file holding the constants, which are
+// numbered from 1 with 8-byte constants taking two entries, followed by
+// body standing for the rest of the class.
+func classFile(body []byte, constants ...classConstant) []byte {
+	var buf bytes.Buffer
+	u16 := func(v int) {
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(v))
+		buf.Write(b[:])
+	}
+	buf.Write([]byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0, 0, 52})
+	count := 1
+	for _, c := range constants {
+		count++
+		if c.tag == constantLong || c.tag == constantDouble {
+			count++
+		}
+	}
+	u16(count)
+	for _, c := range constants {
+		buf.WriteByte(c.tag)
+		if c.tag == constantUtf8 {
+			u16(len(c.utf8))
+			buf.WriteString(c.utf8)
+		} else {
+			buf.Write(c.raw)
+		}
+	}
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func utf8Constant(s string) classConstant {
+	return classConstant{tag: constantUtf8, utf8: s}
+}
+
+// refConstant is a constant referring to others by index, e.g. a
+// CONSTANT_Class naming its CONSTANT_Utf8.
+func refConstant(tag byte, refs ...int) classConstant {
+	raw := make([]byte, 2*len(refs))
+	for i, r := range refs {
+		binary.BigEndian.PutUint16(raw[2*i:], uint16(r))
+	}
+	return classConstant{tag: tag, raw: raw}
+}
+
+var gsonRelocations = []relocation{{From: "com/google/gson/", To: "shaded/com/google/gson/"}}
+
+func TestRelocateClass(t *testing.T) {
+	tests := []struct {
+		name string
+		utf8 string
+		// literal makes the constant the value of a CONSTANT_String
+		literal bool
+		want    string
+	}{
+		{name: "class name", utf8: "com/google/gson/Gson", want: "shaded/com/google/gson/Gson"},
+		{name: "nested class name", utf8: "com/google/gson/Gson$Builder", want: "shaded/com/google/gson/Gson$Builder"},
+		{name: "class of another package", utf8: "com/google/gsonx/Gson", want: "com/google/gsonx/Gson"},
+		{name: "field descriptor", utf8: "Lcom/google/gson/Gson;", want: "Lshaded/com/google/gson/Gson;"},
+		{name: "array descriptor", utf8: "[[Lcom/google/gson/JsonElement;", want: "[[Lshaded/com/google/gson/JsonElement;"},
+		{
+			name: "method descriptor",
+			utf8: "(Lcom/google/gson/Gson;ILjava/lang/String;)Lcom/google/gson/JsonElement;",
+			want: "(Lshaded/com/google/gson/Gson;ILjava/lang/String;)Lshaded/com/google/gson/JsonElement;",
+		},
+		{
+			name: "generic signature",
+			utf8: "Ljava/util/Map<Ljava/lang/String;Ljava/util/List<Lcom/google/gson/JsonElement;>;>;",
+			want: "Ljava/util/Map<Ljava/lang/String;Ljava/util/List<Lshaded/com/google/gson/JsonElement;>;>;",
+		},
+		{name: "name inside another name", utf8: "Xcom/google/gson/Gson", want: "Xcom/google/gson/Gson"},
+		{name: "dotted name", utf8: "com.google.gson.Gson", want: "com.google.gson.Gson"},
+		{name: "dotted string literal", utf8: "com.google.gson.Gson", literal: true, want: "shaded.com.google.gson.Gson"},
+		{name: "internal name string literal", utf8: "com/google/gson/Gson", literal: true, want: "shaded/com/google/gson/Gson"},
+		{name: "unrelated string literal", utf8: "com.google.gsonx.Gson", literal: true, want: "com.google.gsonx.Gson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// #1 the tested constant, #2 a Long taking #3 too, #4 a
+			// Class or a String referring to #1
+			constants := []classConstant{
+				utf8Constant(tt.utf8),
+				{tag: constantLong, raw: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+				refConstant(constantClass, 1),
+			}
+			if tt.literal {
+				constants[2] = refConstant(constantString, 1)
+			}
+			body := []byte{0, 0x21, 0, 4, 0, 0, 0xAB}
+			got, err := relocateClass(classFile(body, constants...), gsonRelocations)
+			if err != nil {
+				t.Fatalf("relocateClass() = %v", err)
+			}
+
+			pool, pos, err := parseConstantPool(got)
+			if err != nil {
+				t.Fatalf("parse relocated class: %v", err)
+			}
+			if len(pool) != 5 {
+				t.Fatalf("%d constants, want 5", len(pool))
+			}
+			if pool[1].utf8 != tt.want {
+				t.Errorf("relocated to %q, want %q", pool[1].utf8, tt.want)
+			}
+			if pool[2].tag != constantLong || !bytes.Equal(pool[2].raw, constants[1].raw) || pool[3].tag != 0 {
+				t.Errorf("Long constant changed: %+v %+v", pool[2], pool[3])
+			}
+			if pool[4].tag != constants[2].tag || pool[4].ref(0) != 1 {
+				t.Errorf("reference changed: %+v", pool[4])
+			}
+			if !bytes.Equal(got[pos:], body) {
+				t.Errorf("rest of the class = %x, want %x", got[pos:], body)
+			}
+		})
+	}
+}
+
+func TestRelocateClassErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		class []byte
+	}{
+		{name: "not a class file", class: []byte("PK\x03\x04 not a class")},
+		{name: "truncated constant pool", class: classFile(nil, utf8Constant("com/google/gson/Gson"))[:14]},
+		{name: "unknown constant", class: classFile(nil, classConstant{tag: 2, raw: []byte{0, 0}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := relocateClass(tt.class, gsonRelocations); err == nil {
+				t.Errorf("relocateClass() succeeded, error expected")
+			}
+		})
+	}
+}
+
+func TestRelocatePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"com/google/gson/Gson.class", "shaded/com/google/gson/Gson.class"},
+		{"com/google/gson/internal/Excluder.class", "shaded/com/google/gson/internal/Excluder.class"},
+		{"com/example/Main.class", "com/example/Main.class"},
+		{"META-INF/services/com.google.gson.TypeAdapterFactory", "META-INF/services/shaded.com.google.gson.TypeAdapterFactory"},
+		{"META-INF/services/java.sql.Driver", "META-INF/services/java.sql.Driver"},
+	}
+	for _, tt := range tests {
+		if got := relocatePath(tt.path, gsonRelocations); got != tt.want {
+			t.Errorf("relocatePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRelocateServiceFile(t *testing.T) {
+	content := "com.google.gson.internal.Factory\ncom.example.Factory\n"
+	want := "shaded.com.google.gson.internal.Factory\ncom.example.Factory\n"
+	if got := string(relocateServiceFile([]byte(content), gsonRelocations)); got != want {
+		t.Errorf("relocateServiceFile() = %q, want %q", got, want)
+	}
+}
+
+func TestParseRelocations(t *testing.T) {
+	got, err := parseRelocations([]string{"com.google.gson=shaded.com.google.gson", "okio=shaded.okio"})
+	if err != nil {
+		t.Fatalf("parseRelocations() = %v", err)
+	}
+	want := []relocation{
+		{From: "com/google/gson/", To: "shaded/com/google/gson/"},
+		{From: "okio/", To: "shaded/okio/"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRelocations() = %+v, want %+v", got, want)
+	}
+	for _, pairs := range [][]string{{"com.google.gson="}, {"com.google.gson"}} {
+		if _, err := parseRelocations(pairs); err == nil {
+			t.Errorf("parseRelocations(%q) succeeded, error expected", pairs)
+		}
+	}
+}
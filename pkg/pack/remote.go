@@ -0,0 +1,170 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The project is uploaded into a directory of its own under the remote
+// directory, marked as created by upack, as the upload deletes the files
+// there which are not in the local project.
+const (
+	remoteProjectDirName = "upack-project"
+	remoteMarkerName     = ".upack-remote"
+)
+
+// remoteTarget is where the Android project is built when --remote is given,
+// Host is anything ssh accepts, e.g. user@host.
+type remoteTarget struct {
+	Host string
+	Dir  string
+}
+
+var remote *remoteTarget
+
+func parseRemote(s string) (*remoteTarget, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 || i == len(s)-1 {
+		return nil, fmt.Errorf("illegal remote %s, should be in user@host:/path form", s)
+	}
+	host, dir := s[:i], s[i+1:]
+	if strings.HasPrefix(host, "-") {
+		return nil, fmt.Errorf("illegal remote host %s, can't start with -", host)
+	}
+	// the quoted paths given to the remote shell are not expanded, a path
+	// under the home directory is made relative, which ssh and rsync both
+	// resolve against the home directory
+	switch {
+	case dir == "~":
+		return nil, fmt.Errorf("illegal remote path %s, a directory under the home directory expected", dir)
+	case strings.HasPrefix(dir, "~/"):
+		dir = strings.TrimPrefix(dir, "~/")
+	case strings.HasPrefix(dir, "~"):
+		return nil, fmt.Errorf("illegal remote path %s, the home directory of another user is not supported", dir)
+	}
+	clean := path.Clean(dir)
+	if clean == "." || clean == "/" || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, fmt.Errorf("illegal remote path %s, a directory of its own expected", dir)
+	}
+	return &remoteTarget{Host: host, Dir: clean}, nil
+}
+
+// shellQuote quotes s for the POSIX shell running the remote commands.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (r *remoteTarget) String() string {
+	return r.Host + ":" + r.Dir
+}
+
+// projectDir returns the remote directory the project is uploaded to.
+func (r *remoteTarget) projectDir() string {
+	return path.Join(r.Dir, remoteProjectDirName)
+}
+
+// prepare creates the remote project directory and marks it, an existing
+// directory upack didn't create is refused.
+func (r *remoteTarget) prepare() error {
+	dir := shellQuote(r.projectDir())
+	marker := shellQuote(path.Join(r.projectDir(), remoteMarkerName))
+	script := fmt.Sprintf("if [ -e %s ] && [ ! -f %s ]; then echo %s exists but was not created by upack >&2; exit 1; fi; mkdir -p %s && touch %s",
+		dir, marker, dir, dir, marker)
+	return runCommandAt(".", "ssh", r.Host, script)
+}
+
+// rsyncExcludes returns the rsync options leaving out what walkSources
+// skips. Excluded remote files are neither replaced nor deleted, so the
+// Gradle caches and the local.properties of the remote machine survive.
+func rsyncExcludes(projectDir string) ([]string, error) {
+	excludes := []string{
+		"--exclude=/" + localPropertiesName,
+		"--exclude=/" + remoteMarkerName,
+		"--exclude=" + lockFileName,
+		"--exclude=" + buildCacheFilePrefix + "*",
+		"--exclude=*.iml",
+	}
+	var names []string
+	for name := range buildCacheSkipDirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	err := filepath.Walk(projectDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(projectDir, p)
+		if err != nil {
+			return err
+		}
+		if relPath != "." && buildCacheSkipDirs[info.Name()] && isModuleRoot(projectDir, filepath.Dir(p)) {
+			return filepath.SkipDir
+		}
+		if !isModuleRoot(projectDir, p) {
+			return nil
+		}
+		// anchored, a directory named build deeper in the sources is synced
+		for _, name := range names {
+			excludes = append(excludes, "--exclude="+path.Join("/", filepath.ToSlash(relPath), name)+"/")
+		}
+		return nil
+	})
+	return excludes, err
+}
+
+// upload brings the remote project directory up to date with the local
+// Android project with rsync, files deleted locally are deleted there too
+// so they don't linger in the remote build.
+func (r *remoteTarget) upload(projectDir string) error {
+	logDebug("uploading %s to %s ...", projectDir, r)
+	if err := r.prepare(); err != nil {
+		return err
+	}
+	excludes, err := rsyncExcludes(projectDir)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"-a", "--delete", "--protect-args"}, excludes...)
+	args = append(args, filepath.Clean(projectDir)+"/", r.Host+":"+r.projectDir()+"/")
+	return runCommandAt(".", "rsync", args...)
+}
+
+// build runs Gradle in the remote directory and downloads the built AAR to
+// where the local build would have put it.
+func (r *remoteTarget) build() error {
+	logDebug("building %s ...", r)
+	args := gradleArgs("assembleDebug")
+	for i := range args {
+		args[i] = shellQuote(args[i])
+	}
+	script := fmt.Sprintf("cd %s && ./gradlew %s", shellQuote(r.projectDir()), strings.Join(args, " "))
+	if err := runGradleAt(".", "ssh", r.Host, script); err != nil {
+		return err
+	}
+
+	if err := makeDir(opts.moduleAarDir(), false); err != nil {
+		return err
+	}
+	aarFile := path.Join(r.projectDir(), opts.AndroidModuleName, "build", "outputs", "aar", path.Base(opts.moduleAarFile()))
+	logDebug("downloading %s from %s ...", aarFile, r.Host)
+	return runCommandAt(".", "scp", "-q", r.Host+":"+aarFile, opts.moduleAarFile())
+}
+
+// buildAndroidRemote builds the Android project on the remote machine, where
+// the Android SDK lives, and pulls the AAR back.
+func buildAndroidRemote(projectDir string, r *remoteTarget) error {
+	if err := r.upload(projectDir); err != nil {
+		return fmt.Errorf("upload Android project to %s fail %w", r, err)
+	}
+	if err := r.build(); err != nil {
+		return fmt.Errorf("build Android project on %s fail %w", r, err)
+	}
+	return nil
+}
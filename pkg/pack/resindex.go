@@ -0,0 +1,275 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/aar"
+)
+
+// resourceType returns the resource type of a res directory like
+// drawable-hdpi.
+func resourceType(dir string) string {
+	return strings.SplitN(dir, "-", 2)[0]
+}
+
+// valuesResourceKeys parses a values XML file and returns the type/name keys
+// of the resources defined in it.
+func valuesResourceKeys(content []byte) ([]string, error) {
+	var keys []string
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth != 2 {
+				continue
+			}
+			typ := t.Name.Local
+			var name string
+			for _, a := range t.Attr {
+				switch a.Name.Local {
+				case "name":
+					name = a.Value
+				case "type":
+					if typ == "item" {
+						typ = a.Value
+					}
+				}
+			}
+			switch typ {
+			case "string-array", "integer-array":
+				typ = "array"
+			case "declare-styleable":
+				typ = "styleable"
+			}
+			if name != "" {
+				keys = append(keys, typ+"/"+name)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// resourceKeys returns the type/name keys of the resources defined by the
+// file at relPath, which is relative to the res directory.
+func resourceKeys(relPath string, read func() ([]byte, error)) ([]string, error) {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	if len(parts) != 2 {
+		return nil, nil
+	}
+	typ := resourceType(parts[0])
+	if typ == "values" {
+		content, err := read()
+		if err != nil {
+			return nil, err
+		}
+		keys, err := valuesResourceKeys(content)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", relPath, err)
+		}
+		return keys, nil
+	}
+	name := parts[1]
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return []string{typ + "/" + name}, nil
+}
+
+func addResourceKeys(set map[string]bool, keys []string) {
+	for _, k := range keys {
+		set[k] = true
+	}
+}
+
+// archiveResources returns the resources defined in the res directory of an
+// AAR.
+func archiveResources(path string) (map[string]bool, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer archive.Close()
+
+	set := make(map[string]bool)
+	for _, f := range archive.File {
+		if !strings.HasPrefix(f.Name, "res/") || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		f := f
+		keys, err := resourceKeys(strings.TrimPrefix(f.Name, "res/"), func() ([]byte, error) {
+			return aar.ReadEntry(f)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		addResourceKeys(set, keys)
+	}
+	return set, nil
+}
+
+// dirResources returns the resources defined in resDir.
+func dirResources(resDir string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	err := filepath.Walk(resDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(resDir, path)
+		if err != nil {
+			return err
+		}
+		keys, err := resourceKeys(relPath, func() ([]byte, error) {
+			return ioutil.ReadFile(path)
+		})
+		if err != nil {
+			return err
+		}
+		addResourceKeys(set, keys)
+		return nil
+	})
+	return set, err
+}
+
+// isLibraryProjectDir tells whether dir is an exploded Android library
+// project, which has a res directory next to its manifest.
+func isLibraryProjectDir(dir string) bool {
+	return checkFileExist(filepath.Join(dir, "AndroidManifest.xml")) == nil &&
+		checkDirExist(filepath.Join(dir, "res")) == nil
+}
+
+// pluginResources collects the resources of every Android plugin under dir
+// which is not owned by this plugin, keyed by plugin path.
+func pluginResources(dir string, owned map[string]bool) (map[string]map[string]bool, error) {
+	plugins := make(map[string]map[string]bool)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		skip := owned[path] || isSavedPath(path)
+		if info.IsDir() {
+			if skip {
+				return filepath.SkipDir
+			}
+			if path != dir && isLibraryProjectDir(path) {
+				res, err := dirResources(filepath.Join(path, "res"))
+				if err != nil {
+					return err
+				}
+				plugins[path] = res
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".aar", ".srcaar":
+			if skip {
+				return nil
+			}
+			res, err := archiveResources(path)
+			if err != nil {
+				return err
+			}
+			plugins[path] = res
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return plugins, nil
+	}
+	return plugins, err
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkResourcePrefix returns the resources whose name lacks prefix.
+func checkResourcePrefix(res map[string]bool, prefix string) []string {
+	var bad []string
+	for _, k := range sortedKeys(res) {
+		name := k[strings.Index(k, "/")+1:]
+		if !strings.HasPrefix(name, prefix) {
+			bad = append(bad, k)
+		}
+	}
+	return bad
+}
+
+// verifyResources checks the resources of the built AAR against the other
+// Android plugins of the Unity project baseDir belongs to, and against the
+// required resource prefix.
+func verifyResources(format, baseDir string) error {
+	if opts.ResourceConflicts == policyOff && opts.ResourcePrefix == "" {
+		return nil
+	}
+	logTrace("start checking resource conflicts ...")
+	res, err := archiveResources(opts.moduleAarFile())
+	if err != nil {
+		return err
+	}
+
+	if opts.ResourcePrefix != "" {
+		if bad := checkResourcePrefix(res, opts.ResourcePrefix); len(bad) > 0 {
+			return fmt.Errorf("resources without prefix %s:\n  %s", opts.ResourcePrefix, strings.Join(bad, "\n  "))
+		}
+	}
+	if opts.ResourceConflicts == policyOff {
+		return nil
+	}
+
+	scanDir := unityTemplateDir(baseDir)
+	plugins, err := pluginResources(scanDir, ownedPaths(format, baseDir))
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", scanDir, err)
+	}
+	var conflicts []string
+	for _, path := range sortedKeys(pluginPaths(plugins)) {
+		for _, k := range sortedKeys(res) {
+			if plugins[path][k] {
+				conflicts = append(conflicts, fmt.Sprintf("%s conflicts with %s", k, path))
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if opts.ResourceConflicts == policyWarn {
+		for _, c := range conflicts {
+			logWarning("resource %s", c)
+		}
+		return nil
+	}
+	return fmt.Errorf("resource conflicts found:\n  %s", strings.Join(conflicts, "\n  "))
+}
+
+func pluginPaths(plugins map[string]map[string]bool) map[string]bool {
+	paths := make(map[string]bool, len(plugins))
+	for p := range plugins {
+		paths[p] = true
+	}
+	return paths
+}
@@ -0,0 +1,292 @@
+package pack
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/zhiruili/upack/pkg/aar"
+)
+
+// resourceXMLRef matches references like @drawable/icon or @+id/button in
+// resource and manifest files, the platform ones are skipped by callers.
+var resourceXMLRef = regexp.MustCompile(`@\+?(?:([\w.]+):)?([a-z-]+)/([\w.]+)`)
+
+// manifestResourceRefs holds the resources referenced by the rendered
+// manifests, which are roots of the unused resource analysis.
+var manifestResourceRefs = make(map[string]bool)
+
+// resetManifestResourceRefs forgets the references of the previous run.
+func resetManifestResourceRefs() {
+	manifestResourceRefs = make(map[string]bool)
+}
+
+// xmlResourceRefs adds the type/name keys of the resources referenced by an
+// XML file to refs.
+func xmlResourceRefs(content []byte, refs map[string]bool) {
+	for _, m := range resourceXMLRef.FindAllSubmatch(content, -1) {
+		if string(m[1]) == "android" {
+			continue
+		}
+		refs[string(m[2])+"/"+strings.ReplaceAll(string(m[3]), ".", "_")] = true
+	}
+}
+
+// classResourceRefs adds the resources referenced by a class file to refs,
+// both the fields of R classes and the string constants which may be passed
+// to Resources.getIdentifier are taken as references.
+func classResourceRefs(class []byte, refs map[string]bool, names map[string]bool) error {
+	pool, _, err := parseConstantPool(class)
+	if err != nil {
+		return err
+	}
+	utf8 := func(i int) string {
+		if i <= 0 || i >= len(pool) {
+			return ""
+		}
+		return pool[i].utf8
+	}
+	for _, c := range pool {
+		switch c.tag {
+		case constantFieldref:
+			class, nat := c.ref(0), c.ref(1)
+			if class >= len(pool) || pool[class].tag != constantClass ||
+				nat >= len(pool) || pool[nat].tag != constantNameAndType {
+				continue
+			}
+			className := utf8(pool[class].ref(0))
+			i := strings.LastIndex("/"+className, "/R$")
+			if i < 0 {
+				continue
+			}
+			refs[className[i+2:]+"/"+utf8(pool[nat].ref(0))] = true
+		case constantString:
+			names[utf8(c.ref(0))] = true
+		}
+	}
+	return nil
+}
+
+// jarResourceRefs adds the resources referenced by the classes in a jar.
+func jarResourceRefs(path string, refs map[string]bool, names map[string]bool) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if !strings.HasSuffix(f.Name, ".class") {
+			continue
+		}
+		content, err := aar.ReadEntry(f)
+		if err != nil {
+			return err
+		}
+		if err := classResourceRefs(content, refs, names); err != nil {
+			return fmt.Errorf("%s in %s: %w", f.Name, path, err)
+		}
+	}
+	return nil
+}
+
+type resourceFile struct {
+	Key  string
+	Path string
+}
+
+// fileResources returns the resources defined by files in the res directory
+// of the AAR extracted to dir, the values are not included.
+func fileResources(dir string) ([]resourceFile, error) {
+	resDir := filepath.Join(dir, "res")
+	var files []resourceFile
+	err := filepath.Walk(resDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(resDir, path)
+		if err != nil {
+			return err
+		}
+		if resourceType(filepath.Base(filepath.Dir(path))) == "values" {
+			return nil
+		}
+		keys, err := resourceKeys(relPath, nil)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			files = append(files, resourceFile{Key: k, Path: path})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return files, err
+}
+
+// resourceRoots collects the resources referenced by the classes, the
+// manifests and the values of the AAR extracted to dir.
+func resourceRoots(dir string) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	names := make(map[string]bool)
+	for k := range manifestResourceRefs {
+		refs[k] = true
+	}
+
+	jars, err := filepath.Glob(filepath.Join(dir, "libs", "*.jar"))
+	if err != nil {
+		return nil, err
+	}
+	if checkFileExist(filepath.Join(dir, "classes.jar")) == nil {
+		jars = append(jars, filepath.Join(dir, "classes.jar"))
+	}
+	for _, j := range jars {
+		if err := jarResourceRefs(j, refs, names); err != nil {
+			return nil, err
+		}
+	}
+
+	xmlFiles, err := filepath.Glob(filepath.Join(dir, "res", "values*", "*.xml"))
+	if err != nil {
+		return nil, err
+	}
+	xmlFiles = append(xmlFiles, filepath.Join(dir, "AndroidManifest.xml"))
+	for _, f := range xmlFiles {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		xmlResourceRefs(content, refs)
+	}
+
+	// names looked up dynamically keep the resources of every type
+	for n := range names {
+		refs["*/"+n] = true
+	}
+	return refs, nil
+}
+
+func resourceReferenced(refs map[string]bool, key string) bool {
+	name := key[strings.Index(key, "/")+1:]
+	return refs[key] || refs["*/"+name]
+}
+
+// stripUnusedResources removes the file resources of the AAR extracted to
+// dir which are not reachable from the classes, the manifests or the values,
+// the dropped resources are reported in the module build directory.
+func stripUnusedResources(dir string) error {
+	if !opts.StripUnusedResources {
+		return nil
+	}
+	files, err := fileResources(dir)
+	if err != nil {
+		return err
+	}
+	refs, err := resourceRoots(dir)
+	if err != nil {
+		return err
+	}
+
+	// the XML files of referenced resources may reference others
+	reached := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, f := range files {
+			if reached[f.Path] || !resourceReferenced(refs, f.Key) {
+				continue
+			}
+			reached[f.Path] = true
+			changed = true
+			if strings.HasSuffix(f.Path, ".xml") {
+				content, err := ioutil.ReadFile(f.Path)
+				if err != nil {
+					return err
+				}
+				xmlResourceRefs(content, refs)
+			}
+		}
+	}
+
+	var report strings.Builder
+	dropped := make(map[string]bool)
+	for _, f := range files {
+		if reached[f.Path] {
+			continue
+		}
+		relPath, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			return err
+		}
+		logDebug("strip unused resource %s", filepath.ToSlash(relPath))
+		if err := os.Remove(f.Path); err != nil {
+			return err
+		}
+		dropped[f.Key] = true
+		report.WriteString(filepath.ToSlash(relPath) + "\n")
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	logTrace("%d unused resource files stripped", len(dropped))
+	if err := stripRTxt(filepath.Join(dir, "R.txt"), dropped); err != nil {
+		return err
+	}
+	reportFile := opts.unusedResourcesReportFile()
+	if opts.DryRun {
+		planf("report %d unused resource files in %s", len(dropped), reportFile)
+	}
+	if previewing() {
+		return nil
+	}
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	if err := makeDir(filepath.Dir(reportFile), false); err != nil {
+		return err
+	}
+	logDebug("unused resources report at: %s", reportFile)
+	return ioutil.WriteFile(reportFile, []byte(report.String()), 0644)
+}
+
+// reportLock serializes writing the report shared by the output
+// directories.
+var reportLock sync.Mutex
+
+func (o *Options) unusedResourcesReportFile() string {
+	return filepath.Join(o.moduleDir(), "build", "upack", "unused-resources.txt")
+}
+
+// stripRTxt removes the symbols of the dropped resources from R.txt, lines
+// look like "int drawable icon 0x7f020000".
+func stripRTxt(path string, dropped map[string]bool) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var sb strings.Builder
+	s := bufio.NewScanner(strings.NewReader(string(content)))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 3 && dropped[fields[1]+"/"+fields[2]] {
+			continue
+		}
+		sb.WriteString(s.Text() + "\n")
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(sb.String()), 0644)
+}
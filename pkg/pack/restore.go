@@ -0,0 +1,133 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type restoreCommand struct{}
+
+// findBackups lists the backups with extension ext under dir, backups inside
+// backed up directories belong to them and aren't listed.
+func findBackups(dir, ext string) ([]string, error) {
+	var backups []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir || !strings.HasSuffix(path, ext) || strings.HasSuffix(path, tempSaveExt) {
+			return nil
+		}
+		backups = append(backups, path)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return backups, err
+}
+
+// latestBackups picks the latest of the backups found under root made from
+// each output under dir, keyed by the output path. root is dir itself unless
+// the backups go to --backup-dir.
+func latestBackups(backups []string, ext, root, dir string) map[string]string {
+	latest := make(map[string]string)
+	stamps := make(map[string]string)
+	for _, b := range backups {
+		path, stamp := backedUpPath(b, ext)
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		path = filepath.Join(dir, rel)
+		if prev, ok := latest[path]; ok && stamps[prev] >= stamp {
+			continue
+		}
+		latest[path] = b
+		stamps[b] = stamp
+	}
+	return latest
+}
+
+// restoreBackup replaces the output path with its backup.
+func restoreBackup(path, backup string) error {
+	if opts.DryRun {
+		planf("restore %s from %s", path, backup)
+		return nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("delete %s: %w", path, err)
+	}
+	if err := movePath(backup, path); err != nil {
+		return fmt.Errorf("restore %s: %w", path, err)
+	}
+	// the .meta Unity generated for the backup is left without its asset
+	if err := os.Remove(backup + ".meta"); err != nil && !os.IsNotExist(err) {
+		logWarning("remove %s.meta: %v", backup, err)
+	}
+	printProgress("restored %s", path)
+	return nil
+}
+
+// Execute puts the backups made by previous runs with --backup-extension back
+// in place of the outputs under each directory given by args, the latest
+// one of timestamped backups is restored.
+func (c *restoreCommand) Execute(args []string) error {
+	ext := opts.BackupExtension
+	if ext == "" {
+		return fmt.Errorf("restore requires --backup-extension")
+	}
+	if opts.BackupDir != "" {
+		if err := setAbsPath("Backup directory", &opts.BackupDir); err != nil {
+			return err
+		}
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	for i := range args {
+		if err := setAbsPath("Output directory", &args[i]); err != nil {
+			return err
+		}
+		if err := checkDirExist(args[i]); err != nil {
+			return fmt.Errorf("output directory no found: %w", err)
+		}
+	}
+	if !opts.DryRun {
+		unlock, err := acquireLocks(args)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	for _, dir := range args {
+		root := dir
+		if opts.BackupDir != "" {
+			root = mirrorPath(dir)
+		}
+		backups, err := findBackups(root, ext)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("find backups in %s: %w", root, err)
+		}
+		if len(backups) == 0 {
+			printProgress("no backup found in %s", dir)
+			continue
+		}
+		latest := latestBackups(backups, ext, root, dir)
+		paths := make([]string, 0, len(latest))
+		for path := range latest {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if err := restoreBackup(path, latest[path]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package pack
+
+import (
+	"time"
+)
+
+// maxRetryDelay caps the doubling delay between two attempts.
+const maxRetryDelay = 2 * time.Minute
+
+// retryDelay returns how long to wait before the given retry, starting from
+// --retry-delay and doubling for each further retry.
+func retryDelay(retry int) time.Duration {
+	d := opts.RetryDelay
+	for i := 1; i < retry && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// withRetries runs f and runs it again up to --retries times while it fails,
+// which gets over the transient failures of Maven repositories and the
+// network. A canceled run is never retried.
+func withRetries(what string, f func() error) error {
+	for retry := 1; ; retry++ {
+		err := f()
+		if err == nil || retry > opts.Retries {
+			return err
+		}
+		if cerr := checkCanceled(); cerr != nil {
+			return err
+		}
+		delay := retryDelay(retry)
+		logWarning("%v", err)
+		logWarning("%s again in %s, retry %d/%d", what, delay, retry, opts.Retries)
+		select {
+		case <-time.After(delay):
+		case <-runCtx.Done():
+			return checkCanceled()
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package pack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tempSaveExt ends the names of the outputs saved during a run.
+const tempSaveExt = ".upack-old"
+
+// outputChange is a path written by the current run, saved holds what the
+// path had before, "" if it didn't exist.
+type outputChange struct {
+	path  string
+	saved string
+	// temp tells that saved is only kept until the run succeeds, rather
+	// than being a backup asked for by --backup-extension.
+	temp bool
+}
+
+var (
+	changesLock sync.Mutex
+	changes     []outputChange
+	// changed holds the paths in changes, only the first change of a path
+	// saves what it had before the run.
+	changed = make(map[string]bool)
+)
+
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// tempSavePath returns where the previous content of path is kept during a
+// run, Unity skips hidden files so it doesn't import them.
+func tempSavePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+tempSaveExt)
+}
+
+// isSavedPath tells whether path holds a backup or a save of an output made
+// by upack, rather than a plugin of the Unity project.
+func isSavedPath(path string) bool {
+	return strings.HasSuffix(path, tempSaveExt) || (opts.BackupExtension != "" && strings.HasSuffix(path, opts.BackupExtension))
+}
+
+func recordChange(path, saved string) {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	addChange(outputChange{path: path, saved: saved})
+}
+
+func addChange(c outputChange) {
+	changes = append(changes, c)
+	changed[c.path] = true
+}
+
+// changedInRun tells whether the current run has written path.
+func changedInRun(path string) bool {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	return changed[path]
+}
+
+// saveOriginal moves path aside so a failed run can put it back, path is
+// free to be written afterwards. Nothing is saved if the run has changed
+// path already.
+func saveOriginal(path string) error {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	if changed[path] {
+		return os.RemoveAll(path)
+	}
+	if !pathExists(path) {
+		addChange(outputChange{path: path})
+		return nil
+	}
+	saved := tempSavePath(path)
+	if err := os.RemoveAll(saved); err != nil {
+		return err
+	}
+	if err := os.Rename(path, saved); err != nil {
+		return err
+	}
+	addChange(outputChange{path: path, saved: saved, temp: true})
+	return nil
+}
+
+// saveCopy keeps a copy of the directory dir so a failed run can put it
+// back, for directories updated in place.
+func saveCopy(dir string) error {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	if changed[dir] {
+		return nil
+	}
+	saved := tempSavePath(dir)
+	if err := os.RemoveAll(saved); err != nil {
+		return err
+	}
+	if err := copyDir(dir, saved); err != nil {
+		os.RemoveAll(saved)
+		return err
+	}
+	addChange(outputChange{path: dir, saved: saved, temp: true})
+	return nil
+}
+
+func resetChanges() {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	changes = nil
+	changed = make(map[string]bool)
+}
+
+// commitChanges drops what the succeeded run saved to roll back, the
+// backups asked for are kept.
+func commitChanges() {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	for _, c := range changes {
+		if !c.temp {
+			continue
+		}
+		if err := os.RemoveAll(c.saved); err != nil {
+			logWarning("remove %s: %v", c.saved, err)
+		}
+	}
+	changes = nil
+	changed = make(map[string]bool)
+}
+
+// rollbackChanges removes the outputs written by a failed run and puts back
+// what they had before, the latest change is undone first.
+func rollbackChanges() {
+	changesLock.Lock()
+	defer changesLock.Unlock()
+	if len(changes) > 0 {
+		logError("rolling back the outputs ...")
+	}
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		logDebug("rolling back %s", c.path)
+		if err := os.RemoveAll(c.path); err != nil {
+			logError("roll back %s: %v", c.path, err)
+			continue
+		}
+		if c.saved == "" {
+			continue
+		}
+		if err := movePath(c.saved, c.path); err != nil {
+			logError("restore %s from %s: %v", c.path, c.saved, err)
+		}
+	}
+	changes = nil
+	changed = make(map[string]bool)
+}
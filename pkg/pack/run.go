@@ -0,0 +1,123 @@
+package pack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// killGracePeriod is how long a canceled command may take to exit after
+// being asked to before it is killed.
+const killGracePeriod = 5 * time.Second
+
+var (
+	// runCtx is done when the current run has to stop, on --timeout or a
+	// termination signal.
+	runCtx = context.Background()
+	// stopSignal is the signal canceling the current run, nil if there is
+	// none.
+	stopSignal     os.Signal
+	stopSignalLock sync.Mutex
+)
+
+func setStopSignal(s os.Signal) {
+	stopSignalLock.Lock()
+	defer stopSignalLock.Unlock()
+	stopSignal = s
+}
+
+func getStopSignal() os.Signal {
+	stopSignalLock.Lock()
+	defer stopSignalLock.Unlock()
+	return stopSignal
+}
+
+// startRun starts the context of a run, which is canceled on SIGINT and
+// SIGTERM and when the timeout expires, the returned function releases it.
+func startRun() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	runCtx = ctx
+	setStopSignal(nil)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-sigs:
+			logError("%s received, stopping ...", s)
+			setStopSignal(s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// checkCanceled returns an error if the current run has to stop.
+func checkCanceled() error {
+	err := runCtx.Err()
+	switch {
+	case err == nil:
+		return nil
+	case getStopSignal() != nil:
+		return fmt.Errorf("canceled by %s", getStopSignal())
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("timed out after %s", opts.Timeout)
+	}
+	return err
+}
+
+// canceledExitCode returns the exit code of a process stopped by the signal
+// canceling the last run, false is returned if no signal was received.
+func canceledExitCode() (int, bool) {
+	s, ok := getStopSignal().(syscall.Signal)
+	if !ok {
+		return 0, false
+	}
+	return 128 + int(s), true
+}
+
+// runCmd runs cmd, the command and the processes it starts are stopped when
+// the current run has to stop.
+func runCmd(cmd *exec.Cmd) error {
+	done := runCtx.Done()
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+	select {
+	case err := <-waitErr:
+		return err
+	case <-done:
+	}
+
+	logDebug("stopping %s ...", cmd.Path)
+	if err := terminateProcessGroup(cmd); err != nil {
+		logDebug("terminate %s: %v", cmd.Path, err)
+	}
+	select {
+	case <-waitErr:
+	case <-time.After(killGracePeriod):
+		if err := killProcessGroup(cmd); err != nil {
+			logDebug("kill %s: %v", cmd.Path, err)
+		}
+		<-waitErr
+	}
+	return checkCanceled()
+}
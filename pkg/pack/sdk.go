@@ -0,0 +1,35 @@
+package pack
+
+import (
+	"fmt"
+
+	"github.com/zhiruili/upack/pkg/aar"
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+func checkSdkOptions() error {
+	if opts.MinSdkVersion < 0 || opts.TargetSdkVersion < 0 {
+		return fmt.Errorf("SDK versions must not be negative")
+	}
+	if opts.MinSdkVersion > 0 && opts.TargetSdkVersion > 0 && opts.MinSdkVersion > opts.TargetSdkVersion {
+		return fmt.Errorf("minSdkVersion %d is higher than targetSdkVersion %d", opts.MinSdkVersion, opts.TargetSdkVersion)
+	}
+	return nil
+}
+
+// checkAarSdkVersions makes sure the SDK versions given for the Unity
+// manifest are compatible with the ones the AAR declares, otherwise the
+// manifest merger of the Unity build fails.
+func checkAarSdkVersions(aarFile string) error {
+	if opts.MinSdkVersion == 0 {
+		return nil
+	}
+	root, err := aar.Manifest(aarFile)
+	if err != nil {
+		return err
+	}
+	if aarMin := manifest.MinSdk(root); aarMin > opts.MinSdkVersion {
+		return fmt.Errorf("module %s requires minSdkVersion %d, higher than %d", opts.AndroidModuleName, aarMin, opts.MinSdkVersion)
+	}
+	return nil
+}
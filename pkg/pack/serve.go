@@ -0,0 +1,141 @@
+package pack
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const unixSocketPrefix = "unix:"
+
+// serveTokenHeader is the header a run request carries the token in, a
+// browser can't send it to another origin, so web pages can't trigger runs.
+const serveTokenHeader = "X-Upack-Token"
+
+type serveCommand struct {
+	Listen string `long:"listen" env:"UPACK_LISTEN" description:"Address to listen on, unix:<path> for a Unix domain socket" default:"127.0.0.1:7650"`
+	Token  string `long:"token" env:"UPACK_SERVE_TOKEN" description:"Token the X-Upack-Token header of requests must hold, any value is accepted if not given but the header is still required"`
+}
+
+func listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixSocketPrefix) {
+		path := strings.TrimPrefix(addr, unixSocketPrefix)
+		// a socket left by a previous daemon blocks listening
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// warmUpGradle starts the Gradle daemon so the first triggered run doesn't
+// pay for its cold start.
+func warmUpGradle() {
+	if gradleNoDaemon() {
+		return
+	}
+	logDebug("warming up the Gradle daemon of %s ...", opts.AndroidProjectPath)
+	if err := runGradleAt(opts.AndroidProjectPath, gradleCommand(opts.AndroidProjectPath), "--daemon", "help"); err != nil {
+		logWarning("warm up Gradle daemon fail: %v", err)
+	}
+}
+
+// localHost tells whether the host of a Host or Origin header names this
+// machine without going through DNS, a name resolved by an attacker could
+// point to the daemon while the browser takes it for their site.
+func localHost(host, listenHost string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return host == "localhost" || host == listenHost || net.ParseIP(host) != nil
+}
+
+// checkRequest refuses requests web pages could have sent, those without the
+// token header, from another origin or through a rebound DNS name.
+func (c *serveCommand) checkRequest(r *http.Request) (int, error) {
+	token := r.Header.Get(serveTokenHeader)
+	if token == "" || c.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) != 1 {
+		return http.StatusUnauthorized, fmt.Errorf("missing or wrong %s header", serveTokenHeader)
+	}
+	if strings.HasPrefix(c.Listen, unixSocketPrefix) {
+		return 0, nil
+	}
+	listenHost, _, _ := net.SplitHostPort(c.Listen)
+	if !localHost(r.Host, listenHost) {
+		return http.StatusForbidden, fmt.Errorf("host %s not allowed", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !localHost(u.Host, listenHost) {
+			return http.StatusForbidden, fmt.Errorf("origin %s not allowed", origin)
+		}
+	}
+	return 0, nil
+}
+
+// packHandler packs the plugin into args on every POST request, runs are
+// serialized as they share the Android project and the output directories.
+func (c *serveCommand) packHandler(args []string) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST to trigger a run", http.StatusMethodNotAllowed)
+			return
+		}
+		if code, err := c.checkRequest(r); err != nil {
+			logWarning("run request from %s refused: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), code)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		logDebug("run triggered by %s", r.RemoteAddr)
+		if err := main1(args); err != nil {
+			logError("%v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			// the daemon itself is asked to stop
+			if code, ok := canceledExitCode(); ok {
+				os.Exit(code)
+			}
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// Execute serves a local endpoint, POST /pack packs the plugin into the
+// output directories given by args.
+func (c *serveCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	if err := setAbsPath("Android project", &opts.AndroidProjectPath); err != nil {
+		return err
+	}
+	if err := checkDirExist(opts.AndroidProjectPath); err != nil {
+		return fmt.Errorf("Android project no found: %w", err)
+	}
+
+	l, err := listen(c.Listen)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", c.Listen, err)
+	}
+	defer l.Close()
+	warmUpGradle()
+
+	mux := http.NewServeMux()
+	mux.Handle("/pack", c.packHandler(args))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	printProgress("serving on %s, POST /pack with the %s header to pack %s", l.Addr(), serveTokenHeader, strings.Join(args, ", "))
+	return http.Serve(l, mux)
+}
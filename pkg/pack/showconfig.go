@@ -0,0 +1,114 @@
+package pack
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+// configOptions are the options the config file gives a value to when they
+// aren't set otherwise.
+var configOptions = map[string]func() string{
+	"java-home":  func() string { return conf.JavaHome },
+	"notify-url": func() string { return redactURL(conf.Notify.URL) },
+}
+
+func optionValue(o *flags.Option) string {
+	switch v := o.Value().(type) {
+	case []bool:
+		// repeated switches like -v count
+		return strconv.Itoa(len(v))
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case string:
+		if o.LongName == "notify-url" {
+			v = redactURL(v)
+		}
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(o.Value())
+}
+
+// optionSource tells where the value of o comes from: the command line, an
+// environment variable or the default.
+func optionSource(o *flags.Option) string {
+	if o.IsSet() && !o.IsSetDefault() {
+		return "flag"
+	}
+	if key := o.EnvKeyWithNamespace(); key != "" {
+		if _, ok := os.LookupEnv(key); ok {
+			return "env " + key
+		}
+	}
+	return "default"
+}
+
+// redactURL keeps the scheme and host of u only, webhook URLs hold secrets.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" || parsed.Path == "" && parsed.RawQuery == "" {
+		return u
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/..."
+}
+
+func allOptions(groups []*flags.Group) []*flags.Option {
+	var options []*flags.Option
+	for _, g := range groups {
+		options = append(options, g.Options()...)
+		options = append(options, allOptions(g.Groups())...)
+	}
+	return options
+}
+
+// showConfig prints the value of every option with where it comes from, and
+// the config file as it is resolved.
+func showConfig(parser *flags.Parser) error {
+	c, err := loadConfig(opts.ConfigFile)
+	if err != nil {
+		return err
+	}
+	conf = *c
+
+	options := allOptions(parser.Groups())
+	if parser.Active != nil {
+		options = append(options, parser.Active.Options()...)
+		options = append(options, allOptions(parser.Active.Groups())...)
+	}
+	printHeader("options:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, o := range options {
+		if o.LongName == "help" {
+			continue
+		}
+		value, source := optionValue(o), optionSource(o)
+		if f, ok := configOptions[o.LongName]; ok && source == "default" && f() != "" {
+			value, source = strconv.Quote(f()), "config file"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", o, value, source)
+	}
+	w.Flush()
+
+	if opts.ConfigFile == "" {
+		printHeader("no config file")
+		return nil
+	}
+	c.Notify.URL = redactURL(c.Notify.URL)
+	var sb strings.Builder
+	enc := yaml.NewEncoder(&sb)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	printHeader("config file %s:", opts.ConfigFile)
+	for _, line := range strings.Split(strings.TrimRight(sb.String(), "\n"), "\n") {
+		fmt.Println("  " + line)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package pack
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sizeReportTop is how many of the biggest entries the size report lists.
+const sizeReportTop = 10
+
+type sizedEntry struct {
+	path string
+	size uint64
+}
+
+// zipEntrySizes lists the uncompressed size of every file in the archive at
+// path, prefix is put before the entry names.
+func zipEntrySizes(path, prefix string) ([]sizedEntry, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var entries []sizedEntry
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() {
+			entries = append(entries, sizedEntry{prefix + f.Name, f.UncompressedSize64})
+		}
+	}
+	return entries, nil
+}
+
+// dirEntrySizes lists the size of every file under dir, the .meta files of
+// Unity aren't part of the plugin.
+func dirEntrySizes(dir, prefix string) ([]sizedEntry, error) {
+	var entries []sizedEntry
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(p, ".meta") || isSavedPath(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, sizedEntry{prefix + filepath.ToSlash(rel), uint64(info.Size())})
+		return nil
+	})
+	return entries, err
+}
+
+// pluginEntrySizes lists the files of the plugin packed into baseDir with
+// the layout of the given format.
+func pluginEntrySizes(format, baseDir string, result *buildResult) ([]sizedEntry, error) {
+	var entries []sizedEntry
+	var err error
+	switch format {
+	case formatAar:
+		entries, err = zipEntrySizes(opts.outputAarFile(baseDir), "")
+	case formatSrcAar:
+		entries, err = zipEntrySizes(filepath.Join(opts.m2ArtifactDir(baseDir), opts.MavenVersion,
+			fmt.Sprintf("%s-%s.srcaar", opts.AndroidModuleName, opts.MavenVersion)), "")
+	case formatAndroidLib:
+		entries, err = dirEntrySizes(opts.androidLibPluginDir(baseDir), "")
+	case formatUpm:
+		entries, err = dirEntrySizes(opts.libraryPluginDir(upmPluginDir(upmPackageDir(baseDir))), "")
+	default:
+		entries, err = dirEntrySizes(opts.libraryPluginDir(baseDir), "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, aar := range result.AbiAars {
+		name := filepath.Base(aar)
+		more, err := zipEntrySizes(filepath.Join(pluginFilesDir(format, baseDir), name), name+"!/")
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, more...)
+	}
+	return entries, nil
+}
+
+// sizeCategory tells what an entry of the plugin contributes, native
+// libraries are told apart by ABI.
+func sizeCategory(p string) string {
+	if i := strings.LastIndex(p, "!/"); i >= 0 {
+		p = p[i+2:]
+	}
+	switch ext := path.Ext(p); {
+	case ext == ".jar" || ext == ".class" || ext == ".dex":
+		return "classes"
+	case ext == ".so":
+		return "native " + path.Base(path.Dir(p))
+	case strings.HasPrefix(p, "res/") || strings.HasPrefix(p, "assets/"):
+		return "resources"
+	}
+	return "other"
+}
+
+func sizePercent(size, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(size) * 100 / float64(total)
+}
+
+// printSizeReport prints the size of the plugin packed into baseDir by
+// category, and its biggest entries.
+func printSizeReport(baseDir string, result *buildResult) error {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return err
+	}
+	entries, err := pluginEntrySizes(format, baseDir, result)
+	if err != nil {
+		return fmt.Errorf("size report of %s: %w", baseDir, err)
+	}
+
+	var total uint64
+	categories := make(map[string]uint64)
+	for _, e := range entries {
+		total += e.size
+		categories[sizeCategory(e.path)] += e.size
+	}
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if categories[names[i]] != categories[names[j]] {
+			return categories[names[i]] > categories[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].size > entries[j].size
+	})
+
+	printHeader("size of %s in %s: %s in %d files", opts.AndroidModuleName, baseDir, formatSize(total), len(entries))
+	for _, name := range names {
+		fmt.Printf("  %-20s %10s %5.1f%%\n", name, formatSize(categories[name]), sizePercent(categories[name], total))
+	}
+	if len(entries) > sizeReportTop {
+		entries = entries[:sizeReportTop]
+	}
+	fmt.Println("  biggest entries:")
+	for _, e := range entries {
+		fmt.Printf("    %10s %5.1f%%  %s\n", formatSize(e.size), sizePercent(e.size, total), e.path)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package pack
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhiruili/upack/pkg/aar"
+)
+
+const splitAbiManifestTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="%s" />
+`
+
+// splitAbiAarName returns the file name of the AAR holding the native
+// libraries of abi.
+func (o *Options) splitAbiAarName(abi string) string {
+	return fmt.Sprintf("%s-%s.aar", o.AndroidModuleName, abi)
+}
+
+// splitAbiPackage returns the package name declared by the AAR of abi, which
+// must differ from the one of the plugin itself.
+func (o *Options) splitAbiPackage(abi string) string {
+	return o.mavenGroup() + ".abi." + strings.NewReplacer("-", "_").Replace(abi)
+}
+
+// splitAbiOf returns the ABI of a per-ABI AAR split from the plugin, an empty
+// string is returned for other files.
+func splitAbiOf(path string) string {
+	for abi := range abiCPUs {
+		if filepath.Base(path) == opts.splitAbiAarName(abi) {
+			return abi
+		}
+	}
+	return ""
+}
+
+// keepSplitEntry tells whether an entry of the built AAR goes to the per-ABI
+// AARs.
+func keepSplitEntry(path string, isDir bool) bool {
+	path = filepath.ToSlash(path)
+	if path != "jni" && !strings.HasPrefix(path, "jni/") {
+		return false
+	}
+	return keepAbi(path) && !ignores.match(path, isDir)
+}
+
+func writeSplitAbiAar(srcDir, abi, dstFile string) error {
+	out, err := os.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	defer w.Close()
+	f, err := w.Create("AndroidManifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, splitAbiManifestTemplate, opts.splitAbiPackage(abi)); err != nil {
+		return err
+	}
+	// an empty classes.jar keeps the AAR well formed
+	f, err = w.Create("classes.jar")
+	if err != nil {
+		return err
+	}
+	if err := zip.NewWriter(f).Close(); err != nil {
+		return err
+	}
+	return aar.AddDir(w, srcDir, "jni/"+abi, aar.KeepAll, nil)
+}
+
+// splitAbis writes the native libraries of the built AAR into one AAR per
+// ABI in dir, the paths of the AARs are returned.
+func splitAbis(dir string) ([]string, error) {
+	extractDir := filepath.Join(dir, "aar")
+	if err := unzipFile(opts.moduleAarFile(), extractDir, keepSplitEntry); err != nil {
+		return nil, err
+	}
+	if err := stripNativeLibs(extractDir); err != nil {
+		return nil, err
+	}
+	abiDirs, err := ioutil.ReadDir(filepath.Join(extractDir, "jni"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			logWarning("no native libraries to split by ABI in %s", opts.moduleAarFile())
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var aars []string
+	for _, d := range abiDirs {
+		if !d.IsDir() {
+			continue
+		}
+		abi := d.Name()
+		if _, ok := abiCPUs[abi]; !ok {
+			logWarning("unknown ABI %s is not split", abi)
+			continue
+		}
+		aarFile := filepath.Join(dir, opts.splitAbiAarName(abi))
+		logTrace("start packing native libraries of %s to %s ...", abi, aarFile)
+		if err := writeSplitAbiAar(filepath.Join(extractDir, "jni", abi), abi, aarFile); err != nil {
+			return nil, fmt.Errorf("pack %s: %w", aarFile, err)
+		}
+		aars = append(aars, aarFile)
+	}
+	return aars, nil
+}
+
+// copySplitAbiAars copies the per-ABI AARs into dir.
+func copySplitAbiAars(dir string, aars []string) error {
+	defer timePhase("copies")()
+	if err := makeDir(dir, false); err != nil {
+		return err
+	}
+	for _, aar := range aars {
+		path := filepath.Join(dir, filepath.Base(aar))
+		logTrace("copying %s to %s ...", filepath.Base(aar), dir)
+		if err := removeOrBackup(path, opts.BackupExtension); err != nil {
+			return err
+		}
+		if err := copyFile(aar, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
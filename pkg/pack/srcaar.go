@@ -0,0 +1,177 @@
+package pack
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (o *Options) mavenGroup() string {
+	if o.MavenGroup != "" {
+		return o.MavenGroup
+	}
+	name := o.AndroidEntryActivity
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (o *Options) mavenSpec() string {
+	return fmt.Sprintf("%s:%s:%s", o.mavenGroup(), o.AndroidModuleName, o.MavenVersion)
+}
+
+func m2RepositoryDir(baseDir string) string {
+	return filepath.Join(baseDir, "m2repository")
+}
+
+func (o *Options) m2ArtifactDir(baseDir string) string {
+	groupPath := strings.Replace(o.mavenGroup(), ".", string(filepath.Separator), -1)
+	return filepath.Join(m2RepositoryDir(baseDir), groupPath, o.AndroidModuleName)
+}
+
+type pomDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Scope      string `xml:"scope"`
+}
+
+type pomProject struct {
+	XMLName      xml.Name        `xml:"project"`
+	XMLNS        string          `xml:"xmlns,attr"`
+	ModelVersion string          `xml:"modelVersion"`
+	GroupID      string          `xml:"groupId"`
+	ArtifactID   string          `xml:"artifactId"`
+	Version      string          `xml:"version"`
+	Packaging    string          `xml:"packaging"`
+	Dependencies []pomDependency `xml:"dependencies>dependency,omitempty"`
+}
+
+type mavenMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupID    string   `xml:"groupId"`
+	ArtifactID string   `xml:"artifactId"`
+	Release    string   `xml:"versioning>release"`
+	Versions   []string `xml:"versioning>versions>version"`
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+func renderPom(deps []string) ([]byte, error) {
+	pom := pomProject{
+		XMLNS:        "http://maven.apache.org/POM/4.0.0",
+		ModelVersion: "4.0.0",
+		GroupID:      opts.mavenGroup(),
+		ArtifactID:   opts.AndroidModuleName,
+		Version:      opts.MavenVersion,
+		Packaging:    "srcaar",
+	}
+	for _, d := range deps {
+		parts := strings.SplitN(d, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		pom.Dependencies = append(pom.Dependencies, pomDependency{
+			GroupID:    parts[0],
+			ArtifactID: parts[1],
+			Version:    parts[2],
+			Scope:      "runtime",
+		})
+	}
+	return marshalXML(&pom)
+}
+
+func renderMavenMetadata() ([]byte, error) {
+	return marshalXML(&mavenMetadata{
+		GroupID:    opts.mavenGroup(),
+		ArtifactID: opts.AndroidModuleName,
+		Release:    opts.MavenVersion,
+		Versions:   []string{opts.MavenVersion},
+	})
+}
+
+// moduleDependenciesIfAny returns the dependencies declared in the module
+// build script, or nothing if the module has none.
+func moduleDependenciesIfAny() ([]string, error) {
+	if _, err := opts.moduleBuildFile(); err != nil {
+		return nil, nil
+	}
+	return loadModuleDependencies()
+}
+
+// packSrcAar writes the AAR renamed to .srcaar together with a POM into a
+// local Maven repository under baseDir, the layout used by External
+// Dependency Manager for Unity.
+func packSrcAar(baseDir string, manifest []byte, extras map[string]string) error {
+	tmpDir, err := os.MkdirTemp("", "upack-srcaar")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	artifactDir := opts.m2ArtifactDir(baseDir)
+	versionDir := filepath.Join(artifactDir, opts.MavenVersion)
+	fileBase := filepath.Join(versionDir, fmt.Sprintf("%s-%s", opts.AndroidModuleName, opts.MavenVersion))
+	staged, err := stageAar(tmpDir, formatSrcAar, baseDir, fileBase+".srcaar", extras)
+	if err != nil {
+		return err
+	}
+
+	if err := saveOriginal(versionDir); err != nil {
+		return err
+	}
+	if err := makeDir(versionDir, false); err != nil {
+		return err
+	}
+	logDebug("Maven artifact output directory at: %s", versionDir)
+
+	logTrace("start copying aar to %s.srcaar ...", fileBase)
+	if err := moveFile(staged, fileBase+".srcaar"); err != nil {
+		return err
+	}
+
+	deps, err := moduleDependenciesIfAny()
+	if err != nil {
+		return err
+	}
+	pom, err := renderPom(deps)
+	if err != nil {
+		return err
+	}
+	logTrace("start generating POM file %s.pom ...", fileBase)
+	if err := backupAndWriteFile(fileBase+".pom", pom, opts.BackupExtension); err != nil {
+		return err
+	}
+
+	metadata, err := renderMavenMetadata()
+	if err != nil {
+		return err
+	}
+	if err := backupAndWriteFile(filepath.Join(artifactDir, "maven-metadata.xml"), metadata, opts.BackupExtension); err != nil {
+		return err
+	}
+
+	logTrace("start generating Android manifest file to %s ...", baseDir)
+	return addAndroidManifestFile(baseDir, manifest, opts.BackupExtension)
+}
+
+// edmRepositoryPath returns the path of the local Maven repository under
+// baseDir the way EDM expects it, relative to the Unity project root.
+func edmRepositoryPath(baseDir string) string {
+	repo := m2RepositoryDir(baseDir)
+	if projectDir := findUnityProject(baseDir); projectDir != "" {
+		if rel, err := filepath.Rel(projectDir, repo); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(repo)
+}
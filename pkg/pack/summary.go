@@ -0,0 +1,191 @@
+package pack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+type artifactSummary struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+type outputSummary struct {
+	Dir       string            `json:"dir"`
+	Format    string            `json:"format"`
+	Artifacts []artifactSummary `json:"artifacts"`
+}
+
+type timingSummary struct {
+	Phase   string  `json:"phase"`
+	Seconds float64 `json:"seconds"`
+	Steps   int     `json:"steps"`
+	Notes   string  `json:"notes,omitempty"`
+}
+
+// runSummary is written to --summary-file at the end of a run for CI
+// pipelines.
+type runSummary struct {
+	Success           bool            `json:"success"`
+	Error             string          `json:"error,omitempty"`
+	ExitCode          int             `json:"exitCode"`
+	ToolVersion       string          `json:"toolVersion"`
+	ToolCommit        string          `json:"toolCommit,omitempty"`
+	ToolBuildDate     string          `json:"toolBuildDate,omitempty"`
+	Module            string          `json:"module"`
+	Time              string          `json:"time"`
+	Seconds           float64         `json:"seconds"`
+	Outputs           []outputSummary `json:"outputs"`
+	RemovedJarEntries []string        `json:"removedJarEntries"`
+	Warnings          []string        `json:"warnings"`
+	Timings           []timingSummary `json:"timings"`
+}
+
+var (
+	// warnings are the warnings logged by the current run.
+	warnings []string
+	// removedJarEntries are the entries filtered out of the jars by the
+	// current run, as jar!/entry.
+	removedJarEntries map[string]bool
+	summaryLock       sync.Mutex
+)
+
+func resetSummary() {
+	summaryLock.Lock()
+	defer summaryLock.Unlock()
+	warnings = nil
+	removedJarEntries = make(map[string]bool)
+}
+
+func recordWarning(warning string) {
+	summaryLock.Lock()
+	defer summaryLock.Unlock()
+	warnings = append(warnings, warning)
+}
+
+// checkWarnings fails the run with --fail-on-warning if anything was warned
+// about, the warnings are repeated since --quiet hides them.
+func checkWarnings() error {
+	if !opts.FailOnWarning {
+		return nil
+	}
+	summaryLock.Lock()
+	defer summaryLock.Unlock()
+	if len(warnings) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d warnings with --fail-on-warning", len(warnings))
+	for _, w := range warnings {
+		sb.WriteString("\n    " + w)
+	}
+	return withExitCode(exitValidation, errors.New(sb.String()))
+}
+
+func recordRemovedJarEntry(jarFile, name string) {
+	summaryLock.Lock()
+	defer summaryLock.Unlock()
+	if removedJarEntries != nil {
+		removedJarEntries[filepath.Base(jarFile)+"!/"+name] = true
+	}
+}
+
+// outputArtifacts lists the files packed into baseDir with their hashes,
+// the .meta files of Unity are left out.
+func outputArtifacts(format, baseDir string, result *buildResult) ([]artifactSummary, error) {
+	root := outputRootDir(format, baseDir)
+	var artifacts []artifactSummary
+	for _, rel := range ownedOutputs(format, baseDir, result) {
+		err := filepath.Walk(filepath.Join(root, filepath.FromSlash(rel)), func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || strings.HasSuffix(path, ".meta") || isSavedPath(path) {
+				return nil
+			}
+			hash, err := dirsync.FileHash(path)
+			if err != nil {
+				return err
+			}
+			artifacts = append(artifacts, artifactSummary{Path: path, Size: info.Size(), Sha256: hex.EncodeToString(hash)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// writeSummary writes the summary of the run packing into the output
+// directories args to path, result is nil if the run failed before packing.
+func writeSummary(path string, args []string, result *buildResult, runErr error) error {
+	s := runSummary{
+		Success:           runErr == nil,
+		Module:            opts.AndroidModuleName,
+		ToolVersion:       toolVersion(),
+		ToolCommit:        buildCommit,
+		ToolBuildDate:     buildDate,
+		Time:              runStart.Format(time.RFC3339),
+		Seconds:           time.Since(runStart).Seconds(),
+		Outputs:           []outputSummary{},
+		RemovedJarEntries: []string{},
+		Warnings:          []string{},
+		Timings:           []timingSummary{},
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+		s.ExitCode = exitCode(runErr)
+	}
+	if result != nil && runErr == nil {
+		for _, baseDir := range args {
+			format, err := resolveOutputFormat(baseDir)
+			if err != nil {
+				return err
+			}
+			artifacts, err := outputArtifacts(format, baseDir, result)
+			if err != nil {
+				return fmt.Errorf("list artifacts of %s: %w", baseDir, err)
+			}
+			s.Outputs = append(s.Outputs, outputSummary{Dir: baseDir, Format: format, Artifacts: artifacts})
+		}
+	}
+
+	summaryLock.Lock()
+	s.Warnings = append(s.Warnings, warnings...)
+	for entry := range removedJarEntries {
+		s.RemovedJarEntries = append(s.RemovedJarEntries, entry)
+	}
+	summaryLock.Unlock()
+	sort.Strings(s.RemovedJarEntries)
+
+	timingsLock.Lock()
+	for _, t := range timings {
+		s.Timings = append(s.Timings, timingSummary{
+			Phase:   t.name,
+			Seconds: t.elapsed.Seconds(),
+			Steps:   t.count,
+			Notes:   strings.Join(t.notes, ", "),
+		})
+	}
+	timingsLock.Unlock()
+
+	content, err := json.MarshalIndent(&s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return dirsync.WriteFileAtomic(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,66 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	dirsync "github.com/zhiruili/upack/pkg/sync"
+)
+
+// syncDir makes dstDir the same as srcDir while only touching the files that
+// differ, so Unity doesn't reimport the whole plugin on every run. When
+// backupExt is given and anything changes, the previous dstDir is kept with
+// that extension.
+func syncDir(srcDir, dstDir string, backupExt string) error {
+	defer timePhase("copies")()
+	if _, err := os.Lstat(dstDir); os.IsNotExist(err) {
+		if err := saveOriginal(dstDir); err != nil {
+			return err
+		}
+		return moveDir(srcDir, dstDir)
+	} else if err != nil {
+		return err
+	}
+
+	updates, removals, err := dirsync.Changes(srcDir, dstDir)
+	if err != nil {
+		return fmt.Errorf("compare %s: %w", dstDir, err)
+	}
+	if len(updates) == 0 && len(removals) == 0 {
+		logTrace("%s is up to date", dstDir)
+		return nil
+	}
+	if len(backupExt) > 0 && !changedInRun(dstDir) {
+		bpath := backupPath(dstDir, backupExt)
+		if err := saveOriginal(bpath); err != nil {
+			return fmt.Errorf("backup %s: %w", dstDir, err)
+		}
+		if err := copyDir(dstDir, bpath); err != nil {
+			return fmt.Errorf("backup %s: %w", dstDir, err)
+		}
+		recordChange(dstDir, bpath)
+		if err := pruneBackups(dstDir, backupExt); err != nil {
+			return fmt.Errorf("prune backups of %s: %w", dstDir, err)
+		}
+	} else if err := saveCopy(dstDir); err != nil {
+		return fmt.Errorf("save %s: %w", dstDir, err)
+	}
+
+	logDebug("syncing %s, %d changed, %d removed", dstDir, len(updates), len(removals))
+	for _, relPath := range removals {
+		path := filepath.Join(dstDir, relPath)
+		logTrace("removing %s", path)
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("delete %s: %w", path, err)
+		}
+	}
+	for _, relPath := range updates {
+		path := filepath.Join(dstDir, relPath)
+		logTrace("updating %s", path)
+		if err := dirsync.Entry(filepath.Join(srcDir, relPath), path, copyFile); err != nil {
+			return fmt.Errorf("update %s: %w", path, err)
+		}
+	}
+	return nil
+}
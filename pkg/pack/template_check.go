@@ -0,0 +1,131 @@
+package pack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateFieldChecker walks a parsed template and reports references to
+// fields unknown to the template data.
+type templateFieldChecker struct {
+	tree     *parse.Tree
+	dataType reflect.Type
+	vars     map[string]string
+	source   string
+	problems []string
+}
+
+func (c *templateFieldChecker) known(name string) bool {
+	t := c.dataType
+	if _, ok := t.MethodByName(name); ok {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	_, ok := t.FieldByName(name)
+	return ok
+}
+
+func (c *templateFieldChecker) checkIdents(n parse.Node, idents []string) {
+	if len(idents) == 0 {
+		return
+	}
+	if !c.known(idents[0]) {
+		c.report(n, "unknown field %s", idents[0])
+		return
+	}
+	if idents[0] == "Vars" && len(idents) > 1 {
+		if _, ok := c.vars[idents[1]]; !ok {
+			c.report(n, "undefined variable %s", idents[1])
+		}
+	}
+}
+
+func (c *templateFieldChecker) report(n parse.Node, f string, a ...interface{}) {
+	loc, msg := c.location(n), fmt.Sprintf(f, a...)
+	c.problems = append(c.problems, loc+": "+msg)
+	line, col := templateLocation(loc)
+	annotate(annotationError, annotationFile(c.source), line, col, "template %s", msg)
+}
+
+func (c *templateFieldChecker) location(n parse.Node) string {
+	loc, _ := c.tree.ErrorContext(n)
+	return loc
+}
+
+// walk checks the node, root tells whether dot is still the template data.
+func (c *templateFieldChecker) walk(n parse.Node, root bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, root)
+		}
+	case *parse.ActionNode:
+		c.walk(n.Pipe, root)
+	case *parse.IfNode:
+		c.walk(n.Pipe, root)
+		c.walk(n.List, root)
+		c.walk(n.ElseList, root)
+	case *parse.RangeNode:
+		c.walk(n.Pipe, root)
+		c.walk(n.List, false)
+		c.walk(n.ElseList, root)
+	case *parse.WithNode:
+		c.walk(n.Pipe, root)
+		c.walk(n.List, false)
+		c.walk(n.ElseList, root)
+	case *parse.TemplateNode:
+		c.walk(n.Pipe, root)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				c.walk(arg, root)
+			}
+		}
+	case *parse.FieldNode:
+		if root {
+			c.checkIdents(n, n.Ident)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			c.checkIdents(n, n.Ident[1:])
+		}
+	case *parse.ChainNode:
+		c.walk(n.Node, root)
+	}
+}
+
+// checkTemplateFields validates the references to the template data in the
+// main template of tmpl against the fields and methods of data, so typos fail
+// fast instead of rendering nothing. source is where tmpl is loaded from.
+func checkTemplateFields(tmpl *template.Template, data interface{}, vars map[string]string, source string) error {
+	if tmpl.Tree == nil {
+		return nil
+	}
+	c := &templateFieldChecker{tree: tmpl.Tree, dataType: reflect.TypeOf(data), vars: vars, source: source}
+	c.walk(tmpl.Tree.Root, true)
+	if len(c.problems) > 0 {
+		return fmt.Errorf("template %s references unknown fields:\n  %s", tmpl.Name(), strings.Join(c.problems, "\n  "))
+	}
+	return nil
+}
+
+// strictTemplate configures tmpl to fail on missing map keys and validates
+// its field references when strict mode is on.
+func strictTemplate(tmpl *template.Template, data interface{}, vars map[string]string, source string) error {
+	if !opts.TemplateStrict {
+		return nil
+	}
+	tmpl.Option("missingkey=error")
+	return checkTemplateFields(tmpl, data, vars, source)
+}
@@ -0,0 +1,112 @@
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+func (o *Options) templateCacheDir() (string, error) {
+	if o.TemplateCacheDir != "" {
+		return o.TemplateCacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "upack", "templates"), nil
+}
+
+type templateCache struct {
+	bodyFile string
+	etagFile string
+}
+
+func newTemplateCache(url string) (*templateCache, error) {
+	dir, err := opts.templateCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := makeDir(dir, false); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(url))
+	base := filepath.Join(dir, hex.EncodeToString(sum[:]))
+	return &templateCache{bodyFile: base + ".tmpl", etagFile: base + ".etag"}, nil
+}
+
+func (c *templateCache) load() (string, string, bool) {
+	body, err := ioutil.ReadFile(c.bodyFile)
+	if err != nil {
+		return "", "", false
+	}
+	etag, _ := ioutil.ReadFile(c.etagFile)
+	return string(body), string(etag), true
+}
+
+func (c *templateCache) save(body []byte, etag string) error {
+	if err := ioutil.WriteFile(c.bodyFile, body, 0644); err != nil {
+		return err
+	}
+	if etag == "" {
+		return os.RemoveAll(c.etagFile)
+	}
+	return ioutil.WriteFile(c.etagFile, []byte(etag), 0644)
+}
+
+// fetchTemplate downloads the template at url, the response is cached with
+// its ETag so unchanged templates are not downloaded again, and the cached
+// copy is used when the server can't be reached.
+func fetchTemplate(url string) (string, error) {
+	cache, err := newTemplateCache(url)
+	if err != nil {
+		return "", err
+	}
+	cached, etag, hasCache := cache.load()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCache && etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		if hasCache {
+			logWarning("fetch template %s: %s, cached copy is used", url, err)
+			return cached, nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCache:
+		logDebug("template %s not modified, cached copy is used", url)
+		return cached, nil
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("fetch template %s: %s", url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := cache.save(body, resp.Header.Get("ETag")); err != nil {
+		logWarning("cache template %s: %s", url, err)
+	}
+	logDebug("template %s downloaded", url)
+	return string(body), nil
+}
@@ -0,0 +1,86 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// isEmptyValue tells whether v is the zero value of its type, or an empty
+// collection.
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// defaultValue returns value, or def if value is empty, so it reads like
+// {{.Vars.label | default "App"}} in templates.
+func defaultValue(def, value interface{}) interface{} {
+	if isEmptyValue(value) {
+		return def
+	}
+	return value
+}
+
+// indentLines prefixes every non-empty line of s with n spaces.
+func indentLines(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinItems joins the items of a slice with sep, it reads like
+// {{.AndroidPermissions | join ","}} in templates.
+func joinItems(sep string, items interface{}) (string, error) {
+	rv := reflect.ValueOf(items)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join expects a list, got %T", items)
+	}
+	strs := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		strs = append(strs, fmt.Sprint(rv.Index(i).Interface()))
+	}
+	return strings.Join(strs, sep), nil
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFuncs returns the helper functions available to every template,
+// hasPermission checks against the given permissions.
+func templateFuncs(permissions []string) template.FuncMap {
+	hasPermission := func(name string) bool {
+		return containsString(permissions, name)
+	}
+	return template.FuncMap{
+		"env":           os.Getenv,
+		"default":       defaultValue,
+		"upper":         strings.ToUpper,
+		"lower":         strings.ToLower,
+		"indent":        indentLines,
+		"join":          joinItems,
+		"hasPermission": hasPermission,
+	}
+}
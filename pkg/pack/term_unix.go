@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package pack
+
+import "os"
+
+// enableVirtualTerminal tells whether the terminal f handles escape
+// sequences, which terminals other than the Windows console always do.
+func enableVirtualTerminal(f *os.File) bool {
+	return true
+}
@@ -0,0 +1,42 @@
+//go:build windows
+// +build windows
+
+package pack
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+var (
+	procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+	virtualTerminalLock sync.Mutex
+	virtualTerminal     = make(map[uintptr]bool)
+)
+
+// enableVirtualTerminal turns on the processing of escape sequences by the
+// console f and tells whether it is on, consoles older than Windows 10 don't
+// support it.
+func enableVirtualTerminal(f *os.File) bool {
+	virtualTerminalLock.Lock()
+	defer virtualTerminalLock.Unlock()
+	fd := f.Fd()
+	if enabled, ok := virtualTerminal[fd]; ok {
+		return enabled
+	}
+	var mode uint32
+	enabled := false
+	if err := syscall.GetConsoleMode(syscall.Handle(fd), &mode); err == nil {
+		enabled = mode&enableVirtualTerminalProcessing != 0
+		if !enabled && procSetConsoleMode.Find() == nil {
+			r, _, _ := procSetConsoleMode.Call(fd, uintptr(mode|enableVirtualTerminalProcessing))
+			enabled = r != 0
+		}
+	}
+	virtualTerminal[fd] = enabled
+	return enabled
+}
@@ -0,0 +1,83 @@
+package pack
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type phaseTiming struct {
+	name    string
+	elapsed time.Duration
+	count   int
+	notes   []string
+}
+
+var (
+	// timings are the phases of the current run in the order they started,
+	// the phases of outputs packed in parallel add up.
+	timings     []*phaseTiming
+	timingsLock sync.Mutex
+	runStart    time.Time
+)
+
+func resetTimings() {
+	timingsLock.Lock()
+	defer timingsLock.Unlock()
+	timings = nil
+	runStart = time.Now()
+}
+
+func phase(name string) *phaseTiming {
+	for _, t := range timings {
+		if t.name == name {
+			return t
+		}
+	}
+	t := &phaseTiming{name: name}
+	timings = append(timings, t)
+	return t
+}
+
+// timePhase starts timing a step of the phase name, the returned function
+// ends it.
+func timePhase(name string) func() {
+	start := time.Now()
+	return func() {
+		timingsLock.Lock()
+		defer timingsLock.Unlock()
+		t := phase(name)
+		t.elapsed += time.Since(start)
+		t.count++
+	}
+}
+
+// notePhase attaches a note to the phase name, e.g. why it was skipped.
+func notePhase(name, note string) {
+	timingsLock.Lock()
+	defer timingsLock.Unlock()
+	t := phase(name)
+	t.notes = append(t.notes, note)
+}
+
+// printTimings logs the wall time of every phase of the run at the info
+// level, --quiet leaves it out.
+func printTimings() {
+	timingsLock.Lock()
+	defer timingsLock.Unlock()
+	if len(timings) == 0 {
+		return
+	}
+	logInfo("timings:")
+	for _, t := range timings {
+		line := fmt.Sprintf("  %-22s %9s", t.name, t.elapsed.Round(time.Millisecond))
+		if t.count > 1 {
+			line += fmt.Sprintf(" in %d steps", t.count)
+		}
+		for _, n := range t.notes {
+			line += ", " + n
+		}
+		logInfo("%s", line)
+	}
+	logInfo("  %-22s %9s", "total", time.Since(runStart).Round(time.Millisecond))
+}
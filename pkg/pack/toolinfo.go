@@ -0,0 +1,60 @@
+package pack
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// BuildInfo is the metadata of the upack binary, set by release builds.
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// The build metadata given to Main.
+var (
+	buildVersion string
+	buildCommit  string
+	buildDate    string
+)
+
+const modulePath = "github.com/zhiruili/upack"
+
+// toolVersion returns the version given at build time, or else the module
+// version of go install, or the one required by the program embedding the
+// package.
+func toolVersion() string {
+	if buildVersion != "" {
+		return buildVersion
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if bi.Main.Path == modulePath && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+	for _, m := range bi.Deps {
+		if m.Path == modulePath && m.Version != "" {
+			return m.Version
+		}
+	}
+	return "(devel)"
+}
+
+type versionCommand struct{}
+
+// Execute prints the version of upack and how it was built.
+func (c *versionCommand) Execute(args []string) error {
+	fmt.Printf("upack %s\n", toolVersion())
+	if buildCommit != "" {
+		fmt.Printf("commit: %s\n", buildCommit)
+	}
+	if buildDate != "" {
+		fmt.Printf("built: %s\n", buildDate)
+	}
+	fmt.Printf("go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
@@ -0,0 +1,135 @@
+package pack
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatAuto       = "auto"
+	formatLibrary    = "library"
+	formatUpm        = "upm"
+	formatAar        = "aar"
+	formatAndroidLib = "androidlib"
+	formatSrcAar     = "srcaar"
+)
+
+type unityVersion struct {
+	Major int
+	Minor int
+	Raw   string
+}
+
+func (v unityVersion) atLeast(major, minor int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+// parseUnityVersion parses versions like 2019.4.31f1.
+func parseUnityVersion(s string) (unityVersion, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) < 2 {
+		return unityVersion{}, fmt.Errorf("illegal Unity version %s", s)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return unityVersion{}, fmt.Errorf("illegal Unity version %s: %w", s, err)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return unityVersion{}, fmt.Errorf("illegal Unity version %s: %w", s, err)
+	}
+	return unityVersion{Major: major, Minor: minor, Raw: s}, nil
+}
+
+// findUnityProject walks up from path to find the root of the Unity project
+// containing it, an empty string is returned if there is none.
+func findUnityProject(path string) string {
+	for dir := path; ; {
+		if checkFileExist(unityProjectVersionFile(dir)) == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func unityProjectVersionFile(projectDir string) string {
+	return filepath.Join(projectDir, "ProjectSettings", "ProjectVersion.txt")
+}
+
+func readUnityProjectVersion(projectDir string) (unityVersion, error) {
+	f, err := os.Open(unityProjectVersionFile(projectDir))
+	if err != nil {
+		return unityVersion{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "m_EditorVersion:") {
+			return parseUnityVersion(strings.TrimPrefix(line, "m_EditorVersion:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return unityVersion{}, err
+	}
+	return unityVersion{}, fmt.Errorf("no editor version in %s", unityProjectVersionFile(projectDir))
+}
+
+// detectUnityVersion returns the Unity version used by the project baseDir
+// belongs to, the --unity-version option takes precedence.
+func detectUnityVersion(baseDir string) (unityVersion, bool, error) {
+	if opts.UnityVersion != "" {
+		v, err := parseUnityVersion(opts.UnityVersion)
+		return v, err == nil, err
+	}
+	projectDir := findUnityProject(baseDir)
+	if projectDir == "" {
+		return unityVersion{}, false, nil
+	}
+	v, err := readUnityProjectVersion(projectDir)
+	if err != nil {
+		return unityVersion{}, false, err
+	}
+	logTrace("Unity project at %s with version %s", projectDir, v.Raw)
+	return v, true, nil
+}
+
+func outputFormatOf(v unityVersion) string {
+	if v.atLeast(2020, 1) {
+		return formatAndroidLib
+	}
+	if v.atLeast(2019, 3) {
+		return formatAar
+	}
+	return formatLibrary
+}
+
+// resolveOutputFormat decides the output layout for baseDir, in auto mode the
+// layout is picked by the Unity version and falls back to an exploded library
+// project when the version is unknown.
+func resolveOutputFormat(baseDir string) (string, error) {
+	if opts.OutputFormat != formatAuto {
+		return opts.OutputFormat, nil
+	}
+	v, ok, err := detectUnityVersion(baseDir)
+	if err != nil {
+		return "", fmt.Errorf("detect Unity version of %s: %w", baseDir, err)
+	}
+	if !ok {
+		return formatLibrary, nil
+	}
+	return outputFormatOf(v), nil
+}
@@ -0,0 +1,77 @@
+package pack
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type upmPackage struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+}
+
+// upmPackageName returns the configured UPM package name, or one derived from
+// the package of the entry activity, e.g. com.example.mymodule.MainActivity
+// results in com.example.mymodule.
+func (o *Options) upmPackageName() string {
+	if o.UpmPackageName != "" {
+		return o.UpmPackageName
+	}
+	name := o.AndroidEntryActivity
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+func (o *Options) upmDisplayName() string {
+	if o.UpmDisplayName != "" {
+		return o.UpmDisplayName
+	}
+	return o.AndroidModuleName
+}
+
+func upmPackageDir(baseDir string) string {
+	return filepath.Join(baseDir, opts.upmPackageName())
+}
+
+func upmPluginDir(pkgDir string) string {
+	return filepath.Join(pkgDir, "Runtime", "Plugins", "Android")
+}
+
+func addUpmPackageFile(pkgDir string, backupExt string) error {
+	pkg := upmPackage{
+		Name:        opts.upmPackageName(),
+		Version:     opts.UpmPackageVersion,
+		DisplayName: opts.upmDisplayName(),
+		Description: fmt.Sprintf("Android plugin %s packed by upack", opts.AndroidModuleName),
+	}
+	content, err := json.MarshalIndent(&pkg, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(pkgDir, "package.json")
+	return backupAndWriteFile(path, append(content, '\n'), backupExt)
+}
+
+// packUpm writes the plugin as a Unity Package Manager package under baseDir,
+// which is usually the Packages folder of a Unity project.
+func packUpm(baseDir string, manifest []byte, extras map[string]string) error {
+	pkgDir := upmPackageDir(baseDir)
+	pluginDir := upmPluginDir(pkgDir)
+	if err := makeDir(pluginDir, false); err != nil {
+		return err
+	}
+	logDebug("UPM package output directory at: %s", pkgDir)
+
+	logTrace("start generating package.json at %s ...", pkgDir)
+	if err := addUpmPackageFile(pkgDir, opts.BackupExtension); err != nil {
+		return err
+	}
+
+	return packLibrary(formatUpm, baseDir, pluginDir, manifest, extras)
+}
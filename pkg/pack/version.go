@@ -0,0 +1,57 @@
+package pack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/zhiruili/upack/pkg/manifest"
+)
+
+// previousVersionCode returns the versionCode of the manifest generated into
+// baseDir by a previous run, 0 is returned if there is none.
+func previousVersionCode(baseDir string) (int, error) {
+	format, err := resolveOutputFormat(baseDir)
+	if err != nil {
+		return 0, err
+	}
+	content, err := ioutil.ReadFile(filepath.Join(pluginFilesDir(format, baseDir), "AndroidManifest.xml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	root, err := manifest.Parse(content)
+	if err != nil || root == nil {
+		return 0, err
+	}
+	v, _ := root.AndroidAttr("versionCode")
+	n, _ := strconv.Atoi(v)
+	return n, nil
+}
+
+// bumpVersionCode sets the versionCode to the one after the highest
+// versionCode found in the previous outputs, starting from 1 as manifests
+// rendered from the release preset without a versionCode have none. An
+// explicitly given versionCode is kept.
+func bumpVersionCode(baseDirs []string) error {
+	if opts.VersionCode != 0 {
+		logDebug("versionCode %d given, skip bumping", opts.VersionCode)
+		return nil
+	}
+	highest := 0
+	for _, baseDir := range baseDirs {
+		code, err := previousVersionCode(baseDir)
+		if err != nil {
+			return err
+		}
+		if code > highest {
+			highest = code
+		}
+	}
+	opts.VersionCode = highest + 1
+	logDebug("versionCode bumped to %d", opts.VersionCode)
+	return nil
+}
@@ -0,0 +1,78 @@
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sourceStamp summarizes the paths, sizes and modification times of the
+// Android sources, which is cheap enough to be polled.
+func sourceStamp(projectDir string) (string, error) {
+	h := sha256.New()
+	err := walkSources(projectDir, func(path, relPath string, info os.FileInfo) error {
+		fmt.Fprintf(h, "%s\x00%o\x00%d\x00%d\n", filepath.ToSlash(relPath), info.Mode(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// waitForChange blocks until the sources of projectDir differ from stamp and
+// then settle for the debounce period, so a burst of saves triggers a single
+// rebuild.
+func waitForChange(projectDir, stamp string) error {
+	for {
+		time.Sleep(opts.WatchInterval)
+		current, err := sourceStamp(projectDir)
+		if err != nil {
+			return err
+		}
+		if current == stamp {
+			continue
+		}
+		logDebug("change detected in %s", projectDir)
+		for {
+			time.Sleep(opts.WatchDebounce)
+			next, err := sourceStamp(projectDir)
+			if err != nil {
+				return err
+			}
+			if next == current {
+				return nil
+			}
+			current = next
+		}
+	}
+}
+
+// watch packs the plugin into the output directories and packs it again
+// whenever the Android sources change, a failed run doesn't stop watching.
+func watch(args []string) error {
+	if err := setAbsPath("Android project", &opts.AndroidProjectPath); err != nil {
+		return err
+	}
+	for {
+		if err := main1(args); err != nil {
+			if getStopSignal() != nil {
+				return err
+			}
+			logError("%v", err)
+		}
+		// stamped after the run, so what the hooks and upack itself write
+		// into the project, e.g. local.properties, doesn't trigger another
+		stamp, err := sourceStamp(opts.AndroidProjectPath)
+		if err != nil {
+			return fmt.Errorf("watch %s: %w", opts.AndroidProjectPath, err)
+		}
+		printProgress("watching %s for changes ...", opts.AndroidProjectPath)
+		if err := waitForChange(opts.AndroidProjectPath, stamp); err != nil {
+			return fmt.Errorf("watch %s: %w", opts.AndroidProjectPath, err)
+		}
+	}
+}
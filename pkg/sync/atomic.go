@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TempSiblingPattern names the temporary files and directories written next
+// to an output before being renamed into place, Unity skips hidden names and
+// the .tmp extension so it never imports them.
+func TempSiblingPattern(path string) string {
+	return "." + filepath.Base(path) + ".*.tmp"
+}
+
+// WriteAtomic writes path with write through a temporary sibling, which is
+// renamed over path only once complete, so a crash never leaves path
+// truncated.
+func WriteAtomic(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), TempSiblingPattern(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = write(f); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// WriteFileAtomic is ioutil.WriteFile going through a temporary sibling.
+func WriteFileAtomic(path string, content []byte, perm os.FileMode) error {
+	return WriteAtomic(path, perm, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// CopyFile copies srcFile to dstFile through a temporary sibling, the mode
+// of srcFile is kept.
+func CopyFile(srcFile, dstFile string) error {
+	in, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return WriteAtomic(dstFile, info.Mode().Perm(), func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
@@ -0,0 +1,167 @@
+// Package sync brings a directory up to date with another one while only
+// touching what differs, so Unity doesn't reimport unchanged plugin files.
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileHash returns the SHA-256 of the file at path.
+func FileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SameEntry tells whether dst already holds the same entry as src, info
+// describes src.
+func SameEntry(src, dst string, info os.FileInfo) (bool, error) {
+	dinfo, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if info.Mode().Type() != dinfo.Mode().Type() {
+		return false, nil
+	}
+	switch {
+	case info.IsDir():
+		return true, nil
+	case info.Mode()&os.ModeSymlink != 0:
+		srcLink, err := os.Readlink(src)
+		if err != nil {
+			return false, err
+		}
+		dstLink, err := os.Readlink(dst)
+		if err != nil {
+			return false, err
+		}
+		return srcLink == dstLink, nil
+	}
+	if info.Mode().Perm() != dinfo.Mode().Perm() || info.Size() != dinfo.Size() {
+		return false, nil
+	}
+	srcHash, err := FileHash(src)
+	if err != nil {
+		return false, err
+	}
+	dstHash, err := FileHash(dst)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(srcHash, dstHash), nil
+}
+
+// SameFileContent tells whether the file at path holds exactly content.
+func SameFileContent(path string, content []byte) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != int64(len(content)) {
+		return false
+	}
+	origin, err := ioutil.ReadFile(path)
+	return err == nil && bytes.Equal(origin, content)
+}
+
+// Changes compares srcDir with dstDir, the paths relative to them which
+// have to be written into dstDir and the ones to be removed from it are
+// returned. The .meta files of assets still in srcDir are kept.
+func Changes(srcDir, dstDir string) (updates, removals []string, err error) {
+	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		same, err := SameEntry(path, filepath.Join(dstDir, relPath), info)
+		if err != nil {
+			return err
+		}
+		if !same {
+			updates = append(updates, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = filepath.Walk(dstDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dstDir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		name := relPath
+		if strings.HasSuffix(name, ".meta") {
+			name = strings.TrimSuffix(name, ".meta")
+		}
+		if _, err := os.Lstat(filepath.Join(srcDir, name)); err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		removals = append(removals, relPath)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return updates, removals, nil
+}
+
+// Entry writes the entry src to dst, whatever dst holds is replaced. Regular
+// files are copied with copyFile, CopyFile is used if it is nil.
+func Entry(src, dst string, copyFile func(src, dst string) error) error {
+	if copyFile == nil {
+		copyFile = CopyFile
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if dinfo, err := os.Lstat(dst); err == nil {
+		if !(info.IsDir() && dinfo.IsDir()) && !(info.Mode().IsRegular() && dinfo.Mode().IsRegular()) {
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		return os.MkdirAll(dst, os.ModePerm)
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dst)
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Chmod(dst, info.Mode().Perm())
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zhiruili/upack/internal/testtree"
+)
+
+func slashPaths(paths []string) []string {
+	var out []string
+	for _, p := range paths {
+		out = append(out, filepath.ToSlash(p))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      map[string]string
+		dst      map[string]string
+		chmod    map[string]os.FileMode
+		updates  []string
+		removals []string
+	}{
+		{
+			name: "same trees have no changes",
+			src:  map[string]string{"a.jar": "a", "libs/b.jar": "b"},
+			dst:  map[string]string{"a.jar": "a", "libs/b.jar": "b"},
+		},
+		{
+			name:    "new and changed files are updated",
+			src:     map[string]string{"a.jar": "a2", "b.jar": "b"},
+			dst:     map[string]string{"a.jar": "a1"},
+			updates: []string{"a.jar", "b.jar"},
+		},
+		{
+			name:     "files gone from the source are removed",
+			src:      map[string]string{"a.jar": "a"},
+			dst:      map[string]string{"a.jar": "a", "old.jar": "o"},
+			removals: []string{"old.jar"},
+		},
+		{
+			name:     "meta files follow their asset",
+			src:      map[string]string{"a.jar": "a"},
+			dst:      map[string]string{"a.jar": "a", "a.jar.meta": "guid", "old.jar": "o", "old.jar.meta": "guid"},
+			removals: []string{"old.jar", "old.jar.meta"},
+		},
+		{
+			name:     "removed directories are reported once",
+			src:      map[string]string{"a.jar": "a"},
+			dst:      map[string]string{"a.jar": "a", "res/values/values.xml": "v", "res/raw/r.txt": "r"},
+			removals: []string{"res"},
+		},
+		{
+			name:    "mode changes are updates",
+			src:     map[string]string{"run.sh": "x"},
+			dst:     map[string]string{"run.sh": "x"},
+			chmod:   map[string]os.FileMode{"run.sh": 0755},
+			updates: []string{"run.sh"},
+		},
+		{
+			name:    "symlinks compare their targets",
+			src:     map[string]string{"real.so": "x", "same.so": "->real.so", "moved.so": "->real.so"},
+			dst:     map[string]string{"real.so": "x", "same.so": "->real.so", "moved.so": "->other.so"},
+			updates: []string{"moved.so"},
+		},
+		{
+			name:    "a file replacing a symlink is an update",
+			src:     map[string]string{"lib.so": "x"},
+			dst:     map[string]string{"lib.so": "->x"},
+			updates: []string{"lib.so"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			testtree.Write(t, src, tt.src)
+			testtree.Write(t, dst, tt.dst)
+			for name, mode := range tt.chmod {
+				if err := os.Chmod(filepath.Join(src, name), mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			updates, removals, err := Changes(src, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := slashPaths(updates); !reflect.DeepEqual(got, tt.updates) {
+				t.Errorf("updates = %q, want %q", got, tt.updates)
+			}
+			if got := slashPaths(removals); !reflect.DeepEqual(got, tt.removals) {
+				t.Errorf("removals = %q, want %q", got, tt.removals)
+			}
+		})
+	}
+}